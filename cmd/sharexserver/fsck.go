@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/mmichaelb/sharexserver/internal/sharexserver/config"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fsckCommand is the subcommand which checks the consistency of the file storage instead of running the server.
+const fsckCommand = "fsck"
+
+// runConsistencyCheck runs the consistency check of the given file storage with the given subcommand arguments. The
+// report is printed as JSON to the standard output. It returns the exit code which is 0 if no problems are left, 1 if
+// there are problems which were not repaired and 2 if the check could not be run.
+func runConsistencyCheck(fileStorage storage.FileStorage, arguments []string) int {
+	flagSet := flag.NewFlagSet(fsckCommand, flag.ExitOnError)
+	repair := flagSet.String("repair", "", `The way found problems are repaired. Possible values are "" (report `+
+		`only), "quarantine" (move into the quarantine folder) and "delete".`)
+	quarantineFolder := flagSet.String("quarantine-folder", "./quarantine/",
+		"The folder where the affected metadata and files are moved to when repairing with \"quarantine\".")
+	staleAfter := flagSet.Duration("stale-after", config.Cfg.GetDuration("stale_upload_grace_period"),
+		"The age after which uploads that are still waiting or have failed are reported.")
+	flagSet.Parse(arguments)
+	checkableStorage, ok := fileStorage.(storage.CheckableStorage)
+	if !ok {
+		log.Printf("The storage engine %s does not support the consistency check.\n",
+			strconv.Quote(config.Cfg.GetString("storage_engine")))
+		return 2
+	}
+	options := &storage.ConsistencyCheckOptions{
+		Repair:           storage.RepairMode(*repair),
+		QuarantineFolder: *quarantineFolder,
+		StaleBefore:      time.Now().Add(-*staleAfter),
+	}
+	switch options.Repair {
+	case storage.RepairNone, storage.RepairQuarantine, storage.RepairDelete:
+	default:
+		log.Printf("Unknown repair mode: %s\n", strconv.Quote(*repair))
+		return 2
+	}
+	if !strings.HasSuffix(options.QuarantineFolder, "/") {
+		options.QuarantineFolder += "/"
+	}
+	log.Println("Checking the consistency of the file storage...")
+	report, err := checkableStorage.CheckConsistency(options)
+	if err != nil {
+		log.Printf("There was an error while checking the consistency of the file storage, %T: %v\n", err, err)
+		return 2
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Printf("There was an error while printing the consistency report, %T: %v\n", err, err)
+		return 2
+	}
+	var unrepairedProblems int
+	for _, problem := range report.Problems {
+		if !problem.Repaired {
+			unrepairedProblems++
+		}
+	}
+	log.Printf("Checked %d entries and %d files: found %d problems, %d of them are not repaired.\n",
+		report.Entries, report.Files, len(report.Problems), unrepairedProblems)
+	if unrepairedProblems > 0 {
+		return 1
+	}
+	return 0
+}
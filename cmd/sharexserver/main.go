@@ -6,12 +6,16 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/mmichaelb/sharexserver/internal/sharexserver"
 	"github.com/mmichaelb/sharexserver/internal/sharexserver/config"
+	"github.com/mmichaelb/sharexserver/pkg/clamd"
 	"github.com/mmichaelb/sharexserver/pkg/router"
 	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"github.com/mmichaelb/sharexserver/pkg/storage/storages"
+	"github.com/mmichaelb/sharexserver/pkg/webhook"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 )
 
 // general information about the application
@@ -35,36 +39,158 @@ func main() {
 		log.Fatalf("Could not load configuration from file, %T: %v\n", err, err)
 	}
 	log.Printf("Successfully loaded %d configuration keys.\n", len(config.Cfg.AllKeys()))
+	// initialize the configured file storage
+	fileStorage := initializeFileStorage()
+	// run the consistency check instead of the ShareX server if requested
+	if flag.Arg(0) == fsckCommand {
+		exitCode := runConsistencyCheck(fileStorage, flag.Args()[1:])
+		if err := fileStorage.Close(); err != nil {
+			log.Printf("There was an error while closing the ShareX file storage, %T: %v\n", err, err)
+		}
+		os.Exit(exitCode)
+	}
 	// setup default mux router
 	muxRouter := mux.NewRouter()
-	var fileStorage storage.FileStorage
-	var err error
-	// determine from configuration value which file storage system should be used
-	storageEngine := config.Cfg.GetString("storage_engine")
-	switch storageEngine {
-	case "MongoDB+file":
-		// default storage system (MongoDB + standard system files)
-		fileStorage, err = config.ParseMongoStorageFromConfig(config.Cfg.GetString("storage_engine_config"))
-		break
-	default:
-		log.Fatalf("Unknown storage engine: %s\n", strconv.Quote(storageEngine))
-	}
-	// an error occurred while creating the file storage system
-	if err != nil {
-		log.Fatalf("Could not read parse %s storage system from configuration file, %T: %v.\n",
-			strconv.Quote(storageEngine), err, err)
-	}
-	// initialization via interface method Initialize of the file storage instance
-	log.Printf("Initializing file storage (%s)...\n", strconv.Quote(storageEngine))
-	if err := fileStorage.Initialize(); err != nil {
-		log.Fatalf("There was an error while initializing the storage (%s), %T: %v\n",
-			strconv.Quote(storageEngine), err, err)
+	// determine where the access tokens of the uploaders are stored if the authentication is enabled
+	var tokenStorage storage.TokenStorage
+	if config.Cfg.GetBool("upload_authentication") {
+		if storageTokens, ok := fileStorage.(storage.TokenStorage); ok {
+			// the file storage is able to store the tokens on its own
+			tokenStorage = storageTokens
+		} else {
+			tokenFile := config.Cfg.GetString("token_file")
+			log.Printf("Loading access tokens from %s...\n", strconv.Quote(tokenFile))
+			fileTokenStorage := &storages.FileTokenStorage{Filepath: tokenFile}
+			if err := fileTokenStorage.Initialize(); err != nil {
+				log.Fatalf("There was an error while loading the access tokens, %T: %v\n", err, err)
+			}
+			tokenStorage = fileTokenStorage
+		}
+		if config.Cfg.GetString("admin_token") == "" {
+			log.Println("WARNING: No admin token is set, so no access tokens can be issued for uploading.")
+		}
+	} else {
+		log.Println("WARNING: The upload authentication is disabled, so anyone who is able to reach the ShareX " +
+			"server can upload files!")
 	}
 	log.Println("Done with storage initialization! Continuing with the binding of the ShareX muxRouter...")
 	// bind ShareXRouter to previously initialized mux muxRouter
 	shareXRouter := &router.ShareXRouter{
-		Storage:                 fileStorage,
-		WhitelistedContentTypes: config.Cfg.GetStringSlice("whitelisted_content_types"),
+		Storage:                   fileStorage,
+		PublicURL:                 config.Cfg.GetString("public_url"),
+		WhitelistedContentTypes:   config.Cfg.GetStringSlice("whitelisted_content_types"),
+		AllowedContentTypes:       config.Cfg.GetStringSlice("allowed_content_types"),
+		DeniedContentTypes:        config.Cfg.GetStringSlice("denied_content_types"),
+		AllowedExtensions:         config.Cfg.GetStringSlice("allowed_extensions"),
+		DeniedExtensions:          config.Cfg.GetStringSlice("denied_extensions"),
+		StripMetadataContentTypes: config.Cfg.GetStringSlice("strip_metadata_content_types"),
+		AdminToken:                config.Cfg.GetString("admin_token"),
+		Tokens:                    tokenStorage,
+		ResumableFolder:           config.Cfg.GetString("resumable_upload_folder"),
+		MaximumUploadSize:         int64(config.Cfg.GetSizeInBytes("maximum_upload_size")),
+		DefaultQuota: storage.Quota{
+			Bytes: int64(config.Cfg.GetSizeInBytes("default_quota_size")),
+			Files: config.Cfg.GetInt("default_quota_files"),
+		},
+		ThumbnailSize:              config.Cfg.GetInt("thumbnail_size"),
+		ImageProcessingConcurrency: config.Cfg.GetInt("image_processing_concurrency"),
+		MaximumResizeDimension:     config.Cfg.GetInt("maximum_resize_dimension"),
+		ResizeCacheSize:            int64(config.Cfg.GetSizeInBytes("resize_cache_size")),
+	}
+	if _, ok := fileStorage.(storage.UsageStorage); !ok {
+		log.Println("The storage engine does not support quotas, so they are not enforced.")
+	}
+	// scan the uploads for viruses if clamd is configured
+	if clamdAddress := config.Cfg.GetString("clamd_address"); clamdAddress != "" {
+		infectedAction := config.Cfg.GetString("clamd_infected_action")
+		if infectedAction != "reject" && infectedAction != "quarantine" {
+			log.Fatalf("Unknown action for infected uploads: %s\n", strconv.Quote(infectedAction))
+		}
+		if _, ok := fileStorage.(storage.QuarantiningStorage); !ok && infectedAction == "quarantine" {
+			log.Println("The storage engine does not support quarantines, so infected uploads are deleted.")
+		}
+		shareXRouter.PreStoreHooks = append(shareXRouter.PreStoreHooks, &clamd.Scanner{
+			Network:    config.Cfg.GetString("clamd_network"),
+			Address:    clamdAddress,
+			Timeout:    config.Cfg.GetDuration("clamd_timeout"),
+			Quarantine: infectedAction == "quarantine",
+			FailOpen:   config.Cfg.GetBool("clamd_fail_open"),
+		})
+	}
+	// send the events about the entries to the webhooks if there are any
+	var webhooks []*webhook.Webhook
+	if err := config.Cfg.UnmarshalKey("webhooks", &webhooks); err != nil {
+		log.Fatalf("Could not read the webhooks from the configuration, %T: %v\n", err, err)
+	}
+	var dispatcher *webhook.Dispatcher
+	if len(webhooks) > 0 {
+		dispatcher = &webhook.Dispatcher{
+			Webhooks:             webhooks,
+			QueueFolder:          config.Cfg.GetString("webhook_queue_folder"),
+			Storage:              fileStorage,
+			PublicURL:            config.Cfg.GetString("public_url"),
+			Timeout:              config.Cfg.GetDuration("webhook_timeout"),
+			MaximumAttempts:      config.Cfg.GetInt("webhook_maximum_attempts"),
+			RetryInterval:        config.Cfg.GetDuration("webhook_retry_interval"),
+			MaximumRetryInterval: config.Cfg.GetDuration("webhook_maximum_retry_interval"),
+		}
+		if err := dispatcher.Start(); err != nil {
+			log.Fatalf("There was an error while starting the webhook dispatcher, %T: %v\n", err, err)
+		}
+		log.Printf("Sending events to %d webhooks.\n", len(webhooks))
+		shareXRouter.PostStoreHooks = append(shareXRouter.PostStoreHooks, dispatcher)
+		shareXRouter.DeleteHooks = append(shareXRouter.DeleteHooks, dispatcher)
+		shareXRouter.AccessHooks = append(shareXRouter.AccessHooks, dispatcher)
+	}
+	// remove expired entries and stale uploads in the background if the file storage supports it, stale resumable
+	// uploads in any case and prune the cache of resized images
+	staleUploadGracePeriod := config.Cfg.GetDuration("stale_upload_grace_period")
+	cleanupJanitor := &storage.Janitor{
+		Interval: config.Cfg.GetDuration("cleanup_interval"),
+		Task: func(now time.Time) {
+			if expiringStorage, ok := fileStorage.(storage.ExpiringStorage); ok {
+				deletedEntries, err := expiringStorage.DeleteExpired(now)
+				if err != nil {
+					log.Printf("There was an error while removing expired entries, %T: %v\n", err, err)
+				}
+				if len(deletedEntries) > 0 {
+					log.Printf("Removed %d expired entries.\n", len(deletedEntries))
+				}
+				if dispatcher != nil {
+					if err := dispatcher.Expired(deletedEntries); err != nil {
+						log.Printf("There was an error while queueing the events about expired entries, %T: %v\n",
+							err, err)
+					}
+				}
+			}
+			if sweepableStorage, ok := fileStorage.(storage.SweepableStorage); ok {
+				deletedEntries, err := sweepableStorage.DeleteStale(now.Add(-staleUploadGracePeriod))
+				if err != nil {
+					log.Printf("There was an error while removing stale uploads, %T: %v\n", err, err)
+				}
+				if len(deletedEntries) > 0 {
+					log.Printf("Removed %d stale uploads.\n", len(deletedEntries))
+				}
+			}
+			deletedUploads, err := shareXRouter.DeleteStaleResumableUploads(now.Add(-staleUploadGracePeriod))
+			if err != nil {
+				log.Printf("There was an error while removing stale resumable uploads, %T: %v\n", err, err)
+			}
+			if deletedUploads > 0 {
+				log.Printf("Removed %d stale resumable uploads.\n", deletedUploads)
+			}
+			prunedImages, err := shareXRouter.PruneResizeCache()
+			if err != nil {
+				log.Printf("There was an error while pruning the cache of resized images, %T: %v\n", err, err)
+			}
+			if prunedImages > 0 {
+				log.Printf("Removed %d cached resized images.\n", prunedImages)
+			}
+		},
+	}
+	if err := cleanupJanitor.Start(); err != nil {
+		log.Fatalf("Invalid value for \"cleanup_interval\": %s, %v\n",
+			strconv.Quote(config.Cfg.GetString("cleanup_interval")), err)
 	}
 	// bind ShareX server handler to existing mux muxRouter
 	shareXRouter.WrapHandler(muxRouter.PathPrefix("/").Subrouter())
@@ -100,8 +226,53 @@ func main() {
 	if err := httpServer.Close(); err != nil {
 		log.Printf("There was an error while closing the ShareX server, %T: %v\n", err, err)
 	}
+	cleanupJanitor.Stop()
+	if dispatcher != nil {
+		dispatcher.Stop()
+	}
 	if err := fileStorage.Close(); err != nil {
 		log.Printf("There was an error while closing the ShareX file storage, %T: %v\n", err, err)
 	}
 	log.Println("Thank you for using the ShareX server. Bye!")
-}
\ No newline at end of file
+}
+
+// initializeFileStorage parses the file storage selected by the storage engine configuration value and initializes it.
+// The application exits if something goes wrong.
+func initializeFileStorage() storage.FileStorage {
+	var fileStorage storage.FileStorage
+	var err error
+	// determine from configuration value which file storage system should be used
+	storageEngine := config.Cfg.GetString("storage_engine")
+	switch storageEngine {
+	case "MongoDB+file":
+		// default storage system (MongoDB + standard system files)
+		fileStorage, err = config.ParseMongoStorageFromConfig(config.Cfg.GetString("storage_engine_config"))
+		break
+	case "file":
+		// standalone storage system (standard system files only)
+		fileStorage, err = config.ParseFileSystemStorageFromConfig(config.Cfg.GetString("storage_engine_config"))
+		break
+	case "embedded+file":
+		// standalone storage system (embedded database + standard system files)
+		fileStorage, err = config.ParseEmbeddedStorageFromConfig(config.Cfg.GetString("storage_engine_config"))
+		break
+	case "S3":
+		// object storage system (S3-compatible bucket + object metadata or MongoDB)
+		fileStorage, err = config.ParseS3StorageFromConfig(config.Cfg.GetString("storage_engine_config"))
+		break
+	default:
+		log.Fatalf("Unknown storage engine: %s\n", strconv.Quote(storageEngine))
+	}
+	// an error occurred while creating the file storage system
+	if err != nil {
+		log.Fatalf("Could not read parse %s storage system from configuration file, %T: %v.\n",
+			strconv.Quote(storageEngine), err, err)
+	}
+	// initialization via interface method Initialize of the file storage instance
+	log.Printf("Initializing file storage (%s)...\n", strconv.Quote(storageEngine))
+	if err := fileStorage.Initialize(); err != nil {
+		log.Fatalf("There was an error while initializing the storage (%s), %T: %v\n",
+			strconv.Quote(storageEngine), err, err)
+	}
+	return fileStorage
+}
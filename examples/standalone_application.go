@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"github.com/gorilla/mux"
 	"github.com/mmichaelb/sharexserver/pkg/router"
 	"github.com/mmichaelb/sharexserver/pkg/storage/storages"
 	"gopkg.in/mgo.v2"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -37,6 +40,24 @@ func main() {
 	shareXRouter := router.ShareXRouter{
 		Storage:                 fileStorage,
 		WhitelistedContentTypes: []string{"image/png", "image/jpeg"},
+		// reject uploads of disk images before they are stored
+		PreStoreHooks: []router.PreStoreHook{
+			router.PreStoreHookFunc(func(ctx context.Context, upload *router.Upload) error {
+				if strings.HasSuffix(strings.ToLower(upload.Entry.Filename), ".iso") {
+					return router.Reject(http.StatusUnsupportedMediaType, "disk images are not allowed")
+				}
+				return nil
+			}),
+		},
+		// log every stored entry, e.g. to index it
+		PostStoreHooks: []router.PostStoreHook{
+			router.PostStoreHookFunc(func(ctx context.Context, upload *router.Upload) error {
+				log.Printf("%v uploaded %v (%v bytes)\n", upload.Entry.Author, upload.Entry.Filename, upload.Size)
+				return nil
+			}),
+		},
+		// hooks are canceled after five seconds
+		HookTimeout: 5 * time.Second,
 	}
 	// add ShareX handler to main router
 	shareXRouter.WrapHandler(mainRouter.PathPrefix("/sharex/").Subrouter())
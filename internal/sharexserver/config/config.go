@@ -19,11 +19,41 @@ func loadCfg(fileName string) (cfg *viper.Viper, err error) {
 	cfg.SetDefault("storage_engine", "MongoDB+file")
 	cfg.SetDefault("storage_engine_config", "./mongo-storage-config.toml")
 	cfg.SetDefault("reverse_proxy_header", "")
+	cfg.SetDefault("public_url", "")
 	cfg.SetDefault("whitelisted_content_types", []string{
 		"image/png", "image/jpeg", "image/jpg", "image/gif",
 		"text/plain", "text/plain; charset=utf-8",
 		"video/mp4", "video/mpeg", "video/mpg4", "video/mpeg4", "video/flv",
 	})
+	cfg.SetDefault("allowed_content_types", []string{})
+	cfg.SetDefault("denied_content_types", []string{})
+	cfg.SetDefault("allowed_extensions", []string{})
+	cfg.SetDefault("denied_extensions", []string{})
+	cfg.SetDefault("strip_metadata_content_types", []string{"image/jpeg", "image/png"})
+	cfg.SetDefault("clamd_network", "tcp")
+	cfg.SetDefault("clamd_address", "")
+	cfg.SetDefault("clamd_timeout", "30s")
+	cfg.SetDefault("clamd_infected_action", "reject")
+	cfg.SetDefault("clamd_fail_open", false)
+	cfg.SetDefault("admin_token", "")
+	cfg.SetDefault("upload_authentication", true)
+	cfg.SetDefault("token_file", "./tokens.json")
+	cfg.SetDefault("cleanup_interval", "1m")
+	cfg.SetDefault("stale_upload_grace_period", "24h")
+	cfg.SetDefault("resumable_upload_folder", "./resumable-uploads/")
+	cfg.SetDefault("maximum_upload_size", "0")
+	cfg.SetDefault("default_quota_size", "0")
+	cfg.SetDefault("default_quota_files", 0)
+	cfg.SetDefault("thumbnail_size", 256)
+	cfg.SetDefault("image_processing_concurrency", 0)
+	cfg.SetDefault("maximum_resize_dimension", 2048)
+	cfg.SetDefault("resize_cache_size", "256MB")
+	cfg.SetDefault("webhook_queue_folder", "./webhook-queue/")
+	cfg.SetDefault("webhook_timeout", "10s")
+	cfg.SetDefault("webhook_maximum_attempts", 10)
+	cfg.SetDefault("webhook_retry_interval", "30s")
+	cfg.SetDefault("webhook_maximum_retry_interval", "1h")
+	cfg.SetDefault("webhooks", []map[string]interface{}{})
 	// read config from filepath
 	err = cfg.ReadInConfig()
 	return
@@ -2,9 +2,11 @@ package config
 
 import (
 	"fmt"
+	"github.com/mmichaelb/sharexserver/pkg/webhook"
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestMainConfig(t *testing.T) {
@@ -27,4 +29,102 @@ func TestMainConfig(t *testing.T) {
 	if whitelistedContentTypes := cfg.GetStringSlice("whitelisted_content_types"); !reflect.DeepEqual(whitelistedContentTypes, []string{"first-ct", "a-mime-type", "sp€ci4l"}) {
 		t.Fatalf(`Invalid value for "whitelisted_content_types": %s`, strconv.Quote(fmt.Sprintf("%+v", whitelistedContentTypes)))
 	}
+	if publicURL := cfg.GetString("public_url"); publicURL != "https://sharex.example.com/" {
+		t.Fatalf(`Invalid value for "public_url": %s`, strconv.Quote(publicURL))
+	}
+	if allowedContentTypes := cfg.GetStringSlice("allowed_content_types"); !reflect.DeepEqual(allowedContentTypes, []string{"image/*", "video/mp4"}) {
+		t.Fatalf(`Invalid value for "allowed_content_types": %v`, allowedContentTypes)
+	}
+	if deniedContentTypes := cfg.GetStringSlice("denied_content_types"); len(deniedContentTypes) != 0 {
+		t.Fatalf(`Invalid value for "denied_content_types": %v`, deniedContentTypes)
+	}
+	if allowedExtensions := cfg.GetStringSlice("allowed_extensions"); !reflect.DeepEqual(allowedExtensions, []string{".png"}) {
+		t.Fatalf(`Invalid value for "allowed_extensions": %v`, allowedExtensions)
+	}
+	if deniedExtensions := cfg.GetStringSlice("denied_extensions"); !reflect.DeepEqual(deniedExtensions, []string{".exe"}) {
+		t.Fatalf(`Invalid value for "denied_extensions": %v`, deniedExtensions)
+	}
+	if stripMetadataContentTypes := cfg.GetStringSlice("strip_metadata_content_types"); !reflect.DeepEqual(stripMetadataContentTypes, []string{"image/jpeg"}) {
+		t.Fatalf(`Invalid value for "strip_metadata_content_types": %v`, stripMetadataContentTypes)
+	}
+	if clamdNetwork := cfg.GetString("clamd_network"); clamdNetwork != "unix" {
+		t.Fatalf(`Invalid value for "clamd_network": %s`, strconv.Quote(clamdNetwork))
+	}
+	if clamdAddress := cfg.GetString("clamd_address"); clamdAddress != "/run/clamav/clamd.ctl" {
+		t.Fatalf(`Invalid value for "clamd_address": %s`, strconv.Quote(clamdAddress))
+	}
+	if clamdTimeout := cfg.GetDuration("clamd_timeout"); clamdTimeout != 30*time.Second {
+		t.Fatalf(`Invalid value for "clamd_timeout": %v`, clamdTimeout)
+	}
+	if clamdInfectedAction := cfg.GetString("clamd_infected_action"); clamdInfectedAction != "quarantine" {
+		t.Fatalf(`Invalid value for "clamd_infected_action": %s`, strconv.Quote(clamdInfectedAction))
+	}
+	if !cfg.GetBool("clamd_fail_open") {
+		t.Fatal(`Invalid value for "clamd_fail_open": false`)
+	}
+	if adminToken := cfg.GetString("admin_token"); adminToken != "MySuperSecureAdminToken+!#" {
+		t.Fatalf(`Invalid value for "admin_token": %s`, strconv.Quote(adminToken))
+	}
+	if uploadAuthentication := cfg.GetBool("upload_authentication"); uploadAuthentication {
+		t.Fatalf(`Invalid value for "upload_authentication": %v`, uploadAuthentication)
+	}
+	if tokenFile := cfg.GetString("token_file"); tokenFile != "./tokens.json" {
+		t.Fatalf(`Invalid value for "token_file": %s`, strconv.Quote(tokenFile))
+	}
+	if cleanupInterval := cfg.GetDuration("cleanup_interval"); cleanupInterval != 90*time.Second {
+		t.Fatalf(`Invalid value for "cleanup_interval": %v`, cleanupInterval)
+	}
+	if staleUploadGracePeriod := cfg.GetDuration("stale_upload_grace_period"); staleUploadGracePeriod != 150*time.Minute {
+		t.Fatalf(`Invalid value for "stale_upload_grace_period": %v`, staleUploadGracePeriod)
+	}
+	if resumableUploadFolder := cfg.GetString("resumable_upload_folder"); resumableUploadFolder != "./partial-uploads/" {
+		t.Fatalf(`Invalid value for "resumable_upload_folder": %s`, strconv.Quote(resumableUploadFolder))
+	}
+	if maximumUploadSize := cfg.GetSizeInBytes("maximum_upload_size"); maximumUploadSize != 40<<20 {
+		t.Fatalf(`Invalid value for "maximum_upload_size": %d`, maximumUploadSize)
+	}
+	if defaultQuotaSize := cfg.GetSizeInBytes("default_quota_size"); defaultQuotaSize != 1<<30 {
+		t.Fatalf(`Invalid value for "default_quota_size": %d`, defaultQuotaSize)
+	}
+	if defaultQuotaFiles := cfg.GetInt("default_quota_files"); defaultQuotaFiles != 250 {
+		t.Fatalf(`Invalid value for "default_quota_files": %d`, defaultQuotaFiles)
+	}
+	if thumbnailSize := cfg.GetInt("thumbnail_size"); thumbnailSize != 128 {
+		t.Fatalf(`Invalid value for "thumbnail_size": %d`, thumbnailSize)
+	}
+	if imageProcessingConcurrency := cfg.GetInt("image_processing_concurrency"); imageProcessingConcurrency != 2 {
+		t.Fatalf(`Invalid value for "image_processing_concurrency": %d`, imageProcessingConcurrency)
+	}
+	if maximumResizeDimension := cfg.GetInt("maximum_resize_dimension"); maximumResizeDimension != 1024 {
+		t.Fatalf(`Invalid value for "maximum_resize_dimension": %d`, maximumResizeDimension)
+	}
+	if resizeCacheSize := cfg.GetSizeInBytes("resize_cache_size"); resizeCacheSize != 64<<20 {
+		t.Fatalf(`Invalid value for "resize_cache_size": %d`, resizeCacheSize)
+	}
+	if webhookQueueFolder := cfg.GetString("webhook_queue_folder"); webhookQueueFolder != "./pending-webhooks/" {
+		t.Fatalf(`Invalid value for "webhook_queue_folder": %s`, strconv.Quote(webhookQueueFolder))
+	}
+	if webhookTimeout := cfg.GetDuration("webhook_timeout"); webhookTimeout != 5*time.Second {
+		t.Fatalf(`Invalid value for "webhook_timeout": %v`, webhookTimeout)
+	}
+	if webhookMaximumAttempts := cfg.GetInt("webhook_maximum_attempts"); webhookMaximumAttempts != 3 {
+		t.Fatalf(`Invalid value for "webhook_maximum_attempts": %d`, webhookMaximumAttempts)
+	}
+	if webhookRetryInterval := cfg.GetDuration("webhook_retry_interval"); webhookRetryInterval != 30*time.Second {
+		t.Fatalf(`Invalid value for "webhook_retry_interval": %v`, webhookRetryInterval)
+	}
+	if webhookMaximumRetryInterval := cfg.GetDuration("webhook_maximum_retry_interval"); webhookMaximumRetryInterval != 15*time.Minute {
+		t.Fatalf(`Invalid value for "webhook_maximum_retry_interval": %v`, webhookMaximumRetryInterval)
+	}
+	var webhooks []*webhook.Webhook
+	if err := cfg.UnmarshalKey("webhooks", &webhooks); err != nil || !reflect.DeepEqual(webhooks, []*webhook.Webhook{
+		{
+			URL:    "https://chat.example.com/hooks/sharex",
+			Secret: "MySuperSecureWebhookSecret+!#",
+			Events: []string{webhook.EventCreated, webhook.EventDeleted},
+		},
+		{URL: "https://audit.example.com/events"},
+	}) {
+		t.Fatalf(`Invalid value for "webhooks": %+v (%v)`, webhooks, err)
+	}
 }
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"github.com/mmichaelb/sharexserver/pkg/storage/storages"
+	"github.com/spf13/viper"
+	"log"
+	"os"
+)
+
+func loadEmbeddedCfg(fileName string) (embeddedCfg *viper.Viper, err error) {
+	embeddedCfg = viper.New()
+	// set configuration filepath to the provided parameter
+	embeddedCfg.SetConfigFile(fileName)
+	// add default values if the given config file does not contains specific values or do not exist
+	// default values taken from ../../../configs/default-embedded-storage-config.toml
+	embeddedCfg.SetDefault("database_file", "./sharexserver.db")
+	embeddedCfg.SetDefault("storage_folder", "./files/")
+	// read config from filepath
+	err = embeddedCfg.ReadInConfig()
+	return
+}
+
+// ParseEmbeddedStorageFromConfig parses an implemented embedded database+file storage from the given fileName which is
+// the path pointing to the configuration file. It returns the file storage and an error if something goes wrong.
+func ParseEmbeddedStorageFromConfig(fileName string) (storage storage.FileStorage, err error) {
+	var embeddedCfg *viper.Viper
+	embeddedCfg, err = loadEmbeddedCfg(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("Could not read embedded storage configuration from file, %T: %v. Falling back to defaults.\n",
+				err, err)
+			err = nil
+		}
+	}
+	storage = &storages.EmbeddedStorage{
+		DatabaseFile: embeddedCfg.GetString("database_file"),
+		DataFolder:   embeddedCfg.GetString("storage_folder"),
+	}
+	return
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestEmbeddedConfig(t *testing.T) {
+	cfg, err := loadEmbeddedCfg("../../../test/test-embedded-storage-config.toml")
+	if err != nil {
+		t.Fatalf("Could not load embedded storage test config file, %T: %v\n", err, err)
+	}
+	if databaseFile := cfg.GetString("database_file"); databaseFile != "./sharex-metadata.db" {
+		t.Fatalf(`Invalid value for "database_file": %s`, strconv.Quote(databaseFile))
+	}
+	if storageFolder := cfg.GetString("storage_folder"); storageFolder != "./files/" {
+		t.Fatalf(`Invalid value for "storage_folder": %s`, strconv.Quote(storageFolder))
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"github.com/mmichaelb/sharexserver/pkg/storage/storages"
+	"github.com/spf13/viper"
+	"log"
+	"os"
+)
+
+func loadFileSystemCfg(fileName string) (fileSystemCfg *viper.Viper, err error) {
+	fileSystemCfg = viper.New()
+	// set configuration filepath to the provided parameter
+	fileSystemCfg.SetConfigFile(fileName)
+	// add default values if the given config file does not contains specific values or do not exist
+	// default values taken from ../../../configs/default-filesystem-storage-config.toml
+	fileSystemCfg.SetDefault("storage_folder", "./files/")
+	// read config from filepath
+	err = fileSystemCfg.ReadInConfig()
+	return
+}
+
+// ParseFileSystemStorageFromConfig parses an implemented file system storage from the given fileName which is the path
+// pointing to the configuration file. It returns the file storage and an error if something goes wrong.
+func ParseFileSystemStorageFromConfig(fileName string) (storage storage.FileStorage, err error) {
+	var fileSystemCfg *viper.Viper
+	fileSystemCfg, err = loadFileSystemCfg(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("Could not read file system storage configuration from file, %T: %v. Falling back to defaults.\n",
+				err, err)
+			err = nil
+		}
+	}
+	storage = &storages.FileSystemStorage{
+		DataFolder: fileSystemCfg.GetString("storage_folder"),
+	}
+	return
+}
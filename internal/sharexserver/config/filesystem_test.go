@@ -0,0 +1,16 @@
+package config
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestFileSystemConfig(t *testing.T) {
+	cfg, err := loadFileSystemCfg("../../../test/test-filesystem-storage-config.toml")
+	if err != nil {
+		t.Fatalf("Could not load file system storage test config file, %T: %v\n", err, err)
+	}
+	if storageFolder := cfg.GetString("storage_folder"); storageFolder != "./sharex-files/" {
+		t.Fatalf(`Invalid value for "storage_folder": %s`, strconv.Quote(storageFolder))
+	}
+}
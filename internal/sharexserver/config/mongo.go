@@ -24,6 +24,10 @@ func loadMongoCfg(fileName string) (mongoCfg *viper.Viper, err error) {
 	mongoCfg.SetDefault("auth_passwd", "")
 	mongoCfg.SetDefault("storage_db", "sharexserver")
 	mongoCfg.SetDefault("storage_file_col", "uploads")
+	mongoCfg.SetDefault("storage_token_col", "tokens")
+	mongoCfg.SetDefault("storage_blob_col", "blobs")
+	mongoCfg.SetDefault("storage_variant_col", "variants")
+	mongoCfg.SetDefault("deduplicate", false)
 	// read config from filepath
 	err = mongoCfg.ReadInConfig()
 	return
@@ -49,10 +53,14 @@ func ParseMongoStorageFromConfig(fileName string) (storage storage.FileStorage,
 		Password: mongoCfg.GetString("auth_passwd"),
 	}
 	storage = &storages.MongoStorage{
-		DialInfo:       dialInfo,
-		DataFolder:     mongoCfg.GetString("storage_folder"),
-		DatabaseName:   mongoCfg.GetString("storage_db"),
-		CollectionName: mongoCfg.GetString("storage_file_col"),
+		DialInfo:              dialInfo,
+		DataFolder:            mongoCfg.GetString("storage_folder"),
+		DatabaseName:          mongoCfg.GetString("storage_db"),
+		CollectionName:        mongoCfg.GetString("storage_file_col"),
+		TokenCollectionName:   mongoCfg.GetString("storage_token_col"),
+		BlobCollectionName:    mongoCfg.GetString("storage_blob_col"),
+		VariantCollectionName: mongoCfg.GetString("storage_variant_col"),
+		Deduplicate:           mongoCfg.GetBool("deduplicate"),
 	}
 	return
 }
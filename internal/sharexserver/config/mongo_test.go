@@ -35,4 +35,16 @@ func TestMongoConfig(t *testing.T) {
 	if storageFileCol := cfg.GetString("storage_file_col"); storageFileCol != "uploads" {
 		t.Fatalf(`Invalid value for "storage_file_col": %s`, strconv.Quote(storageFileCol))
 	}
+	if storageTokenCol := cfg.GetString("storage_token_col"); storageTokenCol != "access-tokens" {
+		t.Fatalf(`Invalid value for "storage_token_col": %s`, strconv.Quote(storageTokenCol))
+	}
+	if storageBlobCol := cfg.GetString("storage_blob_col"); storageBlobCol != "blobs" {
+		t.Fatalf(`Invalid value for "storage_blob_col": %s`, strconv.Quote(storageBlobCol))
+	}
+	if storageVariantCol := cfg.GetString("storage_variant_col"); storageVariantCol != "derived-images" {
+		t.Fatalf(`Invalid value for "storage_variant_col": %s`, strconv.Quote(storageVariantCol))
+	}
+	if deduplicate := cfg.GetBool("deduplicate"); !deduplicate {
+		t.Fatalf(`Invalid value for "deduplicate": %v`, deduplicate)
+	}
 }
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"github.com/mmichaelb/sharexserver/pkg/storage/storages"
+	"github.com/spf13/viper"
+	"log"
+	"os"
+	"strconv"
+)
+
+func loadS3Cfg(fileName string) (s3Cfg *viper.Viper, err error) {
+	s3Cfg = viper.New()
+	// set configuration filepath to the provided parameter
+	s3Cfg.SetConfigFile(fileName)
+	// add default values if the given config file does not contains specific values or do not exist
+	// default values taken from ../../../configs/default-s3-storage-config.toml
+	s3Cfg.SetDefault("endpoint", "http://localhost:9000")
+	s3Cfg.SetDefault("region", "us-east-1")
+	s3Cfg.SetDefault("bucket", "sharexserver")
+	s3Cfg.SetDefault("access_key_id", "")
+	s3Cfg.SetDefault("secret_access_key", "")
+	s3Cfg.SetDefault("path_style", true)
+	s3Cfg.SetDefault("key_prefix", "")
+	s3Cfg.SetDefault("metadata_storage", "object")
+	s3Cfg.SetDefault("mongo_storage_config", "./mongo-storage-config.toml")
+	// read config from filepath
+	err = s3Cfg.ReadInConfig()
+	return
+}
+
+// ParseS3StorageFromConfig parses an implemented S3 storage from the given fileName which is the path pointing to the
+// configuration file. Depending on the configuration, the metadata is either stored as object metadata or in MongoDB.
+// It returns the file storage and an error if something goes wrong.
+func ParseS3StorageFromConfig(fileName string) (storage storage.FileStorage, err error) {
+	var s3Cfg *viper.Viper
+	s3Cfg, err = loadS3Cfg(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Printf("Could not read S3 storage configuration from file, %T: %v. Falling back to defaults.\n",
+				err, err)
+			err = nil
+		}
+	}
+	bucket := &storages.S3Bucket{
+		Endpoint:        s3Cfg.GetString("endpoint"),
+		Region:          s3Cfg.GetString("region"),
+		Name:            s3Cfg.GetString("bucket"),
+		AccessKeyID:     s3Cfg.GetString("access_key_id"),
+		SecretAccessKey: s3Cfg.GetString("secret_access_key"),
+		PathStyle:       s3Cfg.GetBool("path_style"),
+	}
+	switch metadataStorage := s3Cfg.GetString("metadata_storage"); metadataStorage {
+	case "object":
+		storage = &storages.S3Storage{
+			Bucket:    bucket,
+			KeyPrefix: s3Cfg.GetString("key_prefix"),
+		}
+	case "MongoDB":
+		// store the metadata in MongoDB and only the file data in the bucket
+		if storage, err = ParseMongoStorageFromConfig(s3Cfg.GetString("mongo_storage_config")); err != nil {
+			return
+		}
+		storage.(*storages.MongoStorage).BlobStore = &storages.S3BlobStore{
+			Bucket:    bucket,
+			KeyPrefix: s3Cfg.GetString("key_prefix"),
+		}
+	default:
+		err = fmt.Errorf("unknown S3 metadata storage: %s", strconv.Quote(metadataStorage))
+	}
+	return
+}
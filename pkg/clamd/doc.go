@@ -0,0 +1,3 @@
+// Package clamd contains an upload hook of the router which scans the uploaded data for viruses with the ClamAV
+// daemon clamd.
+package clamd
@@ -0,0 +1,169 @@
+package clamd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/mmichaelb/sharexserver/pkg/router"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// instreamCommand makes clamd scan the data which is sent in chunks afterwards. The prefix "z" means that the
+	// command and the reply are terminated by a null byte.
+	instreamCommand = "zINSTREAM\x00"
+	// streamPrefix and the suffixes are the parts of the reply of clamd after scanning a stream.
+	streamPrefix = "stream: "
+	cleanSuffix  = "OK"
+	foundSuffix  = " FOUND"
+	// maximumReplyLength is the maximum length of a reply of clamd.
+	maximumReplyLength = 1 << 10
+)
+
+// Scanner is a router.PreStoreHook which streams the data of every upload to clamd via the INSTREAM command while it
+// is stored. The StreamMaxLength of clamd has to be at least as large as the maximum upload size because larger
+// uploads are treated as if clamd was unavailable.
+type Scanner struct {
+	// Network and Address locate clamd, e.g. "tcp" and "localhost:3310" or "unix" and "/run/clamav/clamd.ctl".
+	Network, Address string
+	// Timeout limits connecting to clamd and every read and write of the connection. A zero value means that there is
+	// no timeout.
+	Timeout time.Duration
+	// Quarantine decides whether infected uploads are quarantined (see router.Upload) instead of being rejected.
+	Quarantine bool
+	// FailOpen decides whether uploads are accepted without being scanned if clamd is unavailable. Otherwise they are
+	// rejected with the status code 503.
+	FailOpen bool
+}
+
+// PreStore is the implementation of the router.PreStoreHook.PreStore method
+func (scanner *Scanner) PreStore(ctx context.Context, upload *router.Upload) error {
+	dialer := &net.Dialer{Timeout: scanner.Timeout}
+	connection, err := dialer.DialContext(ctx, scanner.Network, scanner.Address)
+	if err != nil {
+		return scanner.unavailable(err)
+	}
+	scan := &scanningReader{scanner: scanner, upload: upload, source: upload.Data, connection: connection}
+	if err = scan.write([]byte(instreamCommand)); err != nil {
+		scan.closeConnection()
+		return scanner.unavailable(err)
+	}
+	upload.Data = scan
+	return nil
+}
+
+// unavailable returns the error of the PreStore method if clamd is unavailable because of the given error. Depending
+// on the FailOpen policy, the upload is either rejected or accepted without being scanned.
+func (scanner *Scanner) unavailable(err error) error {
+	if scanner.FailOpen {
+		log.Printf("The upload is accepted without being scanned because clamd is unavailable, %T: %v\n", err, err)
+		return nil
+	}
+	log.Printf("The upload is rejected because clamd is unavailable, %T: %v\n", err, err)
+	return router.Reject(http.StatusServiceUnavailable, "the virus scanner is unavailable")
+}
+
+// scanningReader reads the data of an upload and sends it to clamd at the same time. Once the data was read
+// completely, the upload is rejected or quarantined if clamd found a virus.
+type scanningReader struct {
+	scanner *Scanner
+	upload  *router.Upload
+	source  io.Reader
+	// connection is nil once the scan is finished or clamd became unavailable.
+	connection net.Conn
+}
+
+// Read reads the data of the upload and scans it.
+func (scan *scanningReader) Read(p []byte) (int, error) {
+	n, err := scan.source.Read(p)
+	if scan.connection == nil {
+		return n, err
+	}
+	if n > 0 {
+		// every chunk is preceded by its length
+		chunk := make([]byte, 4, 4+n)
+		binary.BigEndian.PutUint32(chunk, uint32(n))
+		if writeErr := scan.write(append(chunk, p[:n]...)); writeErr != nil {
+			scan.closeConnection()
+			if rejection := scan.scanner.unavailable(writeErr); rejection != nil {
+				return 0, rejection
+			}
+			return n, err
+		}
+	}
+	if err != io.EOF {
+		return n, err
+	}
+	signature, scanErr := scan.finish()
+	scan.closeConnection()
+	if scanErr != nil {
+		if rejection := scan.scanner.unavailable(scanErr); rejection != nil {
+			return 0, rejection
+		}
+	} else if signature != "" && scan.scanner.Quarantine {
+		scan.upload.QuarantineReason = fmt.Sprintf("it contains the virus %s", signature)
+	} else if signature != "" {
+		log.Printf("Rejected the upload %s because it contains the virus %s\n", scan.upload.Entry.Filename, signature)
+		return 0, router.Reject(http.StatusForbidden, fmt.Sprintf("the upload contains the virus %s", signature))
+	}
+	return n, err
+}
+
+// finish ends the stream and returns the name of the found virus or an empty string if the data is clean.
+func (scan *scanningReader) finish() (string, error) {
+	// the stream is ended by a chunk without data
+	if err := scan.write(make([]byte, 4)); err != nil {
+		return "", err
+	}
+	if scan.scanner.Timeout > 0 {
+		scan.connection.SetReadDeadline(time.Now().Add(scan.scanner.Timeout))
+	}
+	reply, err := bufio.NewReader(io.LimitReader(scan.connection, maximumReplyLength)).ReadString(0)
+	if err != nil {
+		return "", err
+	}
+	reply = strings.TrimSuffix(reply, "\x00")
+	switch {
+	case reply == streamPrefix+cleanSuffix:
+		return "", nil
+	case strings.HasPrefix(reply, streamPrefix) && strings.HasSuffix(reply, foundSuffix):
+		return strings.TrimSuffix(strings.TrimPrefix(reply, streamPrefix), foundSuffix), nil
+	default:
+		return "", fmt.Errorf("clamd replied %q", reply)
+	}
+}
+
+// write writes the given data to clamd.
+func (scan *scanningReader) write(data []byte) error {
+	if scan.scanner.Timeout > 0 {
+		scan.connection.SetWriteDeadline(time.Now().Add(scan.scanner.Timeout))
+	}
+	_, err := scan.connection.Write(data)
+	return err
+}
+
+// closeConnection closes the connection to clamd if it is still open.
+func (scan *scanningReader) closeConnection() {
+	if scan.connection == nil {
+		return
+	}
+	if err := scan.connection.Close(); err != nil {
+		log.Printf("There was an error while closing the connection to clamd, %T: %v\n", err, err)
+	}
+	scan.connection = nil
+}
+
+// Close closes the connection to clamd if the scan was not finished and the source if it is an io.Closer.
+func (scan *scanningReader) Close() error {
+	scan.closeConnection()
+	if closer, ok := scan.source.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
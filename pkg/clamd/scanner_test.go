@@ -0,0 +1,126 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/mmichaelb/sharexserver/pkg/router"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSignature is found by the fake clamd within the data of an upload.
+const testSignature = "EICAR-STANDARD-ANTIVIRUS-TEST-FILE"
+
+// startFakeClamd starts a listener which speaks the INSTREAM protocol of clamd and reports the testSignature. It
+// returns the address of the listener.
+func startFakeClamd(t *testing.T) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not start fake clamd, %T: %v", err, err)
+	}
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeClamd(connection)
+		}
+	}()
+	return listener.Addr().String(), func() {
+		listener.Close()
+	}
+}
+
+// serveFakeClamd scans a single stream which is sent via the given connection.
+func serveFakeClamd(connection net.Conn) {
+	defer connection.Close()
+	reader := bufio.NewReader(connection)
+	if command, err := reader.ReadString(0); err != nil || command != instreamCommand {
+		connection.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+	data := &bytes.Buffer{}
+	for {
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return
+		}
+		if length == 0 {
+			break
+		}
+		if _, err := io.CopyN(data, reader, int64(length)); err != nil {
+			return
+		}
+	}
+	if bytes.Contains(data.Bytes(), []byte(testSignature)) {
+		connection.Write([]byte(streamPrefix + "Eicar-Signature" + foundSuffix + "\x00"))
+	} else {
+		connection.Write([]byte(streamPrefix + cleanSuffix + "\x00"))
+	}
+}
+
+// scanUpload runs the given scanner for an upload with the given data and reads the data like the router.
+func scanUpload(t *testing.T, scanner *Scanner, data string) (*router.Upload, error) {
+	upload := &router.Upload{
+		Entry: &storage.Entry{Filename: "upload.txt"},
+		// the data is read in small parts to send multiple chunks
+		Data: bufio.NewReaderSize(strings.NewReader(data), 16),
+	}
+	if err := scanner.PreStore(context.Background(), upload); err != nil {
+		return upload, err
+	}
+	scannedData, err := ioutil.ReadAll(upload.Data)
+	if err == nil && string(scannedData) != data {
+		t.Fatalf("The scanner changed the data %q to %q", data, scannedData)
+	}
+	if closer, ok := upload.Data.(io.Closer); ok {
+		closer.Close()
+	}
+	return upload, err
+}
+
+// expectRejection checks whether the given error rejects the upload with the given status code.
+func expectRejection(t *testing.T, err error, statusCode int) {
+	if rejection, ok := err.(*router.Rejection); !ok || rejection.StatusCode != statusCode {
+		t.Fatalf("The upload was not rejected with status %d: %v", statusCode, err)
+	}
+}
+
+func TestScanner(t *testing.T) {
+	address, stop := startFakeClamd(t)
+	defer stop()
+	scanner := &Scanner{Network: "tcp", Address: address, Timeout: time.Second}
+	infectedData := "some harmless text with the signature " + testSignature + " in the middle of it"
+	if upload, err := scanUpload(t, scanner, "some harmless text which is longer than a single chunk"); err != nil ||
+		upload.QuarantineReason != "" {
+		t.Fatalf("A clean upload was not accepted, %v %q", err, upload.QuarantineReason)
+	}
+	_, err := scanUpload(t, scanner, infectedData)
+	expectRejection(t, err, http.StatusForbidden)
+	scanner.Quarantine = true
+	upload, err := scanUpload(t, scanner, infectedData)
+	if err != nil || upload.QuarantineReason != "it contains the virus Eicar-Signature" {
+		t.Fatalf("An infected upload was not quarantined, %v %q", err, upload.QuarantineReason)
+	}
+}
+
+func TestScannerUnavailable(t *testing.T) {
+	address, stop := startFakeClamd(t)
+	stop()
+	scanner := &Scanner{Network: "tcp", Address: address, Timeout: time.Second}
+	_, err := scanUpload(t, scanner, testSignature)
+	expectRejection(t, err, http.StatusServiceUnavailable)
+	scanner.FailOpen = true
+	if _, err := scanUpload(t, scanner, testSignature); err != nil {
+		t.Fatalf("The upload was not accepted although the scanner fails open, %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"crypto/subtle"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"net/http"
+	"strings"
+)
+
+const (
+	authorizationHeader = "Authorization"
+	bearerPrefix        = "Bearer "
+)
+
+// requestToken returns the access token which was sent by the client within the authorization header. It returns an
+// empty string if no token was sent.
+func requestToken(request *http.Request) string {
+	authorization := request.Header.Get(authorizationHeader)
+	if !strings.HasPrefix(authorization, bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(authorization, bearerPrefix))
+}
+
+// authenticate resolves the access token which was sent by the client. It returns storage.ErrTokenNotFound if no or
+// an invalid token was sent or an unwrapped error if something goes wrong.
+func (shareXRouter *ShareXRouter) authenticate(request *http.Request) (*storage.Token, error) {
+	secret := requestToken(request)
+	if secret == "" || shareXRouter.Tokens == nil {
+		return nil, storage.ErrTokenNotFound
+	}
+	return shareXRouter.Tokens.ResolveToken(storage.HashToken(secret))
+}
+
+// isAdmin checks whether the client sent the admin token. It always returns false if no admin token is set.
+func (shareXRouter *ShareXRouter) isAdmin(request *http.Request) bool {
+	if shareXRouter.AdminToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(requestToken(request)), []byte(shareXRouter.AdminToken)) == 1
+}
+
+// sendUnauthorized sends a response which asks the client to authenticate with a bearer token.
+func sendUnauthorized(writer http.ResponseWriter) {
+	writer.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(writer, "401 the client has to authenticate", http.StatusUnauthorized)
+}
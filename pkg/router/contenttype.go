@@ -0,0 +1,80 @@
+package router
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sniffLength is the amount of bytes which is used to detect the content type of an upload (see
+// http.DetectContentType).
+const sniffLength = 512
+
+// sniffContentType detects the content type of the data which is read by the given reader without consuming it.
+func sniffContentType(reader *bufio.Reader) (string, error) {
+	data, err := reader.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(data), nil
+}
+
+// isAllowedUpload checks whether a file with the given detected content type and filename may be uploaded according
+// to the allow and deny lists of the router.
+func (shareXRouter *ShareXRouter) isAllowedUpload(contentType, filename string) bool {
+	return shareXRouter.isAllowedContentType(contentType) && shareXRouter.isAllowedExtension(filename)
+}
+
+// isAllowedContentType checks whether the given content type is allowed and not denied.
+func (shareXRouter *ShareXRouter) isAllowedContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	if matchesContentType(shareXRouter.DeniedContentTypes, mediaType) {
+		return false
+	}
+	return len(shareXRouter.AllowedContentTypes) == 0 ||
+		matchesContentType(shareXRouter.AllowedContentTypes, mediaType)
+}
+
+// isAllowedExtension checks whether the extension of the given filename is allowed and not denied.
+func (shareXRouter *ShareXRouter) isAllowedExtension(filename string) bool {
+	extension := strings.ToLower(path.Ext(filename))
+	if matchesExtension(shareXRouter.DeniedExtensions, extension) {
+		return false
+	}
+	return len(shareXRouter.AllowedExtensions) == 0 || matchesExtension(shareXRouter.AllowedExtensions, extension)
+}
+
+// matchesContentType checks whether the given media type matches one of the given patterns. A pattern is either a
+// media type like "image/png" or matches all subtypes of a type like "image/*".
+func matchesContentType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/*") {
+			if strings.HasPrefix(mediaType, strings.ToLower(strings.TrimSuffix(pattern, "*"))) {
+				return true
+			}
+		} else if strings.EqualFold(pattern, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesExtension checks whether the given lower case extension matches one of the given extensions. The extensions
+// may be given with or without the leading dot.
+func matchesExtension(extensions []string, extension string) bool {
+	for _, listedExtension := range extensions {
+		if !strings.HasPrefix(listedExtension, ".") {
+			listedExtension = "." + listedExtension
+		}
+		if strings.EqualFold(listedExtension, extension) {
+			return true
+		}
+	}
+	return false
+}
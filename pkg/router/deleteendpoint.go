@@ -0,0 +1,47 @@
+package router
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const deletionTokenVar = "deletiontoken"
+
+// handleDelete is the endpoint which handles deletion requests of entries. It uses the vars with the keys stored in
+// callReferenceVar and deletionTokenVar to resolve the entry and to check whether the client is allowed to delete it.
+// GET requests are accepted as well because the ShareX client opens the deletion URL in the browser.
+func (shareXRouter *ShareXRouter) handleDelete(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	callReference, deletionToken := vars[callReferenceVar], vars[deletionTokenVar]
+	// resolve the remote entry and check if it could be found
+	entry, err := shareXRouter.Storage.Request(callReference)
+	if err == storage.ErrEntryNotFound {
+		http.NotFound(writer, request)
+		return
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, fmt.Sprintf("requesting entry with call reference %v",
+			strconv.Quote(callReference)), err)
+		return
+	}
+	if !entry.VerifyDeletionToken(deletionToken) {
+		http.Error(writer, "403 the deletion token is invalid", http.StatusForbidden)
+		return
+	}
+	if err = shareXRouter.Storage.Delete(callReference); err == storage.ErrEntryNotFound {
+		// the entry was deleted in the meantime
+		http.NotFound(writer, request)
+		return
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, fmt.Sprintf("deleting entry with call reference %v",
+			strconv.Quote(callReference)), err)
+		return
+	}
+	log.Printf("Deleted entry %v\n", entry.ID)
+	shareXRouter.runDeleteHooks(request, entry)
+	writer.WriteHeader(http.StatusOK)
+	writer.Write([]byte("the entry has been deleted"))
+}
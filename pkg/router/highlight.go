@@ -0,0 +1,344 @@
+package router
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind is the kind of a highlighted token which decides its color.
+type tokenKind int
+
+const (
+	tokenText tokenKind = iota
+	tokenComment
+	tokenString
+	tokenNumber
+	tokenKeyword
+)
+
+// Class returns the CSS class of the token kind which is used within the paste view.
+func (kind tokenKind) Class() string {
+	switch kind {
+	case tokenComment:
+		return "comment"
+	case tokenString:
+		return "string"
+	case tokenNumber:
+		return "number"
+	case tokenKeyword:
+		return "keyword"
+	default:
+		return ""
+	}
+}
+
+// token is a piece of highlighted text. It never contains a line break.
+type token struct {
+	Kind tokenKind
+	Text string
+}
+
+// language describes the syntax of a programming language which is needed to highlight it.
+type language struct {
+	name       string
+	extensions []string
+	// shebangs are the interpreters which identify a script of the language, e.g. "python" for "#!/usr/bin/python3".
+	shebangs      []string
+	lineComments  []string
+	blockComments [][2]string
+	// stringDelimiters contains the characters which start and end a string. Strings delimited by "`" may span
+	// multiple lines.
+	stringDelimiters string
+	keywords         map[string]bool
+}
+
+// keywordSet returns a set of the given space separated keywords.
+func keywordSet(keywords string) map[string]bool {
+	set := make(map[string]bool)
+	for _, keyword := range strings.Fields(keywords) {
+		set[keyword] = true
+	}
+	return set
+}
+
+// languages contains all languages which can be highlighted.
+var languages = []*language{
+	{
+		name:             "go",
+		extensions:       []string{".go"},
+		lineComments:     []string{"//"},
+		blockComments:    [][2]string{{"/*", "*/"}},
+		stringDelimiters: "\"'`",
+		keywords: keywordSet("break case chan const continue default defer else fallthrough for func go goto if " +
+			"import interface map package range return select struct switch type var nil true false"),
+	},
+	{
+		name:             "python",
+		extensions:       []string{".py"},
+		shebangs:         []string{"python"},
+		lineComments:     []string{"#"},
+		stringDelimiters: "\"'",
+		keywords: keywordSet("and as assert async await break class continue def del elif else except finally for " +
+			"from global if import in is lambda nonlocal not or pass raise return try while with yield None True " +
+			"False self"),
+	},
+	{
+		name:             "javascript",
+		extensions:       []string{".js", ".mjs", ".ts", ".jsx", ".tsx"},
+		shebangs:         []string{"node", "deno"},
+		lineComments:     []string{"//"},
+		blockComments:    [][2]string{{"/*", "*/"}},
+		stringDelimiters: "\"'`",
+		keywords: keywordSet("async await break case catch class const continue default delete do else export " +
+			"extends finally for function if import in instanceof let new of return switch this throw try typeof " +
+			"var void while yield null undefined true false"),
+	},
+	{
+		name:             "java",
+		extensions:       []string{".java", ".kt", ".cs"},
+		lineComments:     []string{"//"},
+		blockComments:    [][2]string{{"/*", "*/"}},
+		stringDelimiters: "\"'",
+		keywords: keywordSet("abstract boolean break case catch class continue default do double else enum " +
+			"extends final finally float for if implements import instanceof int interface long new package " +
+			"private protected public return static super switch this throw throws try void while null true false"),
+	},
+	{
+		name:             "c",
+		extensions:       []string{".c", ".h", ".cpp", ".hpp", ".cc"},
+		lineComments:     []string{"//"},
+		blockComments:    [][2]string{{"/*", "*/"}},
+		stringDelimiters: "\"'",
+		keywords: keywordSet("auto break case char const continue default do double else enum extern float for " +
+			"goto if include define int long register return short signed sizeof static struct switch typedef " +
+			"union unsigned void volatile while class namespace template typename using NULL nullptr"),
+	},
+	{
+		name:             "rust",
+		extensions:       []string{".rs"},
+		lineComments:     []string{"//"},
+		blockComments:    [][2]string{{"/*", "*/"}},
+		stringDelimiters: "\"",
+		keywords: keywordSet("as break const continue crate else enum extern false fn for if impl in let loop " +
+			"match mod move mut pub ref return self Self static struct super trait true type unsafe use where while"),
+	},
+	{
+		name:             "shell",
+		extensions:       []string{".sh", ".bash", ".zsh"},
+		shebangs:         []string{"sh", "bash", "zsh"},
+		lineComments:     []string{"#"},
+		stringDelimiters: "\"'",
+		keywords: keywordSet("if then else elif fi case esac for while until do done in function return local " +
+			"export echo exit"),
+	},
+	{
+		name:             "sql",
+		extensions:       []string{".sql"},
+		lineComments:     []string{"--"},
+		blockComments:    [][2]string{{"/*", "*/"}},
+		stringDelimiters: "'\"",
+		keywords: keywordSet("SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER " +
+			"JOIN LEFT RIGHT INNER OUTER ON AND OR NOT NULL ORDER BY GROUP HAVING LIMIT AS PRIMARY KEY select from " +
+			"where insert into values update set delete create table drop alter join on and or not null order by " +
+			"group having limit as"),
+	},
+	{
+		name:             "json",
+		extensions:       []string{".json"},
+		stringDelimiters: "\"",
+		keywords:         keywordSet("true false null"),
+	},
+}
+
+// languageByName returns the language with the given name or nil if it is unknown.
+func languageByName(name string) *language {
+	for _, lang := range languages {
+		if strings.EqualFold(lang.name, name) {
+			return lang
+		}
+	}
+	return nil
+}
+
+// detectLanguage detects the language of the given text by the extension of its filename, its shebang or the
+// keywords it contains. It returns nil if the language could not be detected.
+func detectLanguage(filename, text string) *language {
+	extension := strings.ToLower(path.Ext(filename))
+	for _, lang := range languages {
+		for _, languageExtension := range lang.extensions {
+			if extension == languageExtension {
+				return lang
+			}
+		}
+	}
+	if strings.HasPrefix(text, "#!") {
+		interpreter := strings.Fields(strings.SplitN(text[2:], "\n", 2)[0])
+		if len(interpreter) > 0 {
+			name := path.Base(interpreter[0])
+			if name == "env" && len(interpreter) > 1 {
+				name = interpreter[1]
+			}
+			for _, lang := range languages {
+				for _, shebang := range lang.shebangs {
+					if strings.HasPrefix(name, shebang) {
+						return lang
+					}
+				}
+			}
+		}
+	}
+	trimmedText := strings.TrimSpace(text)
+	if (strings.HasPrefix(trimmedText, "{") || strings.HasPrefix(trimmedText, "[")) && json.Valid([]byte(text)) {
+		return languageByName("json")
+	}
+	// the language whose keywords occur most often wins
+	var detectedLanguage *language
+	var maximumScore int
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !isIdentifierRune(r)
+	})
+	for _, lang := range languages {
+		var score int
+		for _, word := range words {
+			if lang.keywords[word] {
+				score++
+			}
+		}
+		if score > maximumScore {
+			detectedLanguage, maximumScore = lang, score
+		}
+	}
+	// a few keywords also occur in prose
+	if maximumScore < 3 {
+		return nil
+	}
+	return detectedLanguage
+}
+
+// isIdentifierRune checks whether the given rune can be part of an identifier.
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// highlight splits the given text into lines of highlighted tokens. The text is not highlighted if the language is
+// nil.
+func highlight(lang *language, text string) [][]token {
+	var tokens []token
+	if lang == nil {
+		tokens = []token{{Kind: tokenText, Text: text}}
+	} else {
+		tokens = lang.tokenize(text)
+	}
+	lines := [][]token{nil}
+	for _, current := range tokens {
+		parts := strings.Split(current.Text, "\n")
+		for i, part := range parts {
+			if i > 0 {
+				lines = append(lines, nil)
+			}
+			if part != "" {
+				lines[len(lines)-1] = append(lines[len(lines)-1], token{Kind: current.Kind, Text: part})
+			}
+		}
+	}
+	// a trailing line break does not start another line
+	if len(lines) > 1 && lines[len(lines)-1] == nil {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// tokenize splits the given text into tokens of the language.
+func (lang *language) tokenize(text string) []token {
+	var tokens []token
+	// textStart is the start of the plain text which precedes the current token
+	textStart := 0
+	addToken := func(kind tokenKind, start, end int) {
+		if textStart < start {
+			tokens = append(tokens, token{Kind: tokenText, Text: text[textStart:start]})
+		}
+		tokens = append(tokens, token{Kind: kind, Text: text[start:end]})
+		textStart = end
+	}
+	for i := 0; i < len(text); {
+		if end := lang.commentEnd(text, i); end > i {
+			addToken(tokenComment, i, end)
+			i = end
+			continue
+		}
+		if strings.IndexByte(lang.stringDelimiters, text[i]) >= 0 {
+			end := stringEnd(text, i)
+			addToken(tokenString, i, end)
+			i = end
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !isIdentifierRune(r) {
+			i += size
+			continue
+		}
+		end := i + size
+		for end < len(text) {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			// numbers may contain dots like "1.5"
+			if !isIdentifierRune(r) && !(r == '.' && unicode.IsDigit(rune(text[i]))) {
+				break
+			}
+			end += size
+		}
+		if unicode.IsDigit(r) {
+			addToken(tokenNumber, i, end)
+		} else if lang.keywords[text[i:end]] {
+			addToken(tokenKeyword, i, end)
+		}
+		i = end
+	}
+	if textStart < len(text) {
+		tokens = append(tokens, token{Kind: tokenText, Text: text[textStart:]})
+	}
+	return tokens
+}
+
+// commentEnd returns the end of the comment which starts at the given index of the text. It returns the index itself
+// if no comment starts there.
+func (lang *language) commentEnd(text string, start int) int {
+	for _, lineComment := range lang.lineComments {
+		if strings.HasPrefix(text[start:], lineComment) {
+			if end := strings.IndexByte(text[start:], '\n'); end >= 0 {
+				return start + end
+			}
+			return len(text)
+		}
+	}
+	for _, blockComment := range lang.blockComments {
+		if strings.HasPrefix(text[start:], blockComment[0]) {
+			contentStart := start + len(blockComment[0])
+			if end := strings.Index(text[contentStart:], blockComment[1]); end >= 0 {
+				return contentStart + end + len(blockComment[1])
+			}
+			return len(text)
+		}
+	}
+	return start
+}
+
+// stringEnd returns the end of the string which starts with a delimiter at the given index of the text. Unterminated
+// strings end at the end of the line unless they are delimited by "`".
+func stringEnd(text string, start int) int {
+	delimiter := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && delimiter != '`':
+			// skip the escaped character
+			i++
+		case text[i] == delimiter:
+			return i + 1
+		case text[i] == '\n' && delimiter != '`':
+			return i
+		}
+	}
+	return len(text)
+}
@@ -0,0 +1,44 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	testCases := []struct {
+		filename, text, language string
+	}{
+		{"main.go", "anything", "go"},
+		{"script", "#!/usr/bin/env python3\nprint('hello')", "python"},
+		{"script", "#!/bin/bash\necho hello", "shell"},
+		{"data", `{"key": [1, 2, 3]}`, "json"},
+		{"paste.txt", "package main\n\nfunc main() {\n\tfor range make(chan struct{}) {\n\t}\n}", "go"},
+		{"paste.txt", "Hello, this is just a sentence.", ""},
+	}
+	for _, testCase := range testCases {
+		var name string
+		if lang := detectLanguage(testCase.filename, testCase.text); lang != nil {
+			name = lang.name
+		}
+		if name != testCase.language {
+			t.Errorf("Detected language %q of %q, expected %q", name, testCase.filename, testCase.language)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	lines := highlight(languageByName("go"), "x := 42 // answer\n/* a\nb */ return \"s\\\"\"\n")
+	expectedLines := [][]token{
+		{{tokenText, "x := "}, {tokenNumber, "42"}, {tokenText, " "}, {tokenComment, "// answer"}},
+		{{tokenComment, "/* a"}},
+		{{tokenComment, "b */"}, {tokenText, " "}, {tokenKeyword, "return"}, {tokenText, " "},
+			{tokenString, "\"s\\\"\""}},
+	}
+	if !reflect.DeepEqual(lines, expectedLines) {
+		t.Fatalf("Highlighted lines %+v do not match the expected ones %+v", lines, expectedLines)
+	}
+	if lines := highlight(nil, "plain\ntext"); len(lines) != 2 || lines[1][0].Text != "text" {
+		t.Fatalf("Plain text was split into the lines %+v", lines)
+	}
+}
@@ -0,0 +1,241 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Upload is a new entry which is passed to the hooks of the ShareXRouter. Every upload, paste, shortened URL and
+// completed resumable upload runs through the hooks.
+type Upload struct {
+	// Request is the request which completes the upload.
+	Request *http.Request
+	// Entry is the new entry. Pre-store hooks may change its metadata like the Filename or the ExpiryDate. Its ID and
+	// CallReference are only set for post-store hooks.
+	Entry *storage.Entry
+	// Data reads the data of the entry while it is stored. Pre-store hooks may wrap or replace the reader to inspect or
+	// transform the data, but must not read it themselves. A wrapping reader can reject the upload by returning a
+	// *Rejection. If the reader implements io.Closer, it is closed once the data was stored or the upload failed, so
+	// wrapping readers should pass the call on. It is nil for post-store hooks.
+	Data io.Reader
+	// QuarantineReason can be set by pre-store hooks or their wrapping readers to quarantine the entry once its data
+	// was received, e.g. because it contains a virus. The entry is never activated: if the writer of the Storage does
+	// not implement the storage.QuarantiningWriter interface, the upload is aborted instead. In both cases the upload
+	// is rejected.
+	QuarantineReason string
+	// Size is the size of the stored data in bytes. It is only set for post-store hooks.
+	Size int64
+}
+
+// PreStoreHook is run before an upload is stored. It may inspect, transform or reject the upload.
+type PreStoreHook interface {
+	// PreStore is called with a context which is canceled once the HookTimeout is exceeded or the client is gone.
+	// Returning a *Rejection rejects the upload with its status code while other errors are sent as internal errors.
+	PreStore(ctx context.Context, upload *Upload) error
+}
+
+// PostStoreHook is run after an upload was stored and before the response is sent, e.g. to index the entry or to send
+// notifications. Long running work should be done in the background by the hook itself.
+type PostStoreHook interface {
+	// PostStore is called with a context which is canceled once the HookTimeout is exceeded or the client is gone.
+	// The entry is already stored, so returned errors are logged and do not fail the upload.
+	PostStore(ctx context.Context, upload *Upload) error
+}
+
+// DeleteHook is run after an entry was deleted via its deletion URL, e.g. to send notifications.
+type DeleteHook interface {
+	// Deleted is called with a context which is canceled once the HookTimeout is exceeded or the client is gone. The
+	// entry is already deleted, so returned errors are logged and do not fail the deletion.
+	Deleted(ctx context.Context, request *http.Request, entry *storage.Entry) error
+}
+
+// AccessHook is run when an entry is requested, before it is served. Requests of unfurlers which generate link
+// previews for chat applications are not passed to the hooks because they do not access the entry on behalf of a
+// person.
+type AccessHook interface {
+	// Accessed is called with a context which is canceled once the HookTimeout is exceeded or the client is gone.
+	// Returned errors are logged and do not fail the request. The hook is called for every request, so it should be
+	// fast.
+	Accessed(ctx context.Context, request *http.Request, entry *storage.Entry) error
+}
+
+// PreStoreHookFunc is an adapter to use an ordinary function as a PreStoreHook.
+type PreStoreHookFunc func(ctx context.Context, upload *Upload) error
+
+// PreStore calls the function itself.
+func (hook PreStoreHookFunc) PreStore(ctx context.Context, upload *Upload) error {
+	return hook(ctx, upload)
+}
+
+// PostStoreHookFunc is an adapter to use an ordinary function as a PostStoreHook.
+type PostStoreHookFunc func(ctx context.Context, upload *Upload) error
+
+// PostStore calls the function itself.
+func (hook PostStoreHookFunc) PostStore(ctx context.Context, upload *Upload) error {
+	return hook(ctx, upload)
+}
+
+// DeleteHookFunc is an adapter to use an ordinary function as a DeleteHook.
+type DeleteHookFunc func(ctx context.Context, request *http.Request, entry *storage.Entry) error
+
+// Deleted calls the function itself.
+func (hook DeleteHookFunc) Deleted(ctx context.Context, request *http.Request, entry *storage.Entry) error {
+	return hook(ctx, request, entry)
+}
+
+// AccessHookFunc is an adapter to use an ordinary function as an AccessHook.
+type AccessHookFunc func(ctx context.Context, request *http.Request, entry *storage.Entry) error
+
+// Accessed calls the function itself.
+func (hook AccessHookFunc) Accessed(ctx context.Context, request *http.Request, entry *storage.Entry) error {
+	return hook(ctx, request, entry)
+}
+
+// Rejection is an error which rejects an upload with a status code and a message which are sent to the client.
+type Rejection struct {
+	StatusCode int
+	Message    string
+}
+
+// Reject returns a *Rejection with the given status code and message.
+func Reject(statusCode int, message string) error {
+	return &Rejection{StatusCode: statusCode, Message: message}
+}
+
+// Error returns the message of the rejection.
+func (rejection *Rejection) Error() string {
+	return rejection.Message
+}
+
+// send sends the response which rejects the upload.
+func (rejection *Rejection) send(writer http.ResponseWriter) {
+	http.Error(writer, fmt.Sprintf("%d %s", rejection.StatusCode, rejection.Message), rejection.StatusCode)
+}
+
+// hookContext returns the context which is passed to a hook processing the given request.
+func (shareXRouter *ShareXRouter) hookContext(request *http.Request) (context.Context, context.CancelFunc) {
+	if shareXRouter.HookTimeout > 0 {
+		return context.WithTimeout(request.Context(), shareXRouter.HookTimeout)
+	}
+	return context.WithCancel(request.Context())
+}
+
+// storeUpload runs the pre-store hooks, stores the given upload and runs the post-store hooks. If the upload is
+// rejected or something goes wrong, an error response is sent and false is returned. A nil limit means that the size
+// of the data is unlimited.
+func (shareXRouter *ShareXRouter) storeUpload(writer http.ResponseWriter, upload *Upload, limit *uploadLimit) bool {
+	// the pre-store hooks may wrap the data into readers which hold resources (e.g. the connection to a virus
+	// scanner), so the data is closed however the upload ends
+	data := upload.Data
+	defer func() {
+		closeUploadData(data)
+	}()
+	for index, hook := range shareXRouter.PreStoreHooks {
+		ctx, cancel := shareXRouter.hookContext(upload.Request)
+		err := hook.PreStore(ctx, upload)
+		cancel()
+		data = upload.Data
+		if rejection, ok := err.(*Rejection); ok {
+			rejection.send(writer)
+			return false
+		} else if err == context.DeadlineExceeded {
+			log.Printf("The pre-store hook %d (%T) exceeded the timeout of %v\n", index, hook,
+				shareXRouter.HookTimeout)
+			http.Error(writer, "503 the upload could not be processed in time", http.StatusServiceUnavailable)
+			return false
+		} else if err != nil {
+			shareXRouter.sendInternalError(writer, fmt.Sprintf("running pre-store hook %d (%T)", index, hook), err)
+			return false
+		}
+	}
+	fileWriter, err := shareXRouter.Storage.Store(upload.Entry)
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "storing new entry", err)
+		return false
+	}
+	total, ok := shareXRouter.writeFile(writer, upload.Data, fileWriter, limit)
+	if !ok {
+		return false
+	}
+	// the quarantine is decided before the entry is activated by closing the writer
+	if upload.QuarantineReason != "" {
+		shareXRouter.quarantineUpload(writer, upload, fileWriter)
+		return false
+	}
+	if err := fileWriter.Close(); err != nil {
+		shareXRouter.sendInternalError(writer, "closing file writer of new entry", err)
+		return false
+	}
+	upload.Data, upload.Size = nil, total
+	for index, hook := range shareXRouter.PostStoreHooks {
+		ctx, cancel := shareXRouter.hookContext(upload.Request)
+		if err := hook.PostStore(ctx, upload); err != nil {
+			log.Printf("There was an error while running the post-store hook %d (%T) for entry %v, %T: %+v\n",
+				index, hook, upload.Entry.ID, err, err)
+		}
+		cancel()
+	}
+	return true
+}
+
+// closeUploadData closes the given data of an upload if it is closable.
+func closeUploadData(data io.Reader) {
+	if closer, isCloser := data.(io.Closer); isCloser {
+		if err := closer.Close(); err != nil {
+			log.Printf("There was an error while closing the data reader of an upload, %T: %+v\n", err, err)
+		}
+	}
+}
+
+// quarantineUpload closes the given writer of the upload so that the entry is quarantined or aborts it if the
+// storage does not support quarantines. The rejection of the upload is sent in both cases.
+func (shareXRouter *ShareXRouter) quarantineUpload(writer http.ResponseWriter, upload *Upload,
+	fileWriter io.WriteCloser) {
+	entry := upload.Entry
+	if quarantiningWriter, ok := fileWriter.(storage.QuarantiningWriter); ok {
+		if err := quarantiningWriter.CloseQuarantined(upload.QuarantineReason); err != nil {
+			shareXRouter.sendInternalError(writer, "quarantining new entry", err)
+			return
+		}
+		log.Printf("Quarantined entry %v: %s\n", entry.ID, upload.QuarantineReason)
+	} else {
+		if err := storage.Abort(fileWriter); err != nil {
+			shareXRouter.sendInternalError(writer, "aborting new entry instead of quarantining it", err)
+			return
+		}
+		log.Printf("Aborted entry %v instead of quarantining it: %s\n", entry.ID, upload.QuarantineReason)
+	}
+	http.Error(writer, "403 the upload was quarantined: "+upload.QuarantineReason, http.StatusForbidden)
+}
+
+// runDeleteHooks runs the delete hooks for the given entry which was deleted by the given request.
+func (shareXRouter *ShareXRouter) runDeleteHooks(request *http.Request, entry *storage.Entry) {
+	for index, hook := range shareXRouter.DeleteHooks {
+		ctx, cancel := shareXRouter.hookContext(request)
+		if err := hook.Deleted(ctx, request, entry); err != nil {
+			log.Printf("There was an error while running the delete hook %d (%T) for entry %v, %T: %+v\n",
+				index, hook, entry.ID, err, err)
+		}
+		cancel()
+	}
+}
+
+// runAccessHooks runs the access hooks for the given entry which is requested by the given request unless the client
+// is an unfurler.
+func (shareXRouter *ShareXRouter) runAccessHooks(request *http.Request, entry *storage.Entry) {
+	if len(shareXRouter.AccessHooks) == 0 || isUnfurler(request) {
+		return
+	}
+	for index, hook := range shareXRouter.AccessHooks {
+		ctx, cancel := shareXRouter.hookContext(request)
+		if err := hook.Accessed(ctx, request, entry); err != nil {
+			log.Printf("There was an error while running the access hook %d (%T) for entry %v, %T: %+v\n",
+				index, hook, entry.ID, err, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,263 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upperCaseReader converts the data of its source to upper case and rejects data containing "virus".
+type upperCaseReader struct {
+	source io.Reader
+}
+
+func (reader *upperCaseReader) Read(p []byte) (int, error) {
+	n, err := reader.source.Read(p)
+	if bytes.Contains(p[:n], []byte("virus")) {
+		return 0, Reject(http.StatusForbidden, "the upload contains a virus")
+	}
+	copy(p, bytes.ToUpper(p[:n]))
+	return n, err
+}
+
+func TestHooks(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	var calls []string
+	shareXRouter.PreStoreHooks = []PreStoreHook{
+		PreStoreHookFunc(func(ctx context.Context, upload *Upload) error {
+			calls = append(calls, "reject")
+			if upload.Entry.Filename == "rejected.txt" {
+				return Reject(http.StatusConflict, "the filename is reserved")
+			}
+			return nil
+		}),
+		PreStoreHookFunc(func(ctx context.Context, upload *Upload) error {
+			calls = append(calls, "transform")
+			upload.Entry.Filename = strings.ToUpper(upload.Entry.Filename)
+			upload.Data = &upperCaseReader{source: upload.Data}
+			return nil
+		}),
+	}
+	var storedUpload *Upload
+	shareXRouter.PostStoreHooks = []PostStoreHook{
+		PostStoreHookFunc(func(ctx context.Context, upload *Upload) error {
+			calls = append(calls, "store")
+			storedUpload = upload
+			return nil
+		}),
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newUploadRequest(t, "notes.txt", "text/plain", []byte("hello hooks")))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Upload failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if expectedCalls := []string{"reject", "transform", "store"}; !reflect.DeepEqual(calls, expectedCalls) {
+		t.Fatalf("The hooks were called in the order %v, expected %v", calls, expectedCalls)
+	}
+	if storedUpload == nil || storedUpload.Entry.CallReference != recorder.Body.String() || storedUpload.Size != 11 ||
+		storedUpload.Data != nil {
+		t.Fatalf("The post-store hook received the invalid upload %+v", storedUpload)
+	}
+	entry, err := shareXRouter.Storage.Request(recorder.Body.String())
+	if err != nil {
+		t.Fatalf("Could not request uploaded entry, %T: %v", err, err)
+	}
+	if err := entry.Reader.Open(); err != nil {
+		t.Fatalf("Could not open uploaded entry, %T: %v", err, err)
+	}
+	data, _ := ioutil.ReadAll(entry.Reader)
+	entry.Reader.Close()
+	if entry.Filename != "NOTES.TXT" || string(data) != "HELLO HOOKS" {
+		t.Fatalf("The entry %q with the data %q was not transformed by the hook", entry.Filename, data)
+	}
+	// rejections of the hooks and of the wrapped data are sent to the client
+	for filename, expectedStatus := range map[string]int{
+		"rejected.txt": http.StatusConflict,
+		"virus.txt":    http.StatusForbidden,
+	} {
+		calls = nil
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, newUploadRequest(t, filename, "text/plain", []byte("a "+filename)))
+		if recorder.Code != expectedStatus {
+			t.Fatalf("Upload of %s responded with status %d, expected %d", filename, recorder.Code, expectedStatus)
+		}
+		for _, call := range calls {
+			if call == "store" {
+				t.Fatalf("The post-store hook was called for the rejected upload %s", filename)
+			}
+		}
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	shareXRouter.HookTimeout = 10 * time.Millisecond
+	shareXRouter.PreStoreHooks = []PreStoreHook{
+		PreStoreHookFunc(func(ctx context.Context, upload *Upload) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newUploadRequest(t, "notes.txt", "text/plain", []byte("too slow")))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Upload with a timed out hook responded with status %d", recorder.Code)
+	}
+}
+
+// closeRecordingReader records whether it was closed.
+type closeRecordingReader struct {
+	io.Reader
+	closed bool
+}
+
+func (reader *closeRecordingReader) Close() error {
+	reader.closed = true
+	return nil
+}
+
+func TestHookDataClose(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	var data *closeRecordingReader
+	shareXRouter.PreStoreHooks = []PreStoreHook{
+		PreStoreHookFunc(func(ctx context.Context, upload *Upload) error {
+			data = &closeRecordingReader{Reader: upload.Data}
+			upload.Data = data
+			return nil
+		}),
+		PreStoreHookFunc(func(ctx context.Context, upload *Upload) error {
+			if upload.Entry.Filename == "rejected.txt" {
+				return Reject(http.StatusConflict, "the filename is reserved")
+			}
+			return nil
+		}),
+	}
+	// the data is closed whether the upload is stored or rejected by a following hook
+	for filename, expectedStatus := range map[string]int{
+		"notes.txt":    http.StatusOK,
+		"rejected.txt": http.StatusConflict,
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, newUploadRequest(t, filename, "text/plain", []byte("a "+filename)))
+		if recorder.Code != expectedStatus {
+			t.Fatalf("Upload of %s responded with status %d, expected %d", filename, recorder.Code, expectedStatus)
+		}
+		if data == nil || !data.closed {
+			t.Fatalf("The data of the upload %s was not closed", filename)
+		}
+	}
+}
+
+func TestHookQuarantine(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	var storedUpload *Upload
+	shareXRouter.PreStoreHooks = []PreStoreHook{
+		PreStoreHookFunc(func(ctx context.Context, upload *Upload) error {
+			storedUpload = upload
+			upload.QuarantineReason = "it looks suspicious"
+			return nil
+		}),
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newUploadRequest(t, "notes.txt", "text/plain", []byte("suspicious")))
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("Quarantined upload responded with status %d", recorder.Code)
+	}
+	// the file system storage does not support quarantines, so the entry is aborted
+	if _, err := shareXRouter.Storage.Request(storedUpload.Entry.CallReference); err != storage.ErrEntryNotFound {
+		t.Fatalf("Requesting the quarantined entry returned %v, expected %v", err, storage.ErrEntryNotFound)
+	}
+}
+
+// failingQuarantineStorage is a storage whose writers fail to quarantine their entries.
+type failingQuarantineStorage struct {
+	storage.FileStorage
+}
+
+func (failingStorage *failingQuarantineStorage) Store(entry *storage.Entry) (io.WriteCloser, error) {
+	fileWriter, err := failingStorage.FileStorage.Store(entry)
+	return &failingQuarantineWriter{fileWriter}, err
+}
+
+// failingQuarantineWriter aborts the entry like a storage would do it if its quarantine fails.
+type failingQuarantineWriter struct {
+	io.WriteCloser
+}
+
+func (writer *failingQuarantineWriter) CloseQuarantined(reason string) error {
+	storage.Abort(writer.WriteCloser)
+	return errors.New("the quarantine is full")
+}
+
+func TestHookQuarantineFailure(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	shareXRouter.Storage = &failingQuarantineStorage{shareXRouter.Storage}
+	var storedUpload *Upload
+	shareXRouter.PreStoreHooks = []PreStoreHook{
+		PreStoreHookFunc(func(ctx context.Context, upload *Upload) error {
+			storedUpload = upload
+			upload.QuarantineReason = "it looks suspicious"
+			return nil
+		}),
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newUploadRequest(t, "notes.txt", "text/plain", []byte("suspicious")))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("Upload with a failing quarantine responded with status %d", recorder.Code)
+	}
+	// the entry was never activated
+	if _, err := shareXRouter.Storage.Request(storedUpload.Entry.CallReference); err != storage.ErrEntryNotFound {
+		t.Fatalf("Requesting the entry whose quarantine failed returned %v, expected %v", err,
+			storage.ErrEntryNotFound)
+	}
+}
+
+func TestDeleteAndAccessHooks(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	var calls []string
+	shareXRouter.AccessHooks = []AccessHook{
+		AccessHookFunc(func(ctx context.Context, request *http.Request, entry *storage.Entry) error {
+			calls = append(calls, "access "+entry.Filename)
+			return nil
+		}),
+	}
+	shareXRouter.DeleteHooks = []DeleteHook{
+		DeleteHookFunc(func(ctx context.Context, request *http.Request, entry *storage.Entry) error {
+			calls = append(calls, "delete "+entry.Filename)
+			return nil
+		}),
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newUploadRequest(t, "notes.txt", "text/plain", []byte("hello hooks")))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Upload failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	callReference, deletionToken := recorder.Body.String(), recorder.Header().Get(deletionTokenHeader)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/raw/"+callReference, nil))
+	// unfurlers do not access the entry on behalf of a person
+	request := httptest.NewRequest(http.MethodGet, "/"+callReference, nil)
+	request.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/delete/"+callReference+"/invalid",
+		nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet,
+		"/delete/"+callReference+"/"+deletionToken, nil))
+	if expectedCalls := []string{"access notes.txt", "delete notes.txt"}; !reflect.DeepEqual(calls, expectedCalls) {
+		t.Fatalf("The hooks were called with %v, expected %v", calls, expectedCalls)
+	}
+}
@@ -0,0 +1,168 @@
+package router
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"mime"
+)
+
+// jpegQuality is the quality of images which are encoded as JPEG.
+const jpegQuality = 85
+
+// decodableImageTypes contains the content types of the images which can be decoded.
+var decodableImageTypes = map[string]bool{
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/png":  true,
+}
+
+// isDecodableImage checks whether an image with the given content type can be decoded.
+func isDecodableImage(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && decodableImageTypes[mediaType]
+}
+
+// decodeImageConfig decodes the dimensions of the image which is read by the given reader. Only the header of the
+// image is read.
+func decodeImageConfig(reader io.Reader) (image.Config, error) {
+	config, _, err := image.DecodeConfig(reader)
+	return config, err
+}
+
+// maximumImagePixels is the maximum amount of pixels of an image which is decoded, which is enough for 8K images. It
+// prevents that small files of huge images exhaust the memory.
+const maximumImagePixels = 32 << 20
+
+// errImageTooLarge is returned by decodeImage if the image has more than maximumImagePixels.
+var errImageTooLarge = errors.New("the image is too large to be decoded")
+
+// decodeImage decodes the image which is read by the given seekable reader after checking its dimensions.
+func decodeImage(reader io.ReadSeeker) (image.Image, error) {
+	config, err := decodeImageConfig(reader)
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > maximumImagePixels {
+		return nil, errImageTooLarge
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	decodedImage, _, err := image.Decode(reader)
+	return decodedImage, err
+}
+
+// fitDimensions returns the dimensions of an image with the given dimensions which is scaled down to fit into the
+// given bounds while keeping its aspect ratio. Images which already fit are not scaled.
+func fitDimensions(width, height, maximumWidth, maximumHeight int) (int, int) {
+	if width <= maximumWidth && height <= maximumHeight {
+		return width, height
+	}
+	if width*maximumHeight > height*maximumWidth {
+		return maximumWidth, maxInt(1, height*maximumWidth/width)
+	}
+	return maxInt(1, width*maximumHeight/height), maximumHeight
+}
+
+// maxInt returns the larger one of the given integers.
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// scaleImage scales the given image to the given dimensions. Every pixel of the scaled image is the average of the
+// pixels it covers within the source image, which avoids the aliasing of simpler methods when scaling down.
+func scaleImage(source image.Image, width, height int) *image.RGBA {
+	bounds := source.Bounds()
+	// the premultiplied alpha makes sure that transparent pixels do not tint their neighbours
+	sourceRGBA, ok := source.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		sourceRGBA = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(sourceRGBA, sourceRGBA.Bounds(), source, bounds.Min, draw.Src)
+	}
+	// the image is scaled horizontally first and vertically afterwards
+	horizontalWeights := scalingWeights(bounds.Dx(), width)
+	verticalWeights := scalingWeights(bounds.Dy(), height)
+	intermediate := make([]float32, width*bounds.Dy()*4)
+	for y := 0; y < bounds.Dy(); y++ {
+		row := sourceRGBA.Pix[y*sourceRGBA.Stride:]
+		for x, weights := range horizontalWeights {
+			pixel := intermediate[(y*width+x)*4:]
+			for _, weight := range weights {
+				for channel := 0; channel < 4; channel++ {
+					pixel[channel] += float32(row[weight.index*4+channel]) * weight.value
+				}
+			}
+		}
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, weights := range verticalWeights {
+		for x := 0; x < width; x++ {
+			var sum [4]float32
+			for _, weight := range weights {
+				pixel := intermediate[(weight.index*width+x)*4:]
+				for channel := 0; channel < 4; channel++ {
+					sum[channel] += pixel[channel] * weight.value
+				}
+			}
+			for channel := 0; channel < 4; channel++ {
+				scaled.Pix[y*scaled.Stride+x*4+channel] = uint8(math.Min(255, math.Max(0, float64(sum[channel])+0.5)))
+			}
+		}
+	}
+	return scaled
+}
+
+// scalingWeight is the share of a source pixel within a scaled pixel.
+type scalingWeight struct {
+	index int
+	value float32
+}
+
+// scalingWeights returns the weights of the source pixels for every scaled pixel when scaling one dimension from the
+// given source size to the given target size.
+func scalingWeights(sourceSize, targetSize int) [][]scalingWeight {
+	scale := float64(sourceSize) / float64(targetSize)
+	weights := make([][]scalingWeight, targetSize)
+	for i := range weights {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for index := int(start); index < sourceSize && float64(index) < end; index++ {
+			overlap := math.Min(end, float64(index+1)) - math.Max(start, float64(index))
+			if overlap > 0 {
+				weights[i] = append(weights[i], scalingWeight{index: index, value: float32(overlap / scale)})
+			}
+		}
+	}
+	return weights
+}
+
+// encodedContentType returns the content type of images encoded in the given format. It returns false if the format
+// is not supported.
+func encodedContentType(format string) (string, bool) {
+	switch format {
+	case "jpeg", "gif", "png":
+		return "image/" + format, true
+	default:
+		return "", false
+	}
+}
+
+// encodeImage encodes the given image in the given format which is either "jpeg", "gif" or "png".
+func encodeImage(writer io.Writer, encodedImage image.Image, format string) error {
+	switch format {
+	case "jpeg":
+		return jpeg.Encode(writer, encodedImage, &jpeg.Options{Quality: jpegQuality})
+	case "gif":
+		return gif.Encode(writer, encodedImage, nil)
+	default:
+		return png.Encode(writer, encodedImage)
+	}
+}
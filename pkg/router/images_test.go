@@ -0,0 +1,49 @@
+package router
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFitDimensions(t *testing.T) {
+	testCases := []struct {
+		width, height, maximumWidth, maximumHeight, expectedWidth, expectedHeight int
+	}{
+		{100, 50, 200, 200, 100, 50},
+		{400, 200, 100, 100, 100, 50},
+		{200, 400, 100, 100, 50, 100},
+		{1000, 1, 10, 10, 10, 1},
+	}
+	for _, testCase := range testCases {
+		width, height := fitDimensions(testCase.width, testCase.height, testCase.maximumWidth, testCase.maximumHeight)
+		if width != testCase.expectedWidth || height != testCase.expectedHeight {
+			t.Errorf("Fitting %dx%d into %dx%d returned %dx%d, expected %dx%d", testCase.width, testCase.height,
+				testCase.maximumWidth, testCase.maximumHeight, width, height, testCase.expectedWidth,
+				testCase.expectedHeight)
+		}
+	}
+}
+
+func TestScaleImage(t *testing.T) {
+	// a checkerboard becomes grey when it is scaled down
+	source := image.NewGray(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if (x+y)%2 == 0 {
+				source.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	scaled := scaleImage(source, 2, 2)
+	if scaled.Bounds().Dx() != 2 || scaled.Bounds().Dy() != 2 {
+		t.Fatalf("Scaled image has the bounds %v", scaled.Bounds())
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			if pixel := scaled.RGBAAt(x, y); pixel != (color.RGBA{R: 128, G: 128, B: 128, A: 255}) {
+				t.Fatalf("Scaled pixel %d,%d is %v, expected grey", x, y, pixel)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package router
+
+import (
+	"fmt"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"net/http"
+)
+
+// uploadLimit is the maximum amount of bytes an upload may consist of and the response which is sent if the upload
+// exceeds it.
+type uploadLimit struct {
+	bytes      int64
+	statusCode int
+	message    string
+}
+
+// send sends the response which rejects an upload exceeding the limit.
+func (limit *uploadLimit) send(writer http.ResponseWriter) {
+	http.Error(writer, fmt.Sprintf("%d %s", limit.statusCode, limit.message), limit.statusCode)
+}
+
+// checkUploadLimit checks the quota of the given uploader before a new entry is stored and returns the limit of the
+// upload size, which is nil if the size is unlimited. If the quota is exhausted or the given upload size exceeds the
+// limit, an error response is sent and false is returned. A negative upload size means that it is not known yet.
+// The check is best-effort: concurrent uploads of the same uploader are checked against the same usage, so together
+// they may exceed the quota slightly.
+func (shareXRouter *ShareXRouter) checkUploadLimit(writer http.ResponseWriter, uploader *storage.Token,
+	size int64) (*uploadLimit, bool) {
+	var limit *uploadLimit
+	if shareXRouter.MaximumUploadSize > 0 {
+		limit = &uploadLimit{
+			bytes:      shareXRouter.MaximumUploadSize,
+			statusCode: http.StatusRequestEntityTooLarge,
+			message:    fmt.Sprintf("the upload exceeds the maximum size of %d bytes", shareXRouter.MaximumUploadSize),
+		}
+	}
+	quota := uploader.Quota.Merge(shareXRouter.DefaultQuota)
+	if usageStorage, ok := shareXRouter.Storage.(storage.UsageStorage); ok && !quota.IsUnlimited() {
+		usage, err := usageStorage.Usage(uploader.Author)
+		if err != nil {
+			shareXRouter.sendInternalError(writer, "resolving storage usage of uploader", err)
+			return nil, false
+		}
+		if quota.Files > 0 && usage.Files >= quota.Files {
+			http.Error(writer, fmt.Sprintf("429 the quota of %d files is exhausted", quota.Files),
+				http.StatusTooManyRequests)
+			return nil, false
+		}
+		if quota.Bytes > 0 {
+			remainingBytes := quota.Bytes - usage.Bytes
+			if remainingBytes <= 0 {
+				http.Error(writer, fmt.Sprintf("429 the quota of %d bytes is exhausted", quota.Bytes),
+					http.StatusTooManyRequests)
+				return nil, false
+			}
+			if limit == nil || remainingBytes < limit.bytes {
+				limit = &uploadLimit{
+					bytes:      remainingBytes,
+					statusCode: http.StatusTooManyRequests,
+					message:    fmt.Sprintf("the upload exceeds the remaining quota of %d bytes", remainingBytes),
+				}
+			}
+		}
+	}
+	if limit != nil && size > limit.bytes {
+		limit.send(writer)
+		return nil, false
+	}
+	return limit, true
+}
@@ -0,0 +1,400 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+)
+
+const (
+	// removedMetadataHeader is the response header which contains the comma separated kinds of metadata which were
+	// removed from an uploaded image
+	removedMetadataHeader = "X-Removed-Metadata"
+	// the kinds of removed metadata
+	metadataEXIF     = "exif"
+	metadataXMP      = "xmp"
+	metadataIPTC     = "iptc"
+	metadataComment  = "comment"
+	metadataText     = "text"
+	metadataTrailing = "trailing-data"
+)
+
+// the JPEG markers which are handled by the metadataStripper
+const (
+	jpegTEM   = 0x01
+	jpegRST0  = 0xD0
+	jpegRST7  = 0xD7
+	jpegEOI   = 0xD9
+	jpegSOS   = 0xDA
+	jpegAPP1  = 0xE1
+	jpegAPP13 = 0xED
+	jpegCOM   = 0xFE
+)
+
+var (
+	// errMalformedImage is returned by the metadataStripper if the structure of the image could not be parsed.
+	errMalformedImage = Reject(http.StatusUnprocessableEntity,
+		"the image is malformed, so its metadata could not be removed")
+	// strippableContentTypes contains the content types of the images whose metadata can be removed.
+	strippableContentTypes = map[string]bool{
+		"image/jpeg": true,
+		"image/png":  true,
+	}
+	exifPrefix    = []byte("Exif\x00\x00")
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	pngXMPKeyword = []byte("XML:com.adobe.xmp\x00")
+)
+
+// stripsMetadata checks whether the metadata of an upload with the given detected content type is removed according
+// to the StripMetadataContentTypes.
+func (shareXRouter *ShareXRouter) stripsMetadata(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strippableContentTypes[mediaType] &&
+		matchesContentType(shareXRouter.StripMetadataContentTypes, mediaType)
+}
+
+// metadataStripper is a reader which removes the EXIF, XMP and text metadata of the JPEG or PNG image read by its
+// source. The image is not decoded, so everything else is kept as it is. Only the orientation of EXIF data is kept
+// because it decides how the image is displayed.
+type metadataStripper struct {
+	source *bufio.Reader
+	// next parses the next segment or chunk of the image.
+	next func() error
+	// pending contains the parsed bytes which are read before the source is read again.
+	pending []byte
+	// remaining is the amount of bytes of the current segment or chunk which are read from the source as they are.
+	remaining int64
+	// scanning is true while the entropy-coded data of a JPEG scan is read.
+	scanning bool
+	// done is true once the end of the image was reached. Data trailing the image is not read.
+	done    bool
+	removed []string
+	err     error
+}
+
+// newMetadataStripper returns a metadataStripper which reads the JPEG or PNG image with the given content type from
+// the given source.
+func newMetadataStripper(source *bufio.Reader, contentType string) *metadataStripper {
+	stripper := &metadataStripper{source: source}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "image/png" {
+		stripper.next = stripper.readPNGSignature
+	} else {
+		stripper.next = stripper.readJPEGSignature
+	}
+	return stripper
+}
+
+// removedMetadata returns the kinds of metadata which were removed from the image, e.g. "exif" or "xmp". It is only
+// complete after the image was read completely. A nil stripper did not remove anything.
+func (stripper *metadataStripper) removedMetadata() []string {
+	if stripper == nil {
+		return nil
+	}
+	return stripper.removed
+}
+
+// Read reads the image without its metadata. errMalformedImage is returned if the structure of the image could not be
+// parsed.
+func (stripper *metadataStripper) Read(p []byte) (int, error) {
+	for {
+		switch {
+		case stripper.err != nil:
+			return 0, stripper.err
+		case len(stripper.pending) > 0:
+			n := copy(p, stripper.pending)
+			stripper.pending = stripper.pending[n:]
+			return n, nil
+		case stripper.remaining > 0:
+			if int64(len(p)) > stripper.remaining {
+				p = p[:stripper.remaining]
+			}
+			n, err := stripper.source.Read(p)
+			stripper.remaining -= int64(n)
+			stripper.err = malformedOnEOF(err)
+			if n > 0 {
+				return n, nil
+			}
+		case stripper.done:
+			return 0, io.EOF
+		case stripper.scanning:
+			n, err := stripper.readScan(p)
+			stripper.err = err
+			if n > 0 {
+				return n, nil
+			}
+		default:
+			stripper.err = stripper.next()
+		}
+	}
+}
+
+// malformedOnEOF replaces io.EOF by errMalformedImage because the image ended too early. Other errors are caused by
+// the source, e.g. an interrupted upload.
+func malformedOnEOF(err error) error {
+	if err == io.EOF {
+		return errMalformedImage
+	}
+	return err
+}
+
+// readFull reads the given amount of bytes from the source.
+func (stripper *metadataStripper) readFull(length int) ([]byte, error) {
+	data := make([]byte, length)
+	// io.ReadFull is not used because it hides whether the source ended or failed
+	for read := 0; read < length; {
+		n, err := stripper.source.Read(data[read:])
+		read += n
+		if err != nil && read < length {
+			return nil, malformedOnEOF(err)
+		}
+	}
+	return data, nil
+}
+
+// discard skips the given amount of bytes of the source and adds the given kind of metadata to the removed ones.
+func (stripper *metadataStripper) discard(length int64, kind string) error {
+	for length > 0 {
+		n := length
+		if n > math.MaxInt32 {
+			n = math.MaxInt32
+		}
+		discarded, err := stripper.source.Discard(int(n))
+		if err != nil {
+			return malformedOnEOF(err)
+		}
+		length -= int64(discarded)
+	}
+	stripper.addRemoved(kind)
+	return nil
+}
+
+// addRemoved adds the given kind of metadata to the removed ones unless it is already contained.
+func (stripper *metadataStripper) addRemoved(kind string) {
+	for _, removed := range stripper.removed {
+		if removed == kind {
+			return
+		}
+	}
+	stripper.removed = append(stripper.removed, kind)
+}
+
+// finish marks the end of the image. Data trailing the image can contain metadata as well, so it is removed.
+func (stripper *metadataStripper) finish() {
+	stripper.done = true
+	if _, err := stripper.source.Peek(1); err == nil {
+		stripper.addRemoved(metadataTrailing)
+	}
+}
+
+// readJPEGSignature reads the start of image marker of a JPEG image.
+func (stripper *metadataStripper) readJPEGSignature() error {
+	signature, err := stripper.readFull(2)
+	if err != nil {
+		return err
+	}
+	if signature[0] != 0xFF || signature[1] != 0xD8 {
+		return errMalformedImage
+	}
+	stripper.pending = signature
+	stripper.next = stripper.nextJPEGSegment
+	return nil
+}
+
+// nextJPEGSegment parses the next segment of a JPEG image. APP1 (EXIF and XMP), APP13 (IPTC) and comment segments
+// are removed.
+func (stripper *metadataStripper) nextJPEGSegment() error {
+	marker, err := stripper.readFull(2)
+	if err != nil {
+		return err
+	}
+	if marker[0] != 0xFF {
+		return errMalformedImage
+	}
+	// markers may be preceded by any amount of fill bytes
+	for marker[1] == 0xFF {
+		if marker[1], err = stripper.source.ReadByte(); err != nil {
+			return malformedOnEOF(err)
+		}
+	}
+	switch {
+	case marker[1] == jpegEOI:
+		stripper.pending = marker
+		stripper.finish()
+		return nil
+	case marker[1] == jpegTEM || marker[1] >= jpegRST0 && marker[1] <= jpegRST7:
+		// these markers do not have a segment
+		stripper.pending = marker
+		return nil
+	}
+	lengthBytes, err := stripper.readFull(2)
+	if err != nil {
+		return err
+	}
+	// the length includes its own bytes
+	length := int(binary.BigEndian.Uint16(lengthBytes)) - 2
+	if length < 0 {
+		return errMalformedImage
+	}
+	switch marker[1] {
+	case jpegAPP1:
+		segment, err := stripper.readFull(length)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(segment, exifPrefix) {
+			stripper.addRemoved(metadataXMP)
+			return nil
+		}
+		if orientation := exifOrientation(segment[len(exifPrefix):]); orientation > 1 && orientation <= 8 {
+			stripper.pending = orientationSegment(orientation)
+		}
+		stripper.addRemoved(metadataEXIF)
+		return nil
+	case jpegAPP13:
+		return stripper.discard(int64(length), metadataIPTC)
+	case jpegCOM:
+		return stripper.discard(int64(length), metadataComment)
+	}
+	stripper.pending = append(marker, lengthBytes...)
+	stripper.remaining = int64(length)
+	// the entropy-coded data of the scan follows the header of the scan
+	stripper.scanning = marker[1] == jpegSOS
+	return nil
+}
+
+// readScan reads the entropy-coded data of a JPEG scan until the next marker is reached.
+func (stripper *metadataStripper) readScan(p []byte) (int, error) {
+	// every scan is followed by at least the end of image marker
+	next, err := stripper.source.Peek(2)
+	if err != nil {
+		return 0, malformedOnEOF(err)
+	}
+	if next[0] == 0xFF {
+		switch {
+		case next[1] == 0x00 || next[1] >= jpegRST0 && next[1] <= jpegRST7:
+			// stuffed bytes and restart markers are part of the entropy-coded data
+			if len(p) < 2 {
+				return stripper.source.Read(p)
+			}
+			return io.ReadFull(stripper.source, p[:2])
+		case next[1] == 0xFF:
+			// fill bytes are copied one by one until the following byte is known
+			return stripper.source.Read(p[:1])
+		}
+		stripper.scanning = false
+		return 0, nil
+	}
+	data, _ := stripper.source.Peek(stripper.source.Buffered())
+	if end := bytes.IndexByte(data, 0xFF); end >= 0 {
+		data = data[:end]
+	}
+	n := copy(p, data)
+	_, err = stripper.source.Discard(n)
+	return n, err
+}
+
+// exifOrientation returns the orientation of the given TIFF structure of EXIF data or zero if it does not contain
+// one.
+func exifOrientation(tiff []byte) uint16 {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int64(order.Uint32(tiff[4:]))
+	if offset+2 > int64(len(tiff)) {
+		return 0
+	}
+	count := int64(order.Uint16(tiff[offset:]))
+	for i := int64(0); i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > int64(len(tiff)) {
+			return 0
+		}
+		// the orientation tag has the type SHORT
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			return order.Uint16(tiff[entry+8:])
+		}
+	}
+	return 0
+}
+
+// orientationSegment returns a JPEG APP1 segment whose EXIF data only contains the given orientation.
+func orientationSegment(orientation uint16) []byte {
+	return []byte{
+		0xFF, jpegAPP1, 0, 34,
+		'E', 'x', 'i', 'f', 0, 0,
+		// big endian TIFF header with the first IFD at offset 8
+		'M', 'M', 0, 42, 0, 0, 0, 8,
+		// one entry with the tag 0x0112, the type SHORT, the count 1 and the value
+		0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, byte(orientation >> 8), byte(orientation), 0, 0,
+		// there is no next IFD
+		0, 0, 0, 0,
+	}
+}
+
+// readPNGSignature reads the signature of a PNG image.
+func (stripper *metadataStripper) readPNGSignature() error {
+	signature, err := stripper.readFull(len(pngSignature))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(signature, pngSignature) {
+		return errMalformedImage
+	}
+	stripper.pending = signature
+	stripper.next = stripper.nextPNGChunk
+	return nil
+}
+
+// nextPNGChunk parses the next chunk of a PNG image. The text chunks (including XMP which is stored as international
+// text) and EXIF chunks are removed.
+func (stripper *metadataStripper) nextPNGChunk() error {
+	header, err := stripper.readFull(8)
+	if err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length > math.MaxInt32 {
+		return errMalformedImage
+	}
+	// every chunk ends with its checksum
+	chunkLength := int64(length) + 4
+	switch chunkType := string(header[4:]); chunkType {
+	case "eXIf":
+		return stripper.discard(chunkLength, metadataEXIF)
+	case "tEXt", "zTXt":
+		return stripper.discard(chunkLength, metadataText)
+	case "iTXt":
+		keyword, _ := stripper.source.Peek(len(pngXMPKeyword))
+		if bytes.Equal(keyword, pngXMPKeyword) {
+			return stripper.discard(chunkLength, metadataXMP)
+		}
+		return stripper.discard(chunkLength, metadataText)
+	case "IEND":
+		if length != 0 {
+			return errMalformedImage
+		}
+		chunk, err := stripper.readFull(int(chunkLength))
+		if err != nil {
+			return err
+		}
+		stripper.pending = append(header, chunk...)
+		stripper.finish()
+		return nil
+	}
+	stripper.pending = header
+	stripper.remaining = chunkLength
+	return nil
+}
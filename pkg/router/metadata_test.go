@@ -0,0 +1,149 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// secretMetadata is contained within the metadata of the test images and must not be contained in the stripped ones.
+const secretMetadata = "GPS 52.5200 N 13.4050 E"
+
+// newTestPhoto returns a noisy JPEG image with EXIF (orientation 6), XMP and comment segments and trailing data.
+func newTestPhoto(t *testing.T) []byte {
+	photo := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	for i := range photo.Pix {
+		photo.Pix[i] = uint8(i * 7919 % 251)
+	}
+	buffer := &bytes.Buffer{}
+	if err := jpeg.Encode(buffer, photo, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("Could not encode test photo, %T: %v", err, err)
+	}
+	encoded := buffer.Bytes()
+	// little endian TIFF structure whose first IFD contains the orientation and an offset to the secret
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 1, 0, 0x12, 0x01, 3, 0, 1, 0, 0, 0, 6, 0, 0, 0, 0, 0, 0, 0}
+	tiff = append(tiff, secretMetadata...)
+	xmp := "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>" + secretMetadata + "</x:xmpmeta>"
+	exif := append(append([]byte{}, exifPrefix...), tiff...)
+	segments := append(newJPEGSegment(jpegAPP1, exif), newJPEGSegment(jpegAPP1, []byte(xmp))...)
+	segments = append(segments, newJPEGSegment(jpegCOM, []byte(secretMetadata))...)
+	photoData := append([]byte{}, encoded[:2]...)
+	photoData = append(photoData, segments...)
+	photoData = append(photoData, encoded[2:]...)
+	return append(photoData, secretMetadata...)
+}
+
+// newJPEGSegment returns a JPEG segment with the given marker and data.
+func newJPEGSegment(marker byte, data []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(data)+2))
+	return append(segment, data...)
+}
+
+// newPNGChunk returns a PNG chunk with the given type and data.
+func newPNGChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(append(chunk, chunkType...), data...)
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, checksum...)
+}
+
+// stripMetadata returns the given image without its metadata and the kinds of removed metadata.
+func stripMetadata(imageData []byte, contentType string) ([]byte, []string, error) {
+	stripper := newMetadataStripper(bufio.NewReaderSize(bytes.NewReader(imageData), sniffLength), contentType)
+	stripped, err := ioutil.ReadAll(stripper)
+	return stripped, stripper.removedMetadata(), err
+}
+
+func TestMetadataStripperJPEG(t *testing.T) {
+	stripped, removed, err := stripMetadata(newTestPhoto(t), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Could not strip metadata, %T: %v", err, err)
+	}
+	expected := []string{metadataEXIF, metadataXMP, metadataComment, metadataTrailing}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Fatalf("Removed the metadata %v, expected %v", removed, expected)
+	}
+	if bytes.Contains(stripped, []byte(secretMetadata)) {
+		t.Fatal("The stripped photo still contains the secret metadata")
+	}
+	if !bytes.Contains(stripped, orientationSegment(6)) {
+		t.Fatal("The stripped photo does not contain its orientation")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Fatalf("Could not decode stripped photo, %T: %v", err, err)
+	}
+	photo := newTestPhoto(t)
+	if _, _, err := stripMetadata(photo[:len(photo)/2], "image/jpeg"); err != errMalformedImage {
+		t.Fatalf("Stripping a truncated photo returned %v, expected %v", err, errMalformedImage)
+	}
+}
+
+func TestMetadataStripperPNG(t *testing.T) {
+	encoded := newTestImage(t, 4, 3)
+	// the chunks are inserted after the signature and the header chunk
+	headerEnd := len(pngSignature) + 25
+	imageData := append([]byte{}, encoded[:headerEnd]...)
+	imageData = append(imageData, newPNGChunk("tEXt", []byte("Comment\x00"+secretMetadata))...)
+	xmp := append(append([]byte{}, pngXMPKeyword...), "\x00\x00\x00"+secretMetadata...)
+	imageData = append(imageData, newPNGChunk("iTXt", xmp)...)
+	imageData = append(imageData, newPNGChunk("eXIf", []byte("MM\x00\x2a"+secretMetadata))...)
+	imageData = append(imageData, encoded[headerEnd:]...)
+	stripped, removed, err := stripMetadata(imageData, "image/png")
+	if err != nil {
+		t.Fatalf("Could not strip metadata, %T: %v", err, err)
+	}
+	if expected := []string{metadataText, metadataXMP, metadataEXIF}; !reflect.DeepEqual(removed, expected) {
+		t.Fatalf("Removed the metadata %v, expected %v", removed, expected)
+	}
+	if !bytes.Equal(stripped, encoded) {
+		t.Fatal("The stripped image differs from the image without metadata")
+	}
+}
+
+func TestUploadStripsMetadata(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	shareXRouter.StripMetadataContentTypes = []string{"image/jpeg"}
+	request := newUploadRequest(t, "photo.jpg", "image/jpeg", newTestPhoto(t))
+	request.Header.Set("Accept", "application/json")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Upload failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	response := &uploadResponse{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("Could not decode upload response, %T: %v", err, err)
+	}
+	expected := []string{metadataEXIF, metadataXMP, metadataComment, metadataTrailing}
+	if !reflect.DeepEqual(response.RemovedMetadata, expected) ||
+		recorder.Header().Get(removedMetadataHeader) != "exif,xmp,comment,trailing-data" {
+		t.Fatalf("The upload response reports the removed metadata %v and %q", response.RemovedMetadata,
+			recorder.Header().Get(removedMetadataHeader))
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/raw/"+response.CallReference, nil))
+	if bytes.Contains(recorder.Body.Bytes(), []byte(secretMetadata)) || int64(recorder.Body.Len()) != response.Size {
+		t.Fatal("The stored photo still contains the secret metadata")
+	}
+	// PNG images are not stripped because their content type is not configured
+	request = newUploadRequest(t, "image.png", "image/png", newTestImage(t, 4, 3))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorder.Header().Get(removedMetadataHeader) != "" {
+		t.Fatalf("Upload of an image without stripping responded with status %d and the removed metadata %q",
+			recorder.Code, recorder.Header().Get(removedMetadataHeader))
+	}
+}
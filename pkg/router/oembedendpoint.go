@@ -0,0 +1,76 @@
+package router
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// oEmbedVersion is the version of the oEmbed specification (see https://oembed.com/).
+const oEmbedVersion = "1.0"
+
+// oEmbedResponse is the JSON representation of an oEmbed response. Entries which are no decodable images are
+// described as links.
+type oEmbedResponse struct {
+	Version      string `json:"version"`
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	// URL, Width and Height are only set for photos.
+	URL    string `json:"url,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// handleOEmbed is the endpoint which describes the entry whose URL is sent within the query parameter "url" according
+// to the oEmbed specification. Only the JSON format is supported.
+func (shareXRouter *ShareXRouter) handleOEmbed(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if format := query.Get("format"); format != "" && format != "json" {
+		http.Error(writer, "501 only the json format is supported", http.StatusNotImplemented)
+		return
+	}
+	entryURL, err := url.Parse(query.Get("url"))
+	if err != nil || entryURL.Path == "" {
+		http.Error(writer, "400 the url of an entry has to be sent", http.StatusBadRequest)
+		return
+	}
+	entry, err := shareXRouter.Storage.Request(path.Base(entryURL.Path))
+	if err == storage.ErrEntryNotFound {
+		http.NotFound(writer, request)
+		return
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, "requesting entry of oEmbed", err)
+		return
+	}
+	baseURL := shareXRouter.publicURL(request)
+	response := &oEmbedResponse{
+		Version:      oEmbedVersion,
+		Type:         "link",
+		Title:        entry.Filename,
+		AuthorName:   string(entry.Author),
+		ProviderName: siteName,
+		ProviderURL:  baseURL + "/",
+	}
+	if entry.Kind != storage.KindRedirect && isDecodableImage(entry.ContentType) {
+		if err := entry.Reader.Open(); err != nil {
+			shareXRouter.sendInternalError(writer, "opening reader of oEmbed entry", err)
+			return
+		}
+		defer entry.Reader.Close()
+		// photos require their dimensions, so images which can not be decoded stay links
+		if config, err := decodeImageConfig(entry.Reader); err == nil {
+			response.Type = "photo"
+			response.URL = rawURL(baseURL, entry.CallReference)
+			response.Width, response.Height = config.Width, config.Height
+		} else {
+			log.Printf("There was an error while decoding the dimensions of the entry %v, %T: %+v\n", entry.ID,
+				err, err)
+		}
+	}
+	shareXRouter.sendJSON(writer, response)
+}
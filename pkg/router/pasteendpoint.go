@@ -0,0 +1,86 @@
+package router
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	// maximumPasteBytes is the maximum size of a paste. Larger text uploads are not shown within the paste view.
+	maximumPasteBytes = 1 << 20
+	// the form values of a paste
+	pasteTextParameter     = "text"
+	pasteFilenameParameter = "filename"
+	pasteLanguageParameter = "language"
+	// defaultPasteFilename is the filename of pastes which neither have a filename nor a language.
+	defaultPasteFilename = "paste.txt"
+	// pasteContentType is the content type of the stored pastes.
+	pasteContentType = "text/plain; charset=utf-8"
+)
+
+// handlePaste is the endpoint which stores text sent within the form value "text". The language used to highlight the
+// text is detected from the form value "filename" or chosen by the form value "language". The time-to-live can be sent
+// like it is done for file uploads and the response is the same as the one of a file upload.
+func (shareXRouter *ShareXRouter) handlePaste(writer http.ResponseWriter, request *http.Request) {
+	var err error
+	uploader, ok := shareXRouter.authenticateUploader(writer, request)
+	if !ok {
+		return
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, maximumPasteBytes+4*maximumFormValueBytes)
+	if err = request.ParseMultipartForm(receiveBufferSize); err != nil && err != http.ErrNotMultipart {
+		http.Error(writer, "400 the form is malformed or too large", http.StatusBadRequest)
+		return
+	}
+	text := request.FormValue(pasteTextParameter)
+	if text == "" || len(text) > maximumPasteBytes {
+		http.Error(writer, "400 the text has to be sent with a length of at most 1 MB", http.StatusBadRequest)
+		return
+	}
+	filename := request.FormValue(pasteFilenameParameter)
+	if rawLanguage := request.FormValue(pasteLanguageParameter); rawLanguage != "" {
+		lang := languageByName(rawLanguage)
+		if lang == nil {
+			http.Error(writer, "400 the language is unknown", http.StatusBadRequest)
+			return
+		}
+		// the language is remembered by the extension of the filename
+		if detectLanguage(filename, "") != lang {
+			filename = strings.TrimSuffix(filename, path.Ext(filename))
+			if filename == "" {
+				filename = "paste"
+			}
+			filename += lang.extensions[0]
+		}
+	} else if filename == "" {
+		filename = defaultPasteFilename
+	}
+	ttl := uploader.DefaultTTL
+	if rawTTL := request.FormValue(ttlParameter); rawTTL != "" {
+		if ttl, err = parseTTL(rawTTL); err != nil {
+			http.Error(writer, "400 "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit, ok := shareXRouter.checkUploadLimit(writer, uploader, int64(len(text)))
+	if !ok {
+		return
+	}
+	if !shareXRouter.isAllowedUpload(pasteContentType, filename) {
+		http.Error(writer, "415 files of this type are not allowed", http.StatusUnsupportedMediaType)
+		return
+	}
+	entry, deletionToken, err := newEntry(uploader.Author, filename, pasteContentType, ttl)
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "creating deletion token of paste", err)
+		return
+	}
+	upload := &Upload{Request: request, Entry: entry, Data: strings.NewReader(text)}
+	if !shareXRouter.storeUpload(writer, upload, limit) {
+		return
+	}
+	log.Printf("Created paste entry %v (%v bytes)\n", entry.ID, upload.Size)
+	shareXRouter.sendUploadResponse(writer, request, entry, upload.Size, deletionToken, nil)
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPaste(t *testing.T) {
+	_, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	text := "func main() {\n\tprintln(\"<b>\")\n}\n"
+	form := url.Values{pasteTextParameter: {text}, pasteLanguageParameter: {"go"}}
+	request := httptest.NewRequest(http.MethodPost, "/paste", strings.NewReader(form.Encode()))
+	request.Header.Set(contentTypeHeader, "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Paste failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	callReference := recorder.Body.String()
+	request = httptest.NewRequest(http.MethodGet, "/"+callReference, nil)
+	request.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get(contentTypeHeader), "text/html") {
+		t.Fatalf("Paste view responded with status %d and content type %q", recorder.Code,
+			recorder.Header().Get(contentTypeHeader))
+	}
+	if !strings.Contains(body, `<span class="keyword">func</span>`) || !strings.Contains(body, "&lt;b&gt;") ||
+		!strings.Contains(body, `href="#L3"`) || !strings.Contains(body, "/raw/"+callReference) {
+		t.Fatalf("Paste view is not highlighted correctly: %s", body)
+	}
+	// clients which are not browsers receive the text itself
+	for _, path := range []string{"/" + callReference, "/raw/" + callReference} {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK || recorder.Body.String() != text {
+			t.Fatalf("Request of %s responded with status %d: %s", path, recorder.Code, recorder.Body.String())
+		}
+	}
+}
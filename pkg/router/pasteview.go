@@ -0,0 +1,109 @@
+package router
+
+import (
+	"bytes"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+// pasteViewTemplate renders a text entry with highlighted syntax and line numbers.
+var pasteViewTemplate = template.Must(template.New("paste").Funcs(template.FuncMap{
+	"inc": func(index int) int {
+		return index + 1
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Filename}}</title>
+<style>
+body { margin: 0; background: #1e1e1e; color: #d4d4d4; font-family: sans-serif; }
+header { display: flex; justify-content: space-between; padding: 0.75em 1em; background: #252526; }
+header a { color: #4fc1ff; }
+.details { color: #858585; }
+table { border-collapse: collapse; font: 14px/1.4 monospace; }
+td { padding: 0 1em; vertical-align: top; white-space: pre; }
+.line-number { text-align: right; user-select: none; }
+.line-number a { color: #858585; text-decoration: none; }
+tr:target { background: #373737; }
+.comment { color: #6a9955; }
+.string { color: #ce9178; }
+.number { color: #b5cea8; }
+.keyword { color: #569cd6; }
+</style>
+</head>
+<body>
+<header>
+<span>{{.Filename}} <span class="details">{{.Language}} &middot; {{.UploadDate.Format "2006-01-02 15:04 MST"}}</span></span>
+<a href="{{.RawURL}}">Raw</a>
+</header>
+<table>
+{{range $index, $line := .Lines}}<tr id="L{{inc $index}}"><td class="line-number"><a href="#L{{inc $index}}">{{inc $index}}</a></td><td>{{range $line}}{{if .Kind.Class}}<span class="{{.Kind.Class}}">{{.Text}}</span>{{else}}{{.Text}}{{end}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// pasteView contains the values of the pasteViewTemplate.
+type pasteView struct {
+	Filename   string
+	Language   string
+	UploadDate time.Time
+	RawURL     string
+	Lines      [][]token
+}
+
+// isTextEntry checks whether the given entry contains plain text which can be shown within the paste view.
+func isTextEntry(entry *storage.Entry) bool {
+	mediaType, _, err := mime.ParseMediaType(entry.ContentType)
+	return err == nil && mediaType == "text/plain" && entry.Kind != storage.KindRedirect
+}
+
+// sendPasteView sends the paste view of the given text entry whose reader is already opened. It returns false
+// without sending anything if the text is too large or not encoded in UTF-8, so the raw data should be sent instead.
+func (shareXRouter *ShareXRouter) sendPasteView(writer http.ResponseWriter, request *http.Request,
+	entry *storage.Entry) bool {
+	data, err := ioutil.ReadAll(io.LimitReader(entry.Reader, maximumPasteBytes+1))
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "reading text of paste view", err)
+		return true
+	}
+	if len(data) > maximumPasteBytes || !utf8.Valid(data) {
+		if _, err := entry.Reader.Seek(0, io.SeekStart); err != nil {
+			shareXRouter.sendInternalError(writer, "rewinding reader of text entry", err)
+			return true
+		}
+		return false
+	}
+	text := string(data)
+	lang := detectLanguage(entry.Filename, text)
+	view := &pasteView{
+		Filename:   entry.Filename,
+		Language:   "plain text",
+		UploadDate: entry.UploadDate,
+		RawURL:     rawURL(shareXRouter.publicURL(request), entry.CallReference),
+		Lines:      highlight(lang, text),
+	}
+	if lang != nil {
+		view.Language = lang.name
+	}
+	buffer := &bytes.Buffer{}
+	if err := pasteViewTemplate.Execute(buffer, view); err != nil {
+		shareXRouter.sendInternalError(writer, "rendering paste view", err)
+		return true
+	}
+	writer.Header().Set(contentTypeHeader, "text/html; charset=utf-8")
+	// the page only needs its inline style sheet
+	writer.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(buffer.Bytes())
+	return true
+}
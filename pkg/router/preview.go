@@ -0,0 +1,204 @@
+package router
+
+import (
+	"bytes"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// siteName is the name of the site which is shown by link unfurlers.
+	siteName = "ShareX Server"
+	// previewDescriptionLength is the maximum amount of bytes of a text entry which is used as the description of its
+	// preview.
+	previewDescriptionLength = 300
+)
+
+// unfurlerAgents contains parts of the User-Agent headers of the bots which fetch previews of shared links.
+var unfurlerAgents = []string{
+	"discordbot", "slackbot", "twitterbot", "facebookexternalhit", "telegrambot", "whatsapp", "linkedinbot",
+	"skypeuripreview", "mastodon", "redditbot", "iframely", "embedly",
+}
+
+// previewTemplate renders a page which embeds the media of an entry and describes it with OpenGraph and Twitter card
+// metadata for link unfurlers.
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Filename}}</title>
+<meta property="og:site_name" content="{{.SiteName}}">
+<meta property="og:title" content="{{.Filename}}">
+<meta property="og:url" content="{{.URL}}">
+{{- if .Description}}
+<meta property="og:description" content="{{.Description}}">
+<meta name="twitter:description" content="{{.Description}}">
+{{- end}}
+{{- if eq .MediaType "image"}}
+<meta property="og:type" content="website">
+<meta property="og:image" content="{{.RawURL}}">
+<meta property="og:image:type" content="{{.ContentType}}">
+{{- if .Width}}
+<meta property="og:image:width" content="{{.Width}}">
+<meta property="og:image:height" content="{{.Height}}">
+{{- end}}
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:image" content="{{.RawURL}}">
+{{- else if eq .MediaType "video"}}
+<meta property="og:type" content="video.other">
+<meta property="og:video" content="{{.RawURL}}">
+<meta property="og:video:type" content="{{.ContentType}}">
+<meta name="twitter:card" content="summary">
+{{- else}}
+<meta property="og:type" content="website">
+<meta name="twitter:card" content="summary">
+{{- end}}
+<meta name="twitter:title" content="{{.Filename}}">
+<link rel="alternate" type="application/json+oembed" href="{{.OEmbedURL}}" title="{{.Filename}}">
+<style>
+body { margin: 0; background: #1e1e1e; color: #d4d4d4; font-family: sans-serif; text-align: center; }
+header { display: flex; justify-content: space-between; padding: 0.75em 1em; background: #252526; text-align: left; }
+header a { color: #4fc1ff; }
+.details { color: #858585; }
+main { padding: 1em; }
+img, video { max-width: 100%; max-height: 85vh; }
+</style>
+</head>
+<body>
+<header>
+<span>{{.Filename}} <span class="details">{{.ContentType}} &middot; {{.UploadDate.Format "2006-01-02 15:04 MST"}}</span></span>
+<a href="{{.RawURL}}">Raw</a>
+</header>
+<main>
+{{- if not .Embeddable}}
+<a href="{{.RawURL}}">Download {{.Filename}}</a>
+{{- else if eq .MediaType "image"}}
+<img src="{{.RawURL}}" alt="{{.Filename}}">
+{{- else if eq .MediaType "video"}}
+<video src="{{.RawURL}}" controls></video>
+{{- else if eq .MediaType "audio"}}
+<audio src="{{.RawURL}}" controls></audio>
+{{- else}}
+<a href="{{.RawURL}}">Download {{.Filename}}</a>
+{{- end}}
+</main>
+</body>
+</html>
+`))
+
+// preview contains the values of the previewTemplate.
+type preview struct {
+	*storage.Entry
+	SiteName string
+	// MediaType is the top-level type of the content type like "image".
+	MediaType   string
+	Description string
+	// Embeddable is true if the media can be shown within the page (see ShareXRouter.WhitelistedContentTypes).
+	Embeddable bool
+	// Width and Height are the dimensions of images which can be decoded.
+	Width, Height int
+	URL           string
+	RawURL        string
+	OEmbedURL     string
+}
+
+// isUnfurler checks whether the client is a bot which fetches the preview of a shared link.
+func isUnfurler(request *http.Request) bool {
+	userAgent := strings.ToLower(request.UserAgent())
+	for _, unfurlerAgent := range unfurlerAgents {
+		if strings.Contains(userAgent, unfurlerAgent) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPreviewable checks whether the given entry should be shown within the preview page when a browser requests it.
+// Other entries are sent as they are.
+func isPreviewable(entry *storage.Entry) bool {
+	switch mediaTypeCategory(entry.ContentType) {
+	case "image", "video", "audio":
+		return true
+	default:
+		return false
+	}
+}
+
+// mediaTypeCategory returns the top-level type of the given content type, e.g. "image" for "image/png".
+func mediaTypeCategory(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.SplitN(mediaType, "/", 2)[0]
+}
+
+// sendPreview sends the preview page of the given entry whose reader is already opened.
+func (shareXRouter *ShareXRouter) sendPreview(writer http.ResponseWriter, request *http.Request,
+	entry *storage.Entry) {
+	baseURL := shareXRouter.publicURL(request)
+	entryURL := viewURL(baseURL, entry.CallReference)
+	page := &preview{
+		Entry:      entry,
+		SiteName:   siteName,
+		MediaType:  mediaTypeCategory(entry.ContentType),
+		Embeddable: shareXRouter.isWhitelisted(entry.ContentType),
+		URL:        entryURL,
+		RawURL:     rawURL(baseURL, entry.CallReference),
+		OEmbedURL:  oEmbedURL(baseURL, entryURL),
+	}
+	if isDecodableImage(entry.ContentType) {
+		if config, err := decodeImageConfig(entry.Reader); err == nil {
+			page.Width, page.Height = config.Width, config.Height
+		} else {
+			log.Printf("There was an error while decoding the dimensions of the entry %v, %T: %+v\n", entry.ID,
+				err, err)
+		}
+	} else if isTextEntry(entry) {
+		data, err := ioutil.ReadAll(io.LimitReader(entry.Reader, previewDescriptionLength))
+		if err != nil {
+			shareXRouter.sendInternalError(writer, "reading description of preview", err)
+			return
+		}
+		page.Description = truncateUTF8(string(data))
+	}
+	buffer := &bytes.Buffer{}
+	if err := previewTemplate.Execute(buffer, page); err != nil {
+		shareXRouter.sendInternalError(writer, "rendering preview", err)
+		return
+	}
+	// the media is only loaded from this server
+	mediaSources := "'self'"
+	if shareXRouter.PublicURL != "" {
+		mediaSources += " " + baseURL + "/"
+	}
+	writer.Header().Set(contentTypeHeader, "text/html; charset=utf-8")
+	writer.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src "+
+		mediaSources+"; media-src "+mediaSources)
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(buffer.Bytes())
+}
+
+// truncateUTF8 removes the incomplete character from the end of the given text which was cut off after a fixed
+// amount of bytes. It returns an empty string if the text is not encoded in UTF-8.
+func truncateUTF8(text string) string {
+	for i := 0; i < utf8.UTFMax && len(text) > 0; i++ {
+		if utf8.ValidString(text) {
+			return text
+		}
+		text = text[:len(text)-1]
+	}
+	if !utf8.ValidString(text) {
+		return ""
+	}
+	return text
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newTestImage returns a PNG encoded image with the given dimensions.
+func newTestImage(t *testing.T, width, height int) []byte {
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Could not encode test image, %T: %v", err, err)
+	}
+	return buffer.Bytes()
+}
+
+func TestPreview(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	shareXRouter.PublicURL = "https://sharex.example.com"
+	imageData := newTestImage(t, 3, 2)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newUploadRequest(t, "screenshot.png", "image/png", imageData))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Upload failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	callReference := recorder.Body.String()
+	entryURL := "https://sharex.example.com/" + callReference
+	unfurlerRequest := httptest.NewRequest(http.MethodGet, "/"+callReference, nil)
+	unfurlerRequest.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)")
+	browserRequest := httptest.NewRequest(http.MethodGet, "/"+callReference, nil)
+	browserRequest.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	for _, request := range []*http.Request{unfurlerRequest, browserRequest} {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		body := recorder.Body.String()
+		if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get(contentTypeHeader), "text/html") {
+			t.Fatalf("Preview responded with status %d and content type %q", recorder.Code,
+				recorder.Header().Get(contentTypeHeader))
+		}
+		for _, expected := range []string{
+			`<meta property="og:image" content="https://sharex.example.com/raw/` + callReference + `">`,
+			`<meta property="og:image:width" content="3">`,
+			`<meta name="twitter:card" content="summary_large_image">`,
+			`type="application/json+oembed"`,
+			`<img src="https://sharex.example.com/raw/` + callReference + `"`,
+		} {
+			if !strings.Contains(body, expected) {
+				t.Fatalf("Preview does not contain %s: %s", expected, body)
+			}
+		}
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/raw/"+callReference, nil))
+	if recorder.Code != http.StatusOK || !bytes.Equal(recorder.Body.Bytes(), imageData) {
+		t.Fatalf("Raw request failed with status %d", recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/oembed?url="+url.QueryEscape(entryURL), nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("oEmbed request failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	response := &oEmbedResponse{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("Could not decode oEmbed response, %T: %v", err, err)
+	}
+	if response.Type != "photo" || response.Width != 3 || response.Height != 2 ||
+		response.URL != "https://sharex.example.com/raw/"+callReference {
+		t.Fatalf("Invalid oEmbed response %+v", response)
+	}
+}
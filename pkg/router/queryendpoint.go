@@ -0,0 +1,132 @@
+package router
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// default and maximum amount of entries which are returned per page
+	defaultQueryLimit = 50
+	maximumQueryLimit = 500
+	// query parameter names
+	authorParameter      = "author"
+	contentTypeParameter = "content_type"
+	fromParameter        = "from"
+	untilParameter       = "until"
+	cursorParameter      = "cursor"
+	limitParameter       = "limit"
+)
+
+// entryResponse is the JSON representation of an entry.
+type entryResponse struct {
+	CallReference string    `json:"call_reference"`
+	Kind          string    `json:"kind"`
+	Author        string    `json:"author"`
+	Filename      string    `json:"filename"`
+	ContentType   string    `json:"content_type"`
+	UploadDate    time.Time `json:"upload_date"`
+	// ExpiryDate is nil if the entry never expires.
+	ExpiryDate  *time.Time `json:"expiry_date,omitempty"`
+	ContentHash string     `json:"content_hash,omitempty"`
+	// Hits is only counted for redirects.
+	Hits int64 `json:"hits,omitempty"`
+}
+
+// queryResponse is the JSON representation of a storage.QueryResult.
+type queryResponse struct {
+	Entries []*entryResponse `json:"entries"`
+	Cursor  string           `json:"cursor,omitempty"`
+}
+
+// newEntryResponse returns the JSON representation of the given entry.
+func newEntryResponse(entry *storage.Entry) *entryResponse {
+	response := &entryResponse{
+		CallReference: entry.CallReference,
+		Kind:          string(entry.Kind),
+		Author:        string(entry.Author),
+		Filename:      entry.Filename,
+		ContentType:   entry.ContentType,
+		UploadDate:    entry.UploadDate,
+		ContentHash:   entry.ContentHash,
+		Hits:          entry.Hits,
+	}
+	if response.Kind == "" {
+		// entries of older versions do not have a kind
+		response.Kind = string(storage.KindFile)
+	}
+	if !entry.ExpiryDate.IsZero() {
+		response.ExpiryDate = &entry.ExpiryDate
+	}
+	return response
+}
+
+// handleQuery is the endpoint which pages through the stored entries. The entries can be filtered by their author,
+// the prefix of their content type and their upload date (RFC 3339). The endpoint is accessible with the admin token
+// or with the access token of an uploader who can only query their own entries.
+func (shareXRouter *ShareXRouter) handleQuery(writer http.ResponseWriter, request *http.Request) {
+	var token *storage.Token
+	if !shareXRouter.isAdmin(request) {
+		var err error
+		if token, err = shareXRouter.authenticate(request); err == storage.ErrTokenNotFound {
+			sendUnauthorized(writer)
+			return
+		} else if err != nil {
+			shareXRouter.sendInternalError(writer, "authenticating uploader", err)
+			return
+		}
+	}
+	queryableStorage, ok := shareXRouter.Storage.(storage.QueryableStorage)
+	if !ok {
+		http.Error(writer, "501 the storage does not support queries", http.StatusNotImplemented)
+		return
+	}
+	parameters := request.URL.Query()
+	query := &storage.Query{
+		Author:            storage.AuthorIdentifier(parameters.Get(authorParameter)),
+		ContentTypePrefix: parameters.Get(contentTypeParameter),
+		Cursor:            parameters.Get(cursorParameter),
+		Limit:             defaultQueryLimit,
+	}
+	// uploaders are only allowed to see their own entries
+	if token != nil {
+		query.Author = token.Author
+	}
+	var err error
+	if from := parameters.Get(fromParameter); from != "" {
+		if query.From, err = time.Parse(time.RFC3339, from); err != nil {
+			http.Error(writer, "400 the from parameter is invalid", http.StatusBadRequest)
+			return
+		}
+	}
+	if until := parameters.Get(untilParameter); until != "" {
+		if query.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			http.Error(writer, "400 the until parameter is invalid", http.StatusBadRequest)
+			return
+		}
+	}
+	if limit := parameters.Get(limitParameter); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maximumQueryLimit {
+			http.Error(writer, "400 the limit parameter is invalid", http.StatusBadRequest)
+			return
+		}
+	}
+	queryResult, err := queryableStorage.Query(query)
+	if err == storage.ErrInvalidCursor {
+		http.Error(writer, "400 the cursor parameter is invalid", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, "querying entries", err)
+		return
+	}
+	response := &queryResponse{
+		Entries: make([]*entryResponse, len(queryResult.Entries)),
+		Cursor:  queryResult.Cursor,
+	}
+	for i, entry := range queryResult.Entries {
+		response.Entries[i] = newEntryResponse(entry)
+	}
+	shareXRouter.sendJSON(writer, response)
+}
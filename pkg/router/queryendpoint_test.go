@@ -0,0 +1,51 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	_, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	// the content types are detected from the data
+	for _, data := range []string{string(testPNGData), "test", "GIF89a test"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, newUploadRequest(t, "testfile", "image/png", []byte(data)))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Upload failed with status %d: %s", recorder.Code, recorder.Body.String())
+		}
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/entries", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("Unauthenticated query responded with status %d", recorder.Code)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/entries?content_type=image/&limit=1", nil)
+	request.Header.Set(authorizationHeader, bearerPrefix+"admin-token")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Query failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	response := &queryResponse{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("Could not decode query response, %T: %v", err, err)
+	}
+	if len(response.Entries) != 1 || response.Cursor == "" {
+		t.Fatalf("Invalid query response %+v", response)
+	}
+	request = httptest.NewRequest(http.MethodGet, "/entries?content_type=image/&cursor="+response.Cursor, nil)
+	request.Header.Set(authorizationHeader, bearerPrefix+"admin-token")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	response = &queryResponse{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("Could not decode query response, %T: %v", err, err)
+	}
+	if len(response.Entries) != 1 || response.Cursor != "" {
+		t.Fatalf("Invalid query response %+v", response)
+	}
+}
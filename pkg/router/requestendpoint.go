@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -16,8 +19,21 @@ const (
 )
 
 // handleRequest is the endpoint which handles incoming file requests via link. It uses the var with the key stored in
-// callReferenceVar to resolve the database entry.
+// callReferenceVar to resolve the database entry. Redirects are followed. Link unfurlers receive the preview page and
+// browsers receive either the preview page of media or the paste view of text. Images are resized and converted if the
+// request contains resize parameters.
 func (shareXRouter *ShareXRouter) handleRequest(writer http.ResponseWriter, request *http.Request) {
+	shareXRouter.serveEntry(writer, request, false)
+}
+
+// handleRawRequest is the endpoint which always sends the stored data of an entry.
+func (shareXRouter *ShareXRouter) handleRawRequest(writer http.ResponseWriter, request *http.Request) {
+	shareXRouter.serveEntry(writer, request, true)
+}
+
+// serveEntry sends the entry whose call reference is stored in the callReferenceVar. The stored data is sent as it is
+// if raw is true.
+func (shareXRouter *ShareXRouter) serveEntry(writer http.ResponseWriter, request *http.Request, raw bool) {
 	callReference, ok := mux.Vars(request)[callReferenceVar]
 	if !ok {
 		http.Error(writer, "400 the client sent a bad request", http.StatusBadRequest)
@@ -33,6 +49,17 @@ func (shareXRouter *ShareXRouter) handleRequest(writer http.ResponseWriter, requ
 			strconv.Quote(callReference)), err)
 		return
 	}
+	shareXRouter.runAccessHooks(request, entry)
+	if shareXRouter.MaximumResizeDimension > 0 && entry.Kind != storage.KindRedirect {
+		options, err := shareXRouter.parseResizeOptions(request.URL.Query(), entry.ContentType)
+		if err != nil {
+			http.Error(writer, "400 "+err.Error(), http.StatusBadRequest)
+			return
+		} else if options != nil {
+			shareXRouter.sendResizedImage(writer, request, entry, options)
+			return
+		}
+	}
 	// open file reader to send the file to the remote client
 	if err := entry.Reader.Open(); err != nil {
 		shareXRouter.sendInternalError(writer, fmt.Sprintf("opening reader of file data with call reference %v",
@@ -41,19 +68,62 @@ func (shareXRouter *ShareXRouter) handleRequest(writer http.ResponseWriter, requ
 	}
 	// make sure that the reader gets closed after sending the data
 	defer entry.Reader.Close()
-	// send disposition header
-	var dispositionType string
-	for _, entryMimeType := range shareXRouter.WhitelistedContentTypes {
-		if strings.EqualFold(entryMimeType, entry.ContentType) {
-			dispositionType = "inline"
+	if !raw && entry.Kind == storage.KindRedirect {
+		shareXRouter.sendRedirect(writer, request, entry)
+		return
+	}
+	if !raw && isUnfurler(request) {
+		shareXRouter.sendPreview(writer, request, entry)
+		return
+	}
+	if !raw && acceptsMediaType(request, "text/html") {
+		if isPreviewable(entry) {
+			shareXRouter.sendPreview(writer, request, entry)
+			return
+		} else if isTextEntry(entry) && shareXRouter.sendPasteView(writer, request, entry) {
+			return
 		}
 	}
-	if len(dispositionType) == 0 {
-		dispositionType = "attachment"
+	// send disposition header
+	dispositionType := "attachment"
+	if shareXRouter.isWhitelisted(entry.ContentType) {
+		dispositionType = "inline"
 	}
 	writer.Header().Set(dispositionHeader, fmt.Sprintf(dispositionValueFormat, dispositionType, entry.Filename))
-	// set content type header
+	// set content type header and make sure that browsers do not detect another one
 	writer.Header().Set(contentTypeHeader, entry.ContentType)
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
 	// write file data from the opened reader to the remote client
 	http.ServeContent(writer, request, "", entry.UploadDate, entry.Reader)
-}
\ No newline at end of file
+}
+
+// isWhitelisted checks whether the given content type is one of the WhitelistedContentTypes which are displayed
+// embed in the browser.
+func (shareXRouter *ShareXRouter) isWhitelisted(contentType string) bool {
+	for _, whitelistedContentType := range shareXRouter.WhitelistedContentTypes {
+		if strings.EqualFold(whitelistedContentType, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendRedirect redirects the client to the URL which is stored as the data of the given redirect entry and counts the
+// hit if the storage supports it.
+func (shareXRouter *ShareXRouter) sendRedirect(writer http.ResponseWriter, request *http.Request, entry *storage.Entry) {
+	target, err := ioutil.ReadAll(io.LimitReader(entry.Reader, maximumShortenedURLLength))
+	if err != nil {
+		shareXRouter.sendInternalError(writer, fmt.Sprintf("reading target of redirect with call reference %v",
+			strconv.Quote(entry.CallReference)), err)
+		return
+	}
+	if hitCountingStorage, ok := shareXRouter.Storage.(storage.HitCountingStorage); ok {
+		// a failed hit count should not prevent the redirect
+		if err := hitCountingStorage.CountHit(entry.CallReference); err != nil {
+			log.Printf("There was an error while counting a hit of the entry %v, %T: %+v\n", entry.ID, err, err)
+		}
+	}
+	// the target may change if the call reference is reused after the entry was deleted
+	writer.Header().Set("Cache-Control", "no-store")
+	http.Redirect(writer, request, string(target), http.StatusFound)
+}
@@ -0,0 +1,170 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// resizedVariantPrefix is the prefix of the names of the variants which contain resized images.
+	resizedVariantPrefix = "resized-"
+	// the fit modes of resized images
+	fitContain = "contain"
+	fitCover   = "cover"
+	fitFill    = "fill"
+)
+
+// resizeParameters are the query parameters which request a resized or converted image.
+var resizeParameters = []string{"width", "height", "fit", "format"}
+
+// resizeOptions describe how an image is resized and converted.
+type resizeOptions struct {
+	// width and height are the bounds of the resized image. A zero value does not limit the dimension.
+	width, height int
+	// fit decides how the image is fit into the bounds: "contain" scales it down to fit into them, "cover" scales and
+	// crops it to fill them and "fill" stretches it to them.
+	fit string
+	// format is the format of the resized image which is either "png", "jpeg" or "gif".
+	format string
+}
+
+// variantName returns the name of the variant which contains an image resized with the options.
+func (options *resizeOptions) variantName() string {
+	return fmt.Sprintf("%s%dx%d-%s-%s", resizedVariantPrefix, options.width, options.height, options.fit,
+		options.format)
+}
+
+// parseResizeOptions parses the resize options of the given query for an image with the given content type. It returns
+// nil if the query does not contain any resize parameter or an error if the parameters are invalid.
+func (shareXRouter *ShareXRouter) parseResizeOptions(query url.Values, contentType string) (*resizeOptions, error) {
+	var requested bool
+	for _, parameter := range resizeParameters {
+		if query.Get(parameter) != "" {
+			requested = true
+		}
+	}
+	if !requested {
+		return nil, nil
+	}
+	if !isDecodableImage(contentType) {
+		return nil, errors.New("only PNG, JPEG and GIF images can be resized")
+	}
+	options := &resizeOptions{fit: fitContain, format: derivedImageFormat(contentType)}
+	for _, dimension := range []struct {
+		parameter string
+		value     *int
+	}{{"width", &options.width}, {"height", &options.height}} {
+		rawValue := query.Get(dimension.parameter)
+		if rawValue == "" {
+			continue
+		}
+		value, err := strconv.Atoi(rawValue)
+		if err != nil || value <= 0 || value > shareXRouter.MaximumResizeDimension {
+			return nil, fmt.Errorf("the %s has to be between 1 and %d pixels", dimension.parameter,
+				shareXRouter.MaximumResizeDimension)
+		}
+		*dimension.value = value
+	}
+	if fit := query.Get("fit"); fit != "" {
+		if fit != fitContain && fit != fitCover && fit != fitFill {
+			return nil, errors.New("the fit has to be either contain, cover or fill")
+		}
+		if fit != fitContain && (options.width == 0 || options.height == 0) {
+			return nil, fmt.Errorf("the fit %s requires both the width and the height", fit)
+		}
+		options.fit = fit
+	}
+	if format := query.Get("format"); format != "" {
+		if _, ok := encodedContentType(format); !ok {
+			return nil, errors.New("the format has to be either png, jpeg or gif")
+		}
+		options.format = format
+	}
+	return options, nil
+}
+
+// resizeImage decodes the image which is read by the given reader and encodes it resized according to the given
+// options.
+func resizeImage(source io.ReadSeeker, options *resizeOptions) ([]byte, error) {
+	decodedImage, err := decodeImage(source)
+	if err != nil {
+		return nil, err
+	}
+	bounds := decodedImage.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	switch options.fit {
+	case fitFill:
+		width, height = options.width, options.height
+	case fitCover:
+		// the centered part of the image which has the aspect ratio of the bounds is scaled to them
+		cropped := bounds
+		if bounds.Dx()*options.height > bounds.Dy()*options.width {
+			croppedWidth := maxInt(1, bounds.Dy()*options.width/options.height)
+			cropped.Min.X += (bounds.Dx() - croppedWidth) / 2
+			cropped.Max.X = cropped.Min.X + croppedWidth
+		} else {
+			croppedHeight := maxInt(1, bounds.Dx()*options.height/options.width)
+			cropped.Min.Y += (bounds.Dy() - croppedHeight) / 2
+			cropped.Max.Y = cropped.Min.Y + croppedHeight
+		}
+		decodedImage = subImage(decodedImage, cropped)
+		width, height = options.width, options.height
+	default:
+		maximumWidth, maximumHeight := options.width, options.height
+		if maximumWidth == 0 {
+			maximumWidth = width
+		}
+		if maximumHeight == 0 {
+			maximumHeight = height
+		}
+		width, height = fitDimensions(width, height, maximumWidth, maximumHeight)
+	}
+	buffer := &bytes.Buffer{}
+	var resizedImage image.Image = decodedImage
+	if width != decodedImage.Bounds().Dx() || height != decodedImage.Bounds().Dy() {
+		resizedImage = scaleImage(decodedImage, width, height)
+	}
+	if err := encodeImage(buffer, resizedImage, options.format); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// subImage returns the part of the given image within the given rectangle.
+func subImage(source image.Image, rectangle image.Rectangle) image.Image {
+	if subImager, ok := source.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return subImager.SubImage(rectangle)
+	}
+	// every image type of the standard library supports sub images, so this is only a fallback
+	return scaleImage(source, source.Bounds().Dx(), source.Bounds().Dy()).SubImage(rectangle)
+}
+
+// PruneResizeCache removes the least recently stored resized images until their total size is at most the
+// ResizeCacheSize. It returns the amount of removed images or an error if something goes wrong.
+func (shareXRouter *ShareXRouter) PruneResizeCache() (int, error) {
+	variantStorage, ok := shareXRouter.Storage.(storage.PrunableVariantStorage)
+	if !ok || shareXRouter.ResizeCacheSize <= 0 {
+		return 0, nil
+	}
+	return variantStorage.PruneVariants(resizedVariantPrefix, shareXRouter.ResizeCacheSize)
+}
+
+// sendResizedImage sends the given image entry resized according to the given options. The resized image is stored as
+// a variant if the resize cache is enabled.
+func (shareXRouter *ShareXRouter) sendResizedImage(writer http.ResponseWriter, request *http.Request,
+	entry *storage.Entry, options *resizeOptions) {
+	_, cachesVariants := shareXRouter.Storage.(storage.PrunableVariantStorage)
+	shareXRouter.sendVariant(writer, request, entry, options.variantName(), options.format,
+		cachesVariants && shareXRouter.ResizeCacheSize > 0, func(source io.ReadSeeker) ([]byte, error) {
+			return resizeImage(source, options)
+		})
+}
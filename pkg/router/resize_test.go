@@ -0,0 +1,73 @@
+package router
+
+import (
+	"bytes"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newUploadRequest(t, "screenshot.png", "image/png", newTestImage(t, 64, 32)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Upload failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	callReference := recorder.Body.String()
+	for _, test := range []struct {
+		query         string
+		contentType   string
+		format        string
+		width, height int
+	}{
+		{"width=32", "image/png", "png", 32, 16},
+		{"height=8&format=jpeg", "image/jpeg", "jpeg", 16, 8},
+		{"width=16&height=16&fit=contain", "image/png", "png", 16, 8},
+		{"width=16&height=16&fit=cover&format=gif", "image/gif", "gif", 16, 16},
+		{"width=10&height=30&fit=fill", "image/png", "png", 10, 30},
+		{"format=gif", "image/gif", "gif", 64, 32},
+	} {
+		// the second request is served from the cache
+		for i := 0; i < 2; i++ {
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/"+callReference+"?"+test.query, nil))
+			if recorder.Code != http.StatusOK || recorder.Header().Get(contentTypeHeader) != test.contentType {
+				t.Fatalf("Request with query %q responded with status %d and content type %q", test.query,
+					recorder.Code, recorder.Header().Get(contentTypeHeader))
+			}
+			config, format, err := image.DecodeConfig(bytes.NewReader(recorder.Body.Bytes()))
+			if err != nil {
+				t.Fatalf("Could not decode image of query %q, %T: %v", test.query, err, err)
+			}
+			if format != test.format || config.Width != test.width || config.Height != test.height {
+				t.Fatalf("Query %q resulted in a %s image with the dimensions %dx%d, expected a %s image with %dx%d",
+					test.query, format, config.Width, config.Height, test.format, test.width, test.height)
+			}
+		}
+	}
+	entry, err := shareXRouter.Storage.Request(callReference)
+	if err != nil {
+		t.Fatalf("Could not request entry, %T: %v", err, err)
+	}
+	if _, err := shareXRouter.Storage.(storage.VariantStorage).RequestVariant(entry.ID,
+		"resized-32x0-contain-png"); err != nil {
+		t.Fatalf("The resized image was not stored as a variant, %T: %v", err, err)
+	}
+	for _, query := range []string{"width=0", "width=65", "height=abc", "fit=stretch", "width=16&fit=cover",
+		"format=webp"} {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/"+callReference+"?"+query, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("Request with invalid query %q responded with status %d", query, recorder.Code)
+		}
+	}
+	// the cached images are removed once they exceed the cache size
+	shareXRouter.ResizeCacheSize = 1
+	if pruned, err := shareXRouter.PruneResizeCache(); err != nil || pruned != 6 {
+		t.Fatalf("Pruning the resize cache removed %d images instead of 6, %v", pruned, err)
+	}
+}
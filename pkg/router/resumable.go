@@ -0,0 +1,198 @@
+package router
+
+import (
+	cryptRand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// resumableIDLength is the amount of random bytes used for the IDs of the resumable uploads.
+	resumableIDLength = 16
+	// suffixes of the files which contain the state and the received data of a resumable upload
+	resumableInfoFileSuffix  = ".json"
+	resumableDataFileSuffix  = ".part"
+	resumableTemporarySuffix = ".tmp"
+)
+
+// resumableUpload is the state of a resumable upload. It is persisted next to the received data inside of the
+// ResumableFolder, so the upload can be continued after a restart of the server.
+type resumableUpload struct {
+	ID           string        `json:"id"`
+	Length       int64         `json:"length"`
+	Author       string        `json:"author"`
+	Filename     string        `json:"filename"`
+	TTL          time.Duration `json:"ttl,omitempty"`
+	CreationDate time.Time     `json:"creation_date"`
+	// CallReference is set once the upload was completed and stored as an entry. It is kept so that a client which
+	// lost the last response is still able to resolve it. The deletion token is only sent within that response and
+	// never persisted.
+	CallReference string `json:"call_reference,omitempty"`
+}
+
+// isCompleted checks whether the upload was already stored as an entry.
+func (upload *resumableUpload) isCompleted() bool {
+	return upload.CallReference != ""
+}
+
+// newResumableID randomly creates a new hex encoded ID of a resumable upload.
+func newResumableID() (string, error) {
+	id := make([]byte, resumableIDLength)
+	if _, err := cryptRand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// isValidResumableID checks whether the given value could have been created by newResumableID. This makes sure that
+// the ID can not be used to access other files.
+func isValidResumableID(value string) bool {
+	if len(value) != resumableIDLength*2 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+// readResumableUpload reads the state of the resumable upload with the given ID. It returns an error satisfying
+// os.IsNotExist if the upload does not exist.
+func (shareXRouter *ShareXRouter) readResumableUpload(id string) (*resumableUpload, error) {
+	if !isValidResumableID(id) {
+		return nil, os.ErrNotExist
+	}
+	data, err := ioutil.ReadFile(shareXRouter.resumableFilepath(id, resumableInfoFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	upload := &resumableUpload{}
+	if err = json.Unmarshal(data, upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// writeResumableUpload replaces the state of the given resumable upload. The data is written to a temporary file
+// first which is renamed afterwards so that a crash can not leave a half written state behind.
+func (shareXRouter *ShareXRouter) writeResumableUpload(upload *resumableUpload) error {
+	infoFilepath := shareXRouter.resumableFilepath(upload.ID, resumableInfoFileSuffix)
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(infoFilepath+resumableTemporarySuffix, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(infoFilepath+resumableTemporarySuffix, infoFilepath)
+}
+
+// resumableOffset returns the amount of bytes which were received for the given resumable upload.
+func (shareXRouter *ShareXRouter) resumableOffset(upload *resumableUpload) (int64, error) {
+	if upload.isCompleted() {
+		return upload.Length, nil
+	}
+	fileInfo, err := os.Stat(shareXRouter.resumableFilepath(upload.ID, resumableDataFileSuffix))
+	if err != nil {
+		return 0, err
+	}
+	return fileInfo.Size(), nil
+}
+
+// removeResumableUpload removes the state and the received data of the resumable upload with the given ID.
+func (shareXRouter *ShareXRouter) removeResumableUpload(id string) error {
+	if err := os.Remove(shareXRouter.resumableFilepath(id, resumableDataFileSuffix)); err != nil &&
+		!os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(shareXRouter.resumableFilepath(id, resumableInfoFileSuffix))
+}
+
+// lockResumableUpload marks the resumable upload with the given ID as busy. It returns false if the upload is already
+// busy, e.g. because another request is appending data to it.
+func (shareXRouter *ShareXRouter) lockResumableUpload(id string) bool {
+	shareXRouter.resumableMutex.Lock()
+	defer shareXRouter.resumableMutex.Unlock()
+	if shareXRouter.busyResumableUploads == nil {
+		shareXRouter.busyResumableUploads = make(map[string]bool)
+	}
+	if shareXRouter.busyResumableUploads[id] {
+		return false
+	}
+	shareXRouter.busyResumableUploads[id] = true
+	return true
+}
+
+// unlockResumableUpload removes the busy mark of the resumable upload with the given ID.
+func (shareXRouter *ShareXRouter) unlockResumableUpload(id string) {
+	shareXRouter.resumableMutex.Lock()
+	defer shareXRouter.resumableMutex.Unlock()
+	delete(shareXRouter.busyResumableUploads, id)
+}
+
+// resumableFilepath returns the path of the file with the given suffix which belongs to the resumable upload with the
+// given ID.
+func (shareXRouter *ShareXRouter) resumableFilepath(id, suffix string) string {
+	return shareXRouter.ResumableFolder + id + suffix
+}
+
+// resumableLastActivity returns the time the resumable upload with the given ID was changed the last time, i.e. when
+// it was created, data was appended or it was completed.
+func (shareXRouter *ShareXRouter) resumableLastActivity(id string) (time.Time, error) {
+	var lastActivity time.Time
+	for _, suffix := range []string{resumableInfoFileSuffix, resumableDataFileSuffix} {
+		fileInfo, err := os.Stat(shareXRouter.resumableFilepath(id, suffix))
+		if os.IsNotExist(err) && suffix == resumableDataFileSuffix {
+			// the data file is removed once the upload was completed
+			continue
+		} else if err != nil {
+			return time.Time{}, err
+		}
+		if fileInfo.ModTime().After(lastActivity) {
+			lastActivity = fileInfo.ModTime()
+		}
+	}
+	return lastActivity, nil
+}
+
+// DeleteStaleResumableUploads removes all resumable uploads which were not changed since the given time, regardless
+// of whether they were completed. Uploads which are still being continued are kept however long they take. It returns
+// the amount of removed uploads or an error if something goes wrong.
+func (shareXRouter *ShareXRouter) DeleteStaleResumableUploads(inactiveSince time.Time) (int, error) {
+	if shareXRouter.ResumableFolder == "" {
+		return 0, nil
+	}
+	fileInfos, err := ioutil.ReadDir(shareXRouter.ResumableFolder)
+	if os.IsNotExist(err) {
+		// no resumable upload was created yet
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	var removed int
+	for _, fileInfo := range fileInfos {
+		id := strings.TrimSuffix(fileInfo.Name(), resumableInfoFileSuffix)
+		if id == fileInfo.Name() || !isValidResumableID(id) {
+			continue
+		}
+		lastActivity, err := shareXRouter.resumableLastActivity(id)
+		if os.IsNotExist(err) {
+			// the upload was removed in the meantime
+			continue
+		} else if err != nil {
+			return removed, err
+		}
+		if !lastActivity.Before(inactiveSince) || !shareXRouter.lockResumableUpload(id) {
+			continue
+		}
+		err = shareXRouter.removeResumableUpload(id)
+		shareXRouter.unlockResumableUpload(id)
+		if err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
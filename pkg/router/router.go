@@ -1,11 +1,15 @@
 package router
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/mmichaelb/sharexserver/pkg/storage"
 	"log"
 	"net/http"
+	"runtime"
+	"sync"
+	"time"
 )
 
 const contentTypeHeader = "Content-Type"
@@ -14,15 +18,107 @@ const contentTypeHeader = "Content-Type"
 type ShareXRouter struct {
 	// Storage is an implementation of the Storage interface which is used by the ShareX router.
 	Storage storage.FileStorage
+	// PublicURL is the URL the ShareX router is reachable at from the outside, e.g. "https://example.com/sharex". It is
+	// used to generate the URLs within the ShareX custom uploader. If it is empty, it is derived from the request.
+	PublicURL string
 	// WhitelistedContentTypes is a slice of content types which will be displayed embed in the browser.
 	WhitelistedContentTypes []string
+	// AllowedContentTypes and DeniedContentTypes decide which files may be uploaded by their content type which is
+	// detected from their data. The content types can also match all subtypes of a type like "image/*". Every content
+	// type is allowed if AllowedContentTypes is empty.
+	AllowedContentTypes, DeniedContentTypes []string
+	// AllowedExtensions and DeniedExtensions decide which files may be uploaded by the extension of their filename like
+	// ".png". Every extension is allowed if AllowedExtensions is empty.
+	AllowedExtensions, DeniedExtensions []string
+	// AdminToken is the secret token which grants access to the administrative endpoints like the entry listing and
+	// the token management. These endpoints are disabled if it is empty.
+	AdminToken string
+	// Tokens is used to authenticate the uploaders. If it is set, uploads are only accepted with a valid access token
+	// and the entries are stamped with the author of the token. Otherwise every upload is accepted and stamped with a
+	// default user.
+	Tokens storage.TokenStorage
+	// ResumableFolder is the folder which contains the state and the received data of the resumable uploads (see
+	// https://tus.io/). The resumable upload endpoints are disabled if it is empty.
+	ResumableFolder string
+	// StripMetadataContentTypes contains the content types of the uploaded images whose EXIF, XMP and text metadata
+	// is removed before they are stored, e.g. "image/jpeg" or "image/*". Only JPEG and PNG images are supported.
+	StripMetadataContentTypes []string
+	// MaximumUploadSize is the maximum size of an uploaded file in bytes. Larger uploads are aborted and rejected. A
+	// zero value means that the size is unlimited.
+	MaximumUploadSize int64
+	// DefaultQuota limits the data every author is allowed to store unless the quota of their token does. It is only
+	// enforced if the Storage implements the storage.UsageStorage interface.
+	DefaultQuota storage.Quota
+	// ThumbnailSize is the maximum width and height of the thumbnails of image entries in pixels. The thumbnails are
+	// stored as variants if the Storage implements the storage.VariantStorage interface. The thumbnail endpoint is
+	// disabled if it is zero.
+	ThumbnailSize int
+	// MaximumResizeDimension is the maximum width and height of images which are resized on the fly via the query
+	// parameters "width", "height", "fit" and "format". The resizing is disabled if it is zero.
+	MaximumResizeDimension int
+	// ResizeCacheSize is the maximum total size of the resized images in bytes which are stored as variants if the
+	// Storage implements the storage.PrunableVariantStorage interface. The limit is enforced by PruneResizeCache. The
+	// resized images are not stored if it is zero.
+	ResizeCacheSize int64
+	// PreStoreHooks and PostStoreHooks are run in their order for every new entry before and after it is stored (see
+	// PreStoreHook and PostStoreHook).
+	PreStoreHooks  []PreStoreHook
+	PostStoreHooks []PostStoreHook
+	// DeleteHooks and AccessHooks are run in their order whenever an entry was deleted via its deletion URL or is
+	// requested (see DeleteHook and AccessHook).
+	DeleteHooks []DeleteHook
+	AccessHooks []AccessHook
+	// HookTimeout is the maximum duration of a single call of a hook. The reading of data which is wrapped by a
+	// pre-store hook is not limited by it. A zero value means that the hooks are only canceled once the client is
+	// gone.
+	HookTimeout time.Duration
+	// ImageProcessingConcurrency is the maximum amount of images which are processed at the same time, e.g. to
+	// generate thumbnails. The number of CPUs is used if it is zero.
+	ImageProcessingConcurrency int
+
+	// resumableMutex guards busyResumableUploads which contains the IDs of the resumable uploads which are currently
+	// used by a request.
+	resumableMutex       sync.Mutex
+	busyResumableUploads map[string]bool
+	// imageWorkers is the semaphore which limits the amount of images which are processed at the same time.
+	imageWorkers chan struct{}
 }
 
 // WrapHandler wraps the endpoints to the given mux.Router. At the moment this is bound to the usage of gorilla/mux in
 // your dependency but in the future this should be generalized. //TODO
 func (shareXRouter *ShareXRouter) WrapHandler(router *mux.Router) {
+	imageProcessingConcurrency := shareXRouter.ImageProcessingConcurrency
+	if imageProcessingConcurrency <= 0 {
+		imageProcessingConcurrency = runtime.NumCPU()
+	}
+	shareXRouter.imageWorkers = make(chan struct{}, imageProcessingConcurrency)
 	// register endpoints
 	router.Path("/upload").Methods(http.MethodPost).HandlerFunc(shareXRouter.handleUpload)
+	router.Path("/paste").Methods(http.MethodPost).HandlerFunc(shareXRouter.handlePaste)
+	router.Path("/shorten").Methods(http.MethodPost).HandlerFunc(shareXRouter.handleShorten)
+	router.Path("/" + sxcuFilename).Methods(http.MethodGet).HandlerFunc(shareXRouter.handleSXCU)
+	router.Path("/oembed").Methods(http.MethodGet).HandlerFunc(shareXRouter.handleOEmbed)
+	router.Path("/entries").Methods(http.MethodGet).HandlerFunc(shareXRouter.handleQuery)
+	router.Path("/tokens").Methods(http.MethodGet).HandlerFunc(shareXRouter.handleTokenList)
+	router.Path("/tokens").Methods(http.MethodPost).HandlerFunc(shareXRouter.handleTokenIssue)
+	router.Path(fmt.Sprintf("/tokens/{%v}", tokenIDVar)).Methods(http.MethodDelete).
+		HandlerFunc(shareXRouter.handleTokenRevoke)
+	if shareXRouter.ResumableFolder != "" {
+		router.Path("/files").Methods(http.MethodOptions).HandlerFunc(shareXRouter.handleResumableOptions)
+		router.Path("/files").Methods(http.MethodPost).HandlerFunc(shareXRouter.handleResumableCreation)
+		resumableUploadPath := fmt.Sprintf("/files/{%v}", resumableUploadIDVar)
+		router.Path(resumableUploadPath).Methods(http.MethodHead).HandlerFunc(shareXRouter.handleResumableHead)
+		router.Path(resumableUploadPath).Methods(http.MethodPatch).HandlerFunc(shareXRouter.handleResumablePatch)
+		router.Path(resumableUploadPath).Methods(http.MethodDelete).
+			HandlerFunc(shareXRouter.handleResumableTermination)
+	}
+	router.Path(fmt.Sprintf("/delete/{%v}/{%v}", callReferenceVar, deletionTokenVar)).
+		Methods(http.MethodGet, http.MethodDelete).HandlerFunc(shareXRouter.handleDelete)
+	if shareXRouter.ThumbnailSize > 0 {
+		router.Path(fmt.Sprintf("/thumbnail/{%v}", callReferenceVar)).Methods(http.MethodGet, http.MethodHead).
+			HandlerFunc(shareXRouter.handleThumbnail)
+	}
+	router.Path(fmt.Sprintf("/raw/{%v}", callReferenceVar)).HandlerFunc(shareXRouter.handleRawRequest)
 	router.Path(fmt.Sprintf("/{%v}", callReferenceVar)).HandlerFunc(shareXRouter.handleRequest)
 }
 
@@ -32,7 +128,19 @@ func (shareXRouter *ShareXRouter) sendInternalError(writer http.ResponseWriter,
 	log.Printf("An error occurred while doing the action \"%v\", %T: %+v\n", action, err, err)
 }
 
+// sendJSON encodes the given value as JSON and sends it to the client.
+func (shareXRouter *ShareXRouter) sendJSON(writer http.ResponseWriter, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "encoding JSON response", err)
+		return
+	}
+	writer.Header().Set(contentTypeHeader, "application/json")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(data)
+}
+
 // Close stops and closes the ShareX router. It returns an error if something goes wrong.
 func (shareXRouter *ShareXRouter) Close() error {
 	return shareXRouter.Storage.Close()
-}
\ No newline at end of file
+}
@@ -0,0 +1,243 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"github.com/mmichaelb/sharexserver/pkg/storage/storages"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// testPNGData starts with the signature of a PNG file, so its content type is detected as "image/png".
+var testPNGData = []byte("\x89PNG\r\n\x1a\nHello, this is a test!")
+
+// newTestRouter returns a ShareXRouter using a file system storage inside of a temporary folder and its handler. The
+// returned function removes the temporary folder.
+func newTestRouter(t *testing.T) (*ShareXRouter, http.Handler, func()) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-router-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	fileStorage := &storages.FileSystemStorage{DataFolder: dataFolder + "/"}
+	if err := fileStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file storage, %T: %v", err, err)
+	}
+	shareXRouter := &ShareXRouter{
+		Storage:                 fileStorage,
+		WhitelistedContentTypes: []string{"image/png"},
+		AdminToken:              "admin-token",
+		ResumableFolder:         dataFolder + "/resumable/",
+		ThumbnailSize:           16,
+		MaximumResizeDimension:  64,
+		ResizeCacheSize:         1 << 20,
+	}
+	muxRouter := mux.NewRouter()
+	shareXRouter.WrapHandler(muxRouter)
+	return shareXRouter, muxRouter, func() {
+		os.RemoveAll(dataFolder)
+	}
+}
+
+// newUploadRequest returns a multipart upload request which contains the given file data.
+func newUploadRequest(t *testing.T, filename, contentType string, data []byte) *http.Request {
+	body := bytes.NewBuffer([]byte{})
+	multipartWriter := multipart.NewWriter(body)
+	partHeader := make(map[string][]string)
+	partHeader["Content-Disposition"] = []string{`form-data; name="` + multipartFormName + `"; filename="` +
+		filename + `"`}
+	partHeader[contentTypeHeader] = []string{contentType}
+	part, err := multipartWriter.CreatePart(partHeader)
+	if err != nil {
+		t.Fatalf("Could not create multipart part, %T: %v", err, err)
+	}
+	part.Write(data)
+	multipartWriter.Close()
+	request := httptest.NewRequest(http.MethodPost, "/upload", body)
+	request.Header.Set(contentTypeHeader, multipartWriter.FormDataContentType())
+	return request
+}
+
+func TestUploadRequestDelete(t *testing.T) {
+	_, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	testBytes := testPNGData
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newUploadRequest(t, "testfile.png", "image/png", testBytes))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Upload failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	callReference := recorder.Body.String()
+	deletionToken := recorder.Header().Get(deletionTokenHeader)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/"+callReference, nil))
+	if recorder.Code != http.StatusOK || !bytes.Equal(recorder.Body.Bytes(), testBytes) {
+		t.Fatalf("Request failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if disposition := recorder.Header().Get(dispositionHeader); disposition != `inline; filename="testfile.png"` {
+		t.Fatalf("Invalid disposition header %q", disposition)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/delete/"+callReference+"/invalid", nil))
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("Deletion with an invalid token responded with status %d", recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/delete/"+callReference+"/"+deletionToken, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Deletion failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/"+callReference, nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Request of a deleted entry responded with status %d", recorder.Code)
+	}
+}
+
+func TestUploadTTL(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	for ttl, expectedStatus := range map[string]int{"1h": http.StatusOK, "60": http.StatusOK, "-1h": http.StatusBadRequest,
+		"soon": http.StatusBadRequest} {
+		body := bytes.NewBuffer([]byte{})
+		multipartWriter := multipart.NewWriter(body)
+		multipartWriter.WriteField(ttlParameter, ttl)
+		part, _ := multipartWriter.CreateFormFile(multipartFormName, "testfile.png")
+		part.Write([]byte("Hello, this is a test!"))
+		multipartWriter.Close()
+		request := httptest.NewRequest(http.MethodPost, "/upload", body)
+		request.Header.Set(contentTypeHeader, multipartWriter.FormDataContentType())
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != expectedStatus {
+			t.Fatalf("Upload with the ttl %q responded with status %d, expected %d", ttl, recorder.Code,
+				expectedStatus)
+		}
+		if expectedStatus != http.StatusOK {
+			continue
+		}
+		entry, err := shareXRouter.Storage.Request(recorder.Body.String())
+		if err != nil {
+			t.Fatalf("Could not request uploaded entry, %T: %v", err, err)
+		}
+		if ttl, _ := parseTTL(ttl); !entry.ExpiryDate.Equal(entry.UploadDate.Add(ttl)) {
+			t.Fatalf("Invalid expiry date %v of an entry uploaded at %v with the ttl %v", entry.ExpiryDate,
+				entry.UploadDate, ttl)
+		}
+	}
+}
+
+func TestUploadInterrupted(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	// the data is longer than the part which is used to detect the content type, so the entry is stored before the
+	// upload is interrupted
+	request := newUploadRequest(t, "testfile.png", "image/png", bytes.Repeat(testPNGData, 32))
+	// cut off the closing boundary to simulate an interrupted upload
+	body, _ := ioutil.ReadAll(request.Body)
+	request.Body = ioutil.NopCloser(bytes.NewReader(body[:len(body)-20]))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("Interrupted upload responded with status %d", recorder.Code)
+	}
+	// the aborted entry must not be activated but removed as a stale upload
+	deletedEntries, err := shareXRouter.Storage.(storage.SweepableStorage).DeleteStale(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Could not delete stale uploads, %T: %v", err, err)
+	}
+	if len(deletedEntries) != 1 {
+		t.Fatalf("Expected the interrupted upload to be stale, deleted %d entries", len(deletedEntries))
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	shareXRouter.MaximumUploadSize = 16
+	shareXRouter.DefaultQuota = storage.Quota{Bytes: 24, Files: 2}
+	for i, upload := range []struct {
+		data           string
+		expectedStatus int
+	}{
+		{"This is too large for the maximum size", http.StatusRequestEntityTooLarge},
+		{"Hello, this fits", http.StatusOK},
+		{"Exceeds quota", http.StatusTooManyRequests},
+		{"Fits ok!", http.StatusOK},
+		{"!", http.StatusTooManyRequests},
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, newUploadRequest(t, "testfile.png", "image/png", []byte(upload.data)))
+		if recorder.Code != upload.expectedStatus {
+			t.Fatalf("Upload %d responded with status %d, expected %d: %s", i, recorder.Code,
+				upload.expectedStatus, recorder.Body.String())
+		}
+	}
+	usage, err := shareXRouter.Storage.(storage.UsageStorage).Usage(defaultUser)
+	if err != nil {
+		t.Fatalf("Could not resolve storage usage, %T: %v", err, err)
+	}
+	if usage.Bytes != 24 || usage.Files != 2 {
+		t.Fatalf("Invalid storage usage %+v after the rejected uploads", usage)
+	}
+}
+
+func TestUploadContentTypeFilter(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	shareXRouter.AllowedContentTypes = []string{"image/*", "text/*"}
+	shareXRouter.DeniedContentTypes = []string{"text/html"}
+	shareXRouter.DeniedExtensions = []string{"exe", ".HTML"}
+	for i, upload := range []struct {
+		filename       string
+		data           string
+		expectedStatus int
+	}{
+		{"testfile.png", string(testPNGData), http.StatusOK},
+		{"disguised.png", "<html><script>alert(1)</script></html>", http.StatusUnsupportedMediaType},
+		{"testfile.exe", string(testPNGData), http.StatusUnsupportedMediaType},
+		{"testfile.HTML", "Hello, this is a test!", http.StatusUnsupportedMediaType},
+		{"archive.png", "PK\x03\x04", http.StatusUnsupportedMediaType},
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, newUploadRequest(t, upload.filename, "image/png", []byte(upload.data)))
+		if recorder.Code != upload.expectedStatus {
+			t.Fatalf("Upload %d responded with status %d, expected %d: %s", i, recorder.Code,
+				upload.expectedStatus, recorder.Body.String())
+		}
+	}
+}
+
+func TestUploadJSONResponse(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	shareXRouter.PublicURL = "https://sharex.example.com/"
+	request := newUploadRequest(t, "testfile.png", "image/png", testPNGData)
+	request.Header.Set("Accept", "text/html, application/json;q=0.9")
+	request.URL.RawQuery = ttlParameter + "=1h"
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Upload failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	response := &uploadResponse{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("Could not decode upload response, %T: %v", err, err)
+	}
+	expectedURL := "https://sharex.example.com/" + response.CallReference
+	if response.URL != expectedURL || response.RawURL == "" || response.ThumbnailURL == "" ||
+		response.DeletionURL != "https://sharex.example.com/delete/"+response.CallReference+"/"+
+			recorder.Header().Get(deletionTokenHeader) {
+		t.Fatalf("Invalid URLs within the upload response %+v", response)
+	}
+	if response.Size != int64(len(testPNGData)) || response.ContentType != "image/png" ||
+		response.ExpiryDate == nil {
+		t.Fatalf("Invalid metadata within the upload response %+v", response)
+	}
+}
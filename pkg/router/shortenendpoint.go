@@ -0,0 +1,80 @@
+package router
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// shortenedURLParameter is the form value which contains the URL which should be shortened.
+	shortenedURLParameter = "url"
+	// maximumShortenedURLLength is the maximum length of a URL which can be shortened.
+	maximumShortenedURLLength = 8 << 10
+	// redirectContentType is the content type of the stored data of redirect entries.
+	redirectContentType = "text/uri-list"
+)
+
+// handleShorten is the endpoint which stores a shortened URL. The client is redirected to the URL when the returned
+// call reference is requested. The time-to-live can be sent like it is done for file uploads and the response is the
+// same as the one of a file upload.
+func (shareXRouter *ShareXRouter) handleShorten(writer http.ResponseWriter, request *http.Request) {
+	var err error
+	uploader, ok := shareXRouter.authenticateUploader(writer, request)
+	if !ok {
+		return
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, maximumShortenedURLLength+maximumFormValueBytes)
+	if err = request.ParseForm(); err != nil {
+		http.Error(writer, "400 the form is malformed or too large", http.StatusBadRequest)
+		return
+	}
+	target, ok := parseShortenedURL(request.Form.Get(shortenedURLParameter))
+	if !ok {
+		http.Error(writer, "400 the url has to be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	ttl := uploader.DefaultTTL
+	if rawTTL := request.Form.Get(ttlParameter); rawTTL != "" {
+		if ttl, err = parseTTL(rawTTL); err != nil {
+			http.Error(writer, "400 "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	data := target.String()
+	// shortened URLs count towards the quota of the uploader like files
+	limit, ok := shareXRouter.checkUploadLimit(writer, uploader, int64(len(data)))
+	if !ok {
+		return
+	}
+	entry, deletionToken, err := newEntry(uploader.Author, target.Host, redirectContentType, ttl)
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "creating deletion token of shortened url", err)
+		return
+	}
+	entry.Kind = storage.KindRedirect
+	upload := &Upload{Request: request, Entry: entry, Data: strings.NewReader(data)}
+	if !shareXRouter.storeUpload(writer, upload, limit) {
+		return
+	}
+	log.Printf("Created redirect entry %v\n", entry.ID)
+	shareXRouter.sendUploadResponse(writer, request, entry, upload.Size, deletionToken, nil)
+}
+
+// parseShortenedURL parses the given URL which should be shortened. It returns false if it is not an absolute http or
+// https URL, so that the redirect can not be abused to execute scripts.
+func parseShortenedURL(value string) (*url.URL, bool) {
+	if value == "" || len(value) > maximumShortenedURLLength {
+		return nil, false
+	}
+	target, err := url.Parse(value)
+	if err != nil || target.Host == "" {
+		return nil, false
+	}
+	if scheme := strings.ToLower(target.Scheme); scheme != "http" && scheme != "https" {
+		return nil, false
+	}
+	return target, true
+}
@@ -0,0 +1,62 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newShortenRequest returns a request which shortens the given URL.
+func newShortenRequest(target string) *http.Request {
+	form := url.Values{shortenedURLParameter: {target}}
+	request := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(form.Encode()))
+	request.Header.Set(contentTypeHeader, "application/x-www-form-urlencoded")
+	return request
+}
+
+func TestShorten(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	for _, target := range []string{"javascript:alert(1)", "/relative", "ftp://example.com/file"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, newShortenRequest(target))
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("Shortening %q responded with status %d", target, recorder.Code)
+		}
+	}
+	target := "https://example.com/some/long/path?query=value"
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newShortenRequest(target))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Shortening failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	callReference := recorder.Body.String()
+	deletionToken := recorder.Header().Get(deletionTokenHeader)
+	for i := 0; i < 2; i++ {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/"+callReference, nil))
+		if recorder.Code != http.StatusFound || recorder.Header().Get("Location") != target {
+			t.Fatalf("Request responded with status %d and location %q", recorder.Code,
+				recorder.Header().Get("Location"))
+		}
+	}
+	entry, err := shareXRouter.Storage.Request(callReference)
+	if err != nil {
+		t.Fatalf("Could not request shortened url, %T: %v", err, err)
+	}
+	if entry.Hits != 2 {
+		t.Fatalf("Counted %d hits of the shortened url, expected 2", entry.Hits)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/delete/"+callReference+"/"+deletionToken, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Deletion failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/"+callReference, nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Request of a deleted shortened url responded with status %d", recorder.Code)
+	}
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// sxcuVersion is the ShareX version whose custom uploader syntax is used. Newer ShareX versions convert it.
+	sxcuVersion = "13.0.0"
+	// sxcuFilename is the name of the custom uploader file which is offered to the client.
+	sxcuFilename = "sharexserver.sxcu"
+)
+
+// sxcuConfig is the JSON representation of a ShareX custom uploader (.sxcu file).
+type sxcuConfig struct {
+	Version         string            `json:"Version"`
+	Name            string            `json:"Name"`
+	DestinationType string            `json:"DestinationType"`
+	RequestMethod   string            `json:"RequestMethod"`
+	RequestURL      string            `json:"RequestURL"`
+	Headers         map[string]string `json:"Headers,omitempty"`
+	Body            string            `json:"Body"`
+	FileFormName    string            `json:"FileFormName"`
+	URL             string            `json:"URL"`
+	ThumbnailURL    string            `json:"ThumbnailURL"`
+	DeletionURL     string            `json:"DeletionURL"`
+}
+
+// handleSXCU is the endpoint which sends a ShareX custom uploader file which can be imported by the requesting
+// uploader. If the authentication of uploaders is enabled, it contains the access token which was sent by the client.
+func (shareXRouter *ShareXRouter) handleSXCU(writer http.ResponseWriter, request *http.Request) {
+	uploader, ok := shareXRouter.authenticateUploader(writer, request)
+	if !ok {
+		return
+	}
+	baseURL := shareXRouter.publicURL(request)
+	config := &sxcuConfig{
+		Version:         sxcuVersion,
+		Name:            fmt.Sprintf("ShareX Server (%s)", uploader.Author),
+		DestinationType: "ImageUploader, TextUploader, FileUploader",
+		RequestMethod:   http.MethodPost,
+		RequestURL:      baseURL + "/upload",
+		Body:            "MultipartFormData",
+		FileFormName:    multipartFormName,
+		// the response body only contains the call reference of the uploaded entry
+		URL:          viewURL(baseURL, "$response$"),
+		ThumbnailURL: shareXRouter.thumbnailURL(baseURL, "$response$"),
+		DeletionURL:  deletionURL(baseURL, "$response$", "$header:"+deletionTokenHeader+"$"),
+	}
+	if shareXRouter.Tokens != nil {
+		config.Headers = map[string]string{authorizationHeader: bearerPrefix + requestToken(request)}
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "encoding custom uploader", err)
+		return
+	}
+	writer.Header().Set(contentTypeHeader, "application/json")
+	writer.Header().Set(dispositionHeader, fmt.Sprintf(dispositionValueFormat, "attachment", sxcuFilename))
+	// the file may contain the secret token of the uploader
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(data)
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"encoding/json"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"github.com/mmichaelb/sharexserver/pkg/storage/storages"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSXCU(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	shareXRouter.PublicURL = "https://sharex.example.com/"
+	fileTokenStorage := &storages.FileTokenStorage{
+		Filepath: shareXRouter.Storage.(*storages.FileSystemStorage).DataFolder + "access-tokens.json",
+	}
+	if err := fileTokenStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file token storage, %T: %v", err, err)
+	}
+	shareXRouter.Tokens = fileTokenStorage
+	token, secret, err := storage.NewToken("alice")
+	if err != nil {
+		t.Fatalf("Could not create token, %T: %v", err, err)
+	}
+	if err = fileTokenStorage.StoreToken(token); err != nil {
+		t.Fatalf("Could not store token, %T: %v", err, err)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/"+sxcuFilename, nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("Custom uploader request without token responded with status %d", recorder.Code)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/"+sxcuFilename, nil)
+	request.Header.Set(authorizationHeader, bearerPrefix+secret)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Custom uploader request failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	config := &sxcuConfig{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), config); err != nil {
+		t.Fatalf("Could not decode custom uploader, %T: %v", err, err)
+	}
+	if config.RequestURL != "https://sharex.example.com/upload" || config.FileFormName != multipartFormName ||
+		config.URL != "https://sharex.example.com/$response$" ||
+		config.DeletionURL != "https://sharex.example.com/delete/$response$/$header:X-Deletion-Token$" {
+		t.Fatalf("Invalid custom uploader %+v", config)
+	}
+	if config.Headers[authorizationHeader] != bearerPrefix+secret {
+		t.Fatalf("The custom uploader does not contain the access token: %+v", config.Headers)
+	}
+}
@@ -0,0 +1,123 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// handleThumbnail is the endpoint which sends a downscaled version of an image entry. The thumbnail is generated on
+// the first request and stored as a variant of the entry if the storage implements the storage.VariantStorage
+// interface.
+func (shareXRouter *ShareXRouter) handleThumbnail(writer http.ResponseWriter, request *http.Request) {
+	callReference := mux.Vars(request)[callReferenceVar]
+	entry, err := shareXRouter.Storage.Request(callReference)
+	if err == storage.ErrEntryNotFound {
+		http.NotFound(writer, request)
+		return
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, fmt.Sprintf("requesting entry with call reference %v",
+			strconv.Quote(callReference)), err)
+		return
+	}
+	if entry.Kind == storage.KindRedirect || !isDecodableImage(entry.ContentType) {
+		http.Error(writer, "404 there is no thumbnail of this entry", http.StatusNotFound)
+		return
+	}
+	format := derivedImageFormat(entry.ContentType)
+	shareXRouter.sendVariant(writer, request, entry, "thumbnail-"+strconv.Itoa(shareXRouter.ThumbnailSize), format,
+		true, func(source io.ReadSeeker) ([]byte, error) {
+			decodedImage, err := decodeImage(source)
+			if err != nil {
+				return nil, err
+			}
+			bounds := decodedImage.Bounds()
+			width, height := fitDimensions(bounds.Dx(), bounds.Dy(), shareXRouter.ThumbnailSize,
+				shareXRouter.ThumbnailSize)
+			buffer := &bytes.Buffer{}
+			err = encodeImage(buffer, scaleImage(decodedImage, width, height), format)
+			return buffer.Bytes(), err
+		})
+}
+
+// derivedImageFormat returns the default format of thumbnails and resized versions of an image with the given content
+// type. Photos stay JPEG images while all other images become PNG images to keep their transparency.
+func derivedImageFormat(contentType string) string {
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "image/jpeg" {
+		return "jpeg"
+	}
+	return "png"
+}
+
+// sendVariant sends the variant with the given name and format of the given image entry. If the storage does not
+// contain the variant yet, it is generated from the file data by the given function and stored if store is true. The
+// amount of variants which are generated at the same time is limited by the ImageProcessingConcurrency.
+func (shareXRouter *ShareXRouter) sendVariant(writer http.ResponseWriter, request *http.Request, entry *storage.Entry,
+	name, format string, store bool, generate func(source io.ReadSeeker) ([]byte, error)) {
+	contentType, _ := encodedContentType(format)
+	variantStorage, storesVariants := shareXRouter.Storage.(storage.VariantStorage)
+	storesVariants = storesVariants && store
+	if storesVariants {
+		reader, err := variantStorage.RequestVariant(entry.ID, name)
+		if err == nil {
+			if err = reader.Open(); err == nil {
+				defer reader.Close()
+				sendImage(writer, request, entry, contentType, reader)
+				return
+			}
+		}
+		// the variant is generated again if it could not be read
+		if err != storage.ErrVariantNotFound {
+			log.Printf("There was an error while reading the variant %v of the entry %v, %T: %+v\n", name, entry.ID,
+				err, err)
+		}
+	}
+	if err := entry.Reader.Open(); err != nil {
+		shareXRouter.sendInternalError(writer, "opening reader of image entry", err)
+		return
+	}
+	defer entry.Reader.Close()
+	shareXRouter.imageWorkers <- struct{}{}
+	data, err := generate(entry.Reader)
+	<-shareXRouter.imageWorkers
+	if err != nil {
+		log.Printf("There was an error while generating the variant %v of the entry %v, %T: %+v\n", name, entry.ID,
+			err, err)
+		http.Error(writer, "422 the image could not be processed", http.StatusUnprocessableEntity)
+		return
+	}
+	if storesVariants {
+		if err := storeVariant(variantStorage, entry.ID, name, data); err != nil {
+			log.Printf("There was an error while storing the variant %v of the entry %v, %T: %+v\n", name, entry.ID,
+				err, err)
+		}
+	}
+	sendImage(writer, request, entry, contentType, bytes.NewReader(data))
+}
+
+// storeVariant stores the given data as the variant with the given name of the entry with the given ID.
+func storeVariant(variantStorage storage.VariantStorage, id storage.ID, name string, data []byte) error {
+	writer, err := variantStorage.StoreVariant(id, name)
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(data); err != nil {
+		abortFileWriter(writer)
+		return err
+	}
+	return writer.Close()
+}
+
+// sendImage sends the image which is read by the given reader and derived from the given entry.
+func sendImage(writer http.ResponseWriter, request *http.Request, entry *storage.Entry, contentType string,
+	reader io.ReadSeeker) {
+	writer.Header().Set(contentTypeHeader, contentType)
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(writer, request, "", entry.UploadDate, reader)
+}
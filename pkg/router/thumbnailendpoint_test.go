@@ -0,0 +1,56 @@
+package router
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newUploadRequest(t, "screenshot.png", "image/png", newTestImage(t, 64, 32)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Upload failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	callReference := recorder.Body.String()
+	// the second request is served from the stored variant
+	for i := 0; i < 2; i++ {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/thumbnail/"+callReference, nil))
+		if recorder.Code != http.StatusOK || recorder.Header().Get(contentTypeHeader) != "image/png" {
+			t.Fatalf("Thumbnail request responded with status %d and content type %q", recorder.Code,
+				recorder.Header().Get(contentTypeHeader))
+		}
+		config, err := png.DecodeConfig(recorder.Body)
+		if err != nil {
+			t.Fatalf("Could not decode thumbnail, %T: %v", err, err)
+		}
+		if config.Width != 16 || config.Height != 8 {
+			t.Fatalf("Thumbnail has the dimensions %dx%d, expected 16x8", config.Width, config.Height)
+		}
+	}
+	entry, err := shareXRouter.Storage.Request(callReference)
+	if err != nil {
+		t.Fatalf("Could not request entry, %T: %v", err, err)
+	}
+	if _, err := shareXRouter.Storage.(storage.VariantStorage).RequestVariant(entry.ID, "thumbnail-16"); err != nil {
+		t.Fatalf("The thumbnail was not stored as a variant, %T: %v", err, err)
+	}
+	form := url.Values{pasteTextParameter: {"no image"}}
+	request := httptest.NewRequest(http.MethodPost, "/paste", strings.NewReader(form.Encode()))
+	request.Header.Set(contentTypeHeader, "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	textCallReference := recorder.Body.String()
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/thumbnail/"+textCallReference, nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Thumbnail request of a text entry responded with status %d", recorder.Code)
+	}
+}
@@ -0,0 +1,146 @@
+package router
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	tokenIDVar = "tokenid"
+	// form values which contain the quota of an issued token
+	quotaBytesParameter = "quota_bytes"
+	quotaFilesParameter = "quota_files"
+)
+
+// tokenResponse is the JSON representation of a storage.Token. The secret token value is only sent once when the token
+// is issued.
+type tokenResponse struct {
+	ID           string    `json:"id"`
+	Author       string    `json:"author"`
+	Token        string    `json:"token,omitempty"`
+	CreationDate time.Time `json:"creation_date"`
+	// DefaultTTL is the default time-to-live of the uploaded entries in seconds.
+	DefaultTTL int64 `json:"default_ttl,omitempty"`
+	// QuotaBytes and QuotaFiles are the quota of the author of the token.
+	QuotaBytes int64 `json:"quota_bytes,omitempty"`
+	QuotaFiles int   `json:"quota_files,omitempty"`
+}
+
+// newTokenResponse returns the JSON representation of the given token.
+func newTokenResponse(token *storage.Token) *tokenResponse {
+	return &tokenResponse{
+		ID:           token.ID,
+		Author:       string(token.Author),
+		CreationDate: token.CreationDate,
+		DefaultTTL:   int64(token.DefaultTTL / time.Second),
+		QuotaBytes:   token.Quota.Bytes,
+		QuotaFiles:   token.Quota.Files,
+	}
+}
+
+// checkTokenManagement checks whether the client is allowed to manage tokens and sends an error response if not.
+func (shareXRouter *ShareXRouter) checkTokenManagement(writer http.ResponseWriter, request *http.Request) bool {
+	if !shareXRouter.isAdmin(request) {
+		sendUnauthorized(writer)
+		return false
+	}
+	if shareXRouter.Tokens == nil {
+		http.Error(writer, "501 the authentication of uploaders is disabled", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
+
+// handleTokenIssue is the endpoint which issues a new access token for the author sent within the form value "author".
+// The optional form value "ttl" sets the default time-to-live of the entries uploaded with the token and the optional
+// form values "quota_bytes" and "quota_files" set the quota of the author. The endpoint is only accessible with the
+// admin token.
+func (shareXRouter *ShareXRouter) handleTokenIssue(writer http.ResponseWriter, request *http.Request) {
+	if !shareXRouter.checkTokenManagement(writer, request) {
+		return
+	}
+	author := request.FormValue(authorParameter)
+	if author == "" {
+		http.Error(writer, "400 the author parameter is missing", http.StatusBadRequest)
+		return
+	}
+	var defaultTTL time.Duration
+	if rawTTL := request.FormValue(ttlParameter); rawTTL != "" {
+		var err error
+		if defaultTTL, err = parseTTL(rawTTL); err != nil {
+			http.Error(writer, "400 "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var quota storage.Quota
+	if rawQuotaBytes := request.FormValue(quotaBytesParameter); rawQuotaBytes != "" {
+		var err error
+		if quota.Bytes, err = strconv.ParseInt(rawQuotaBytes, 10, 64); err != nil || quota.Bytes < 0 {
+			http.Error(writer, "400 the byte quota has to be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+	if rawQuotaFiles := request.FormValue(quotaFilesParameter); rawQuotaFiles != "" {
+		var err error
+		if quota.Files, err = strconv.Atoi(rawQuotaFiles); err != nil || quota.Files < 0 {
+			http.Error(writer, "400 the file quota has to be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+	token, secret, err := storage.NewToken(storage.AuthorIdentifier(author))
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "creating access token", err)
+		return
+	}
+	token.DefaultTTL = defaultTTL
+	token.Quota = quota
+	if err = shareXRouter.Tokens.StoreToken(token); err != nil {
+		shareXRouter.sendInternalError(writer, "storing access token", err)
+		return
+	}
+	log.Printf("Issued access token %v for %v\n", token.ID, strconv.Quote(author))
+	response := newTokenResponse(token)
+	response.Token = secret
+	shareXRouter.sendJSON(writer, response)
+}
+
+// handleTokenList is the endpoint which lists all issued access tokens without their secret values. The endpoint is
+// only accessible with the admin token.
+func (shareXRouter *ShareXRouter) handleTokenList(writer http.ResponseWriter, request *http.Request) {
+	if !shareXRouter.checkTokenManagement(writer, request) {
+		return
+	}
+	tokens, err := shareXRouter.Tokens.Tokens()
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "listing access tokens", err)
+		return
+	}
+	response := make([]*tokenResponse, len(tokens))
+	for i, token := range tokens {
+		response[i] = newTokenResponse(token)
+	}
+	shareXRouter.sendJSON(writer, response)
+}
+
+// handleTokenRevoke is the endpoint which revokes the access token with the ID stored in the tokenIDVar. The endpoint
+// is only accessible with the admin token.
+func (shareXRouter *ShareXRouter) handleTokenRevoke(writer http.ResponseWriter, request *http.Request) {
+	if !shareXRouter.checkTokenManagement(writer, request) {
+		return
+	}
+	tokenID := mux.Vars(request)[tokenIDVar]
+	if err := shareXRouter.Tokens.RevokeToken(tokenID); err == storage.ErrTokenNotFound {
+		http.NotFound(writer, request)
+		return
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, "revoking access token", err)
+		return
+	}
+	log.Printf("Revoked access token %v\n", tokenID)
+	writer.WriteHeader(http.StatusOK)
+	writer.Write([]byte("the token has been revoked"))
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"encoding/json"
+	"github.com/mmichaelb/sharexserver/pkg/storage/storages"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenAuthentication(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	fileTokenStorage := &storages.FileTokenStorage{
+		Filepath: shareXRouter.Storage.(*storages.FileSystemStorage).DataFolder + "access-tokens.json",
+	}
+	if err := fileTokenStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file token storage, %T: %v", err, err)
+	}
+	shareXRouter.Tokens = fileTokenStorage
+	// issue a new token with the admin token
+	request := httptest.NewRequest(http.MethodPost, "/tokens?author=alice", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("Token issuing without the admin token responded with status %d", recorder.Code)
+	}
+	request.Header.Set(authorizationHeader, bearerPrefix+"admin-token")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Token issuing failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	token := &tokenResponse{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), token); err != nil || token.Token == "" || token.Author != "alice" {
+		t.Fatalf("Invalid token response %+v (error: %v)", token, err)
+	}
+	// uploads are only accepted with a valid token
+	request = newUploadRequest(t, "testfile.png", "image/png", []byte("test"))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("Upload without token responded with status %d", recorder.Code)
+	}
+	request = newUploadRequest(t, "testfile.png", "image/png", []byte("test"))
+	request.Header.Set(authorizationHeader, bearerPrefix+token.Token)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Upload with token failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	entry, err := shareXRouter.Storage.Request(recorder.Body.String())
+	if err != nil {
+		t.Fatalf("Could not request uploaded entry, %T: %v", err, err)
+	}
+	if entry.Author != "alice" {
+		t.Fatalf("The uploaded entry was stamped with the author %q", entry.Author)
+	}
+	// uploaders can only query their own entries
+	request = httptest.NewRequest(http.MethodGet, "/entries?author=bob", nil)
+	request.Header.Set(authorizationHeader, bearerPrefix+token.Token)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	response := &queryResponse{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil || len(response.Entries) != 1 ||
+		response.Entries[0].Author != "alice" {
+		t.Fatalf("Invalid query response %+v (error: %v)", response, err)
+	}
+	// revoked tokens can not be used anymore
+	request = httptest.NewRequest(http.MethodDelete, "/tokens/"+token.ID, nil)
+	request.Header.Set(authorizationHeader, bearerPrefix+"admin-token")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Token revocation failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	request = newUploadRequest(t, "testfile.png", "image/png", []byte("test"))
+	request.Header.Set(authorizationHeader, bearerPrefix+token.Token)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("Upload with a revoked token responded with status %d", recorder.Code)
+	}
+}
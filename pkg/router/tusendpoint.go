@@ -0,0 +1,375 @@
+package router
+
+import (
+	"bufio"
+	"encoding/base64"
+	"github.com/gorilla/mux"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// tusVersion is the only version of the tus protocol (https://tus.io/protocols/resumable-upload.html) which is
+	// supported by the resumable upload endpoints.
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination"
+	// headers of the tus protocol
+	tusResumableHeader = "Tus-Resumable"
+	tusVersionHeader   = "Tus-Version"
+	tusExtensionHeader = "Tus-Extension"
+	uploadLengthHeader = "Upload-Length"
+	uploadOffsetHeader = "Upload-Offset"
+	// uploadMetadataHeader contains comma separated key value pairs whose values are base64 encoded
+	uploadMetadataHeader = "Upload-Metadata"
+	// callReferenceHeader is the response header which contains the call reference of a completed resumable upload
+	callReferenceHeader = "X-Call-Reference"
+	// offsetContentType is the content type of the requests which append data to a resumable upload
+	offsetContentType = "application/offset+octet-stream"
+	// resumableUploadIDVar is the name of the variable which contains the ID of the resumable upload.
+	resumableUploadIDVar = "uploadid"
+	// filenameMetadataKey is the key of the upload metadata which contains the filename of the entry
+	filenameMetadataKey = "filename"
+)
+
+// handleResumableOptions is the endpoint which tells the client which version and extensions of the tus protocol are
+// supported.
+func (shareXRouter *ShareXRouter) handleResumableOptions(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set(tusVersionHeader, tusVersion)
+	writer.Header().Set(tusExtensionHeader, tusExtensions)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// handleResumableCreation is the endpoint which creates a new resumable upload with the length and metadata sent by
+// the client.
+func (shareXRouter *ShareXRouter) handleResumableCreation(writer http.ResponseWriter, request *http.Request) {
+	if !checkTusResumable(writer, request) {
+		return
+	}
+	length, err := strconv.ParseInt(request.Header.Get(uploadLengthHeader), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(writer, "400 the upload length has to be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	metadata, ok := parseUploadMetadata(request.Header.Get(uploadMetadataHeader))
+	if !ok {
+		http.Error(writer, "400 the upload metadata is malformed", http.StatusBadRequest)
+		return
+	}
+	uploader, ok := shareXRouter.authenticateUploader(writer, request)
+	if !ok {
+		return
+	}
+	// the quota is checked again once the upload is completed because other uploads may use it up in the meantime
+	if _, ok = shareXRouter.checkUploadLimit(writer, uploader, length); !ok {
+		return
+	}
+	// the content type can not be detected until the data was received
+	if !shareXRouter.isAllowedExtension(metadata[filenameMetadataKey]) {
+		http.Error(writer, "415 files of this type are not allowed", http.StatusUnsupportedMediaType)
+		return
+	}
+	ttl := uploader.DefaultTTL
+	// the time-to-live chosen by the uploader overrides the default one of the token
+	if rawTTL := metadata[ttlParameter]; rawTTL != "" {
+		if ttl, err = parseTTL(rawTTL); err != nil {
+			http.Error(writer, "400 "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	upload := &resumableUpload{
+		Length:       length,
+		Author:       string(uploader.Author),
+		Filename:     metadata[filenameMetadataKey],
+		TTL:          ttl,
+		CreationDate: time.Now(),
+	}
+	if upload.ID, err = newResumableID(); err != nil {
+		shareXRouter.sendInternalError(writer, "creating ID of resumable upload", err)
+		return
+	}
+	if err = os.MkdirAll(shareXRouter.ResumableFolder, os.ModePerm); err != nil {
+		shareXRouter.sendInternalError(writer, "creating resumable upload folder", err)
+		return
+	}
+	// the data file is created before the state so that a state without data file can not exist
+	dataFile, err := os.OpenFile(shareXRouter.resumableFilepath(upload.ID, resumableDataFileSuffix),
+		os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "creating data file of resumable upload", err)
+		return
+	}
+	dataFile.Close()
+	if err = shareXRouter.writeResumableUpload(upload); err != nil {
+		shareXRouter.sendInternalError(writer, "writing state of resumable upload", err)
+		return
+	}
+	writer.Header().Set(tusResumableHeader, tusVersion)
+	writer.Header().Set("Location", strings.TrimSuffix(request.URL.Path, "/")+"/"+upload.ID)
+	// uploads without any data are completed right away
+	if upload.Length == 0 {
+		if !shareXRouter.lockResumableUpload(upload.ID) {
+			writer.WriteHeader(http.StatusLocked)
+			return
+		}
+		defer shareXRouter.unlockResumableUpload(upload.ID)
+		if !shareXRouter.completeResumableUpload(writer, request, uploader, upload) {
+			return
+		}
+	}
+	writer.WriteHeader(http.StatusCreated)
+}
+
+// handleResumableHead is the endpoint which tells the client how many bytes of a resumable upload were received.
+func (shareXRouter *ShareXRouter) handleResumableHead(writer http.ResponseWriter, request *http.Request) {
+	if !checkTusResumable(writer, request) {
+		return
+	}
+	upload, _, ok := shareXRouter.requestResumableUpload(writer, request)
+	if !ok {
+		return
+	}
+	offset, err := shareXRouter.resumableOffset(upload)
+	if os.IsNotExist(err) {
+		http.NotFound(writer, request)
+		return
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, "resolving offset of resumable upload", err)
+		return
+	}
+	writer.Header().Set(tusResumableHeader, tusVersion)
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.Header().Set(uploadOffsetHeader, strconv.FormatInt(offset, 10))
+	writer.Header().Set(uploadLengthHeader, strconv.FormatInt(upload.Length, 10))
+	if upload.isCompleted() {
+		writer.Header().Set(callReferenceHeader, upload.CallReference)
+	}
+	writer.WriteHeader(http.StatusOK)
+}
+
+// handleResumablePatch is the endpoint which appends the received data to a resumable upload. The upload is stored as
+// a normal entry as soon as all of its data was received.
+func (shareXRouter *ShareXRouter) handleResumablePatch(writer http.ResponseWriter, request *http.Request) {
+	if !checkTusResumable(writer, request) {
+		return
+	}
+	if request.Header.Get(contentTypeHeader) != offsetContentType {
+		http.Error(writer, "415 the content type has to be "+offsetContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(request.Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(writer, "400 the upload offset has to be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	upload, uploader, ok := shareXRouter.requestResumableUpload(writer, request)
+	if !ok {
+		return
+	}
+	// only one request may append data at the same time
+	if !shareXRouter.lockResumableUpload(upload.ID) {
+		http.Error(writer, "423 the upload is used by another request", http.StatusLocked)
+		return
+	}
+	defer shareXRouter.unlockResumableUpload(upload.ID)
+	currentOffset, err := shareXRouter.resumableOffset(upload)
+	if os.IsNotExist(err) {
+		http.NotFound(writer, request)
+		return
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, "resolving offset of resumable upload", err)
+		return
+	}
+	if offset != currentOffset || upload.isCompleted() {
+		http.Error(writer, "409 the upload offset does not match the received data", http.StatusConflict)
+		return
+	}
+	dataFile, err := os.OpenFile(shareXRouter.resumableFilepath(upload.ID, resumableDataFileSuffix),
+		os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "opening data file of resumable upload", err)
+		return
+	}
+	// the data which was received before the connection was interrupted is kept so the client is able to resume
+	written, copyErr := io.Copy(dataFile, io.LimitReader(request.Body, upload.Length-currentOffset))
+	if err = dataFile.Close(); err != nil {
+		shareXRouter.sendInternalError(writer, "closing data file of resumable upload", err)
+		return
+	}
+	currentOffset += written
+	if copyErr != nil {
+		log.Printf("Receiving data of resumable upload %v was interrupted after %v bytes, %T: %+v\n", upload.ID,
+			written, copyErr, copyErr)
+		http.Error(writer, "400 the data could not be received completely", http.StatusBadRequest)
+		return
+	}
+	writer.Header().Set(tusResumableHeader, tusVersion)
+	writer.Header().Set(uploadOffsetHeader, strconv.FormatInt(currentOffset, 10))
+	if currentOffset == upload.Length && !shareXRouter.completeResumableUpload(writer, request, uploader, upload) {
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// handleResumableTermination is the endpoint which aborts a resumable upload and removes its received data.
+func (shareXRouter *ShareXRouter) handleResumableTermination(writer http.ResponseWriter, request *http.Request) {
+	if !checkTusResumable(writer, request) {
+		return
+	}
+	upload, _, ok := shareXRouter.requestResumableUpload(writer, request)
+	if !ok {
+		return
+	}
+	if !shareXRouter.lockResumableUpload(upload.ID) {
+		http.Error(writer, "423 the upload is used by another request", http.StatusLocked)
+		return
+	}
+	defer shareXRouter.unlockResumableUpload(upload.ID)
+	if err := shareXRouter.removeResumableUpload(upload.ID); os.IsNotExist(err) {
+		http.NotFound(writer, request)
+		return
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, "removing resumable upload", err)
+		return
+	}
+	writer.Header().Set(tusResumableHeader, tusVersion)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// requestResumableUpload reads the resumable upload which is requested by the client and returns it together with
+// the authenticated uploader. If the upload does not exist or belongs to another uploader, an error response is sent
+// and false is returned.
+func (shareXRouter *ShareXRouter) requestResumableUpload(writer http.ResponseWriter,
+	request *http.Request) (*resumableUpload, *storage.Token, bool) {
+	upload, err := shareXRouter.readResumableUpload(mux.Vars(request)[resumableUploadIDVar])
+	if os.IsNotExist(err) {
+		http.NotFound(writer, request)
+		return nil, nil, false
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, "reading state of resumable upload", err)
+		return nil, nil, false
+	}
+	uploader, ok := shareXRouter.authenticateUploader(writer, request)
+	if !ok {
+		return nil, nil, false
+	}
+	// the uploads of other uploaders are treated as if they do not exist
+	if string(uploader.Author) != upload.Author {
+		http.NotFound(writer, request)
+		return nil, nil, false
+	}
+	return upload, uploader, true
+}
+
+// completeResumableUpload stores the received data of the given resumable upload of the uploader as a new entry and
+// sends its call reference and deletion token within the response headers. The upload has to be locked by the caller.
+// If something goes wrong, an error response is sent and false is returned.
+func (shareXRouter *ShareXRouter) completeResumableUpload(writer http.ResponseWriter, request *http.Request,
+	uploader *storage.Token, upload *resumableUpload) bool {
+	// the quota may have been used up by other uploads since the upload was created
+	limit, ok := shareXRouter.checkUploadLimit(writer, uploader, upload.Length)
+	if !ok {
+		// the upload can not be completed anymore
+		if err := shareXRouter.removeResumableUpload(upload.ID); err != nil {
+			log.Printf("Could not remove rejected resumable upload %v, %T: %+v\n", upload.ID, err, err)
+		}
+		return false
+	}
+	dataFilepath := shareXRouter.resumableFilepath(upload.ID, resumableDataFileSuffix)
+	dataFile, err := os.Open(dataFilepath)
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "opening data file of resumable upload", err)
+		return false
+	}
+	defer dataFile.Close()
+	// the content type sent by the client is ignored because it can be chosen arbitrarily
+	fileReader := bufio.NewReaderSize(dataFile, sniffLength)
+	contentType, err := sniffContentType(fileReader)
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "detecting content type of resumable upload", err)
+		return false
+	}
+	if !shareXRouter.isAllowedContentType(contentType) {
+		// the upload can not be completed anymore
+		if err = shareXRouter.removeResumableUpload(upload.ID); err != nil {
+			log.Printf("Could not remove rejected resumable upload %v, %T: %+v\n", upload.ID, err, err)
+		}
+		http.Error(writer, "415 files of this type are not allowed", http.StatusUnsupportedMediaType)
+		return false
+	}
+	// the time-to-live starts when the upload is completed
+	entry, deletionToken, err := newEntry(storage.AuthorIdentifier(upload.Author), upload.Filename, contentType,
+		upload.TTL)
+	if err != nil {
+		shareXRouter.sendInternalError(writer, "creating deletion token of resumable upload", err)
+		return false
+	}
+	var fileData io.Reader = fileReader
+	var stripper *metadataStripper
+	if shareXRouter.stripsMetadata(contentType) {
+		stripper = newMetadataStripper(fileReader, contentType)
+		fileData = stripper
+	}
+	storedUpload := &Upload{Request: request, Entry: entry, Data: fileData}
+	if !shareXRouter.storeUpload(writer, storedUpload, limit) {
+		return false
+	}
+	log.Printf("Created entry %v (%v bytes) from resumable upload %v\n", entry.ID, storedUpload.Size, upload.ID)
+	// the state is kept until the upload is removed by the cleanup so the client can still resolve the call reference
+	upload.CallReference = entry.CallReference
+	if err = shareXRouter.writeResumableUpload(upload); err != nil {
+		shareXRouter.sendInternalError(writer, "writing state of resumable upload", err)
+		return false
+	}
+	if err = os.Remove(dataFilepath); err != nil {
+		log.Printf("Could not remove data file of resumable upload %v, %T: %+v\n", upload.ID, err, err)
+	}
+	writer.Header().Set(callReferenceHeader, entry.CallReference)
+	writer.Header().Set(deletionTokenHeader, deletionToken)
+	if removedMetadata := stripper.removedMetadata(); len(removedMetadata) > 0 {
+		writer.Header().Set(removedMetadataHeader, strings.Join(removedMetadata, ","))
+	}
+	return true
+}
+
+// checkTusResumable checks whether the client uses the supported version of the tus protocol. If it does not, an
+// error response is sent and false is returned.
+func checkTusResumable(writer http.ResponseWriter, request *http.Request) bool {
+	if request.Header.Get(tusResumableHeader) == tusVersion {
+		return true
+	}
+	writer.Header().Set(tusVersionHeader, tusVersion)
+	http.Error(writer, "412 the tus version "+tusVersion+" is required", http.StatusPreconditionFailed)
+	return false
+}
+
+// parseUploadMetadata decodes the key value pairs of the Upload-Metadata header. It returns false if the header is
+// malformed.
+func parseUploadMetadata(value string) (map[string]string, bool) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(value) == "" {
+		return metadata, true
+	}
+	for _, pair := range strings.Split(value, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, false
+		}
+		// keys without a value are allowed by the protocol
+		if len(fields) == 1 {
+			metadata[fields[0]] = ""
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, false
+		}
+		metadata[fields[0]] = string(decoded)
+	}
+	return metadata, true
+}
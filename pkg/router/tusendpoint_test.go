@@ -0,0 +1,174 @@
+package router
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/gorilla/mux"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTusRequest returns a request of the tus protocol with the given method, path and body.
+func newTusRequest(method, path string, body []byte) *http.Request {
+	request := httptest.NewRequest(method, path, bytes.NewReader(body))
+	request.Header.Set(tusResumableHeader, tusVersion)
+	return request
+}
+
+// newTusPatchRequest returns a request which appends the given data at the given offset.
+func newTusPatchRequest(path string, offset int, data []byte) *http.Request {
+	request := newTusRequest(http.MethodPatch, path, data)
+	request.Header.Set(contentTypeHeader, offsetContentType)
+	request.Header.Set(uploadOffsetHeader, strconv.Itoa(offset))
+	return request
+}
+
+func TestResumableUpload(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	testBytes := testPNGData
+	request := newTusRequest(http.MethodPost, "/files", nil)
+	request.Header.Set(uploadLengthHeader, strconv.Itoa(len(testBytes)))
+	request.Header.Set(uploadMetadataHeader, "filename "+base64.StdEncoding.EncodeToString([]byte("testfile.png"))+
+		",filetype "+base64.StdEncoding.EncodeToString([]byte("image/png")))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Creation failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	location := recorder.Header().Get("Location")
+	half := len(testBytes) / 2
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newTusPatchRequest(location, 0, testBytes[:half]))
+	if recorder.Code != http.StatusNoContent || recorder.Header().Get(uploadOffsetHeader) != strconv.Itoa(half) {
+		t.Fatalf("Patch failed with status %d and offset %q", recorder.Code, recorder.Header().Get(uploadOffsetHeader))
+	}
+	// a new router with the same resumable folder simulates a restart of the server
+	restartedRouter := &ShareXRouter{Storage: shareXRouter.Storage, ResumableFolder: shareXRouter.ResumableFolder}
+	muxRouter := mux.NewRouter()
+	restartedRouter.WrapHandler(muxRouter)
+	handler = muxRouter
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newTusRequest(http.MethodHead, location, nil))
+	if recorder.Code != http.StatusOK || recorder.Header().Get(uploadOffsetHeader) != strconv.Itoa(half) {
+		t.Fatalf("Head responded with status %d and offset %q", recorder.Code, recorder.Header().Get(uploadOffsetHeader))
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newTusPatchRequest(location, 0, testBytes))
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("Patch with a wrong offset responded with status %d", recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newTusPatchRequest(location, half, testBytes[half:]))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("Final patch failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	callReference := recorder.Header().Get(callReferenceHeader)
+	if callReference == "" || recorder.Header().Get(deletionTokenHeader) == "" {
+		t.Fatalf("The completed upload did not respond with a call reference and a deletion token")
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/"+callReference, nil))
+	if recorder.Code != http.StatusOK || !bytes.Equal(recorder.Body.Bytes(), testBytes) {
+		t.Fatalf("Request failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get(contentTypeHeader); contentType != "image/png" {
+		t.Fatalf("Invalid content type %q of the completed upload", contentType)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newTusRequest(http.MethodHead, location, nil))
+	if recorder.Header().Get(callReferenceHeader) != callReference {
+		t.Fatalf("Head of the completed upload did not respond with its call reference")
+	}
+	if removed, err := restartedRouter.DeleteStaleResumableUploads(time.Now().Add(time.Minute)); err != nil ||
+		removed != 1 {
+		t.Fatalf("Removed %d stale resumable uploads, expected 1 (error: %v)", removed, err)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newTusRequest(http.MethodHead, location, nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Head of a removed upload responded with status %d", recorder.Code)
+	}
+}
+
+func TestResumableUploadQuota(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	shareXRouter.DefaultQuota = storage.Quota{Files: 1}
+	request := newTusRequest(http.MethodPost, "/files", nil)
+	request.Header.Set(uploadLengthHeader, strconv.Itoa(len(testPNGData)))
+	request.Header.Set(uploadMetadataHeader, "filename "+base64.StdEncoding.EncodeToString([]byte("testfile.png")))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Creation failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	location := recorder.Header().Get("Location")
+	// the quota is used up by another upload while the resumable upload is in progress
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newUploadRequest(t, "testfile.png", "image/png", testPNGData))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Upload failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newTusPatchRequest(location, 0, testPNGData))
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("Completion exceeding the quota responded with status %d: %s", recorder.Code,
+			recorder.Body.String())
+	}
+	usage, err := shareXRouter.Storage.(storage.UsageStorage).Usage(defaultUser)
+	if err != nil {
+		t.Fatalf("Could not resolve storage usage, %T: %v", err, err)
+	}
+	if usage.Files != 1 {
+		t.Fatalf("Invalid storage usage %+v after the rejected completion", usage)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newTusRequest(http.MethodHead, location, nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("Head of the rejected upload responded with status %d", recorder.Code)
+	}
+}
+
+func TestStaleResumableUploads(t *testing.T) {
+	shareXRouter, handler, cleanup := newTestRouter(t)
+	defer cleanup()
+	request := newTusRequest(http.MethodPost, "/files", nil)
+	request.Header.Set(uploadLengthHeader, strconv.Itoa(len(testPNGData)))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Creation failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	location := recorder.Header().Get("Location")
+	id := location[strings.LastIndex(location, "/")+1:]
+	// the upload was created two days ago, but data was received for it just now
+	twoDaysAgo := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(shareXRouter.resumableFilepath(id, resumableInfoFileSuffix), twoDaysAgo,
+		twoDaysAgo); err != nil {
+		t.Fatalf("Could not change the modification time of the upload, %T: %v", err, err)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, newTusPatchRequest(location, 0, testPNGData[:1]))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("Patch failed with status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	inactiveSince := time.Now().Add(-24 * time.Hour)
+	if removed, err := shareXRouter.DeleteStaleResumableUploads(inactiveSince); err != nil || removed != 0 {
+		t.Fatalf("Removed %d resumable uploads which are still continued (error: %v)", removed, err)
+	}
+	// the upload is stale once no data was received for it anymore
+	if err := os.Chtimes(shareXRouter.resumableFilepath(id, resumableDataFileSuffix), twoDaysAgo,
+		twoDaysAgo); err != nil {
+		t.Fatalf("Could not change the modification time of the upload, %T: %v", err, err)
+	}
+	if removed, err := shareXRouter.DeleteStaleResumableUploads(inactiveSince); err != nil || removed != 1 {
+		t.Fatalf("Removed %d stale resumable uploads, expected 1 (error: %v)", removed, err)
+	}
+}
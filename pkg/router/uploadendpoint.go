@@ -1,85 +1,292 @@
 package router
 
 import (
+	"bufio"
+	"errors"
 	"github.com/mmichaelb/sharexserver/pkg/storage"
 	"io"
+	"io/ioutil"
 	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	maximumMemoryBytes = 1 << 20 // 1 MB maximum in memory
-	receiveBufferSize  = 1 << 20 // 1 MB maximum in memory here too
-	defaultUser        = "default user"
-	multipartFormName  = "file"
+	receiveBufferSize = 1 << 20 // 1 MB maximum in memory
+	defaultUser       = "default user"
+	multipartFormName = "file"
+	// maximumFormValueBytes is the maximum size of a form value which precedes the file part
+	maximumFormValueBytes = 1 << 10
+	// deletionTokenHeader is the response header which contains the secret token to delete the uploaded entry
+	deletionTokenHeader = "X-Deletion-Token"
+	// ttlParameter is the form value which contains the time-to-live of an uploaded entry or the default one of a token
+	ttlParameter = "ttl"
 )
 
-// handleUpload is the endpoint which handles new file upload requests.
+// uploadResponse is the JSON representation of an uploaded entry. It is only sent to clients which accept JSON.
+type uploadResponse struct {
+	entryResponse
+	// Size is the size of the file data in bytes.
+	Size   int64  `json:"size"`
+	URL    string `json:"url"`
+	RawURL string `json:"raw_url"`
+	// ThumbnailURL is only set for images.
+	ThumbnailURL  string `json:"thumbnail_url,omitempty"`
+	DeletionURL   string `json:"deletion_url"`
+	DeletionToken string `json:"deletion_token"`
+	// RemovedMetadata contains the kinds of metadata which were removed from an uploaded image, e.g. "exif".
+	RemovedMetadata []string `json:"removed_metadata,omitempty"`
+}
+
+// errInvalidTTL is returned by parseTTL if the time-to-live could not be parsed.
+var errInvalidTTL = errors.New("the time-to-live has to be a positive duration like \"24h\" or an amount of seconds")
+
+// handleUpload is the endpoint which handles new file upload requests. The file part of the multipart form is
+// streamed directly into the storage, so form values have to be sent before it. The time-to-live can also be sent as
+// a query parameter.
 func (shareXRouter *ShareXRouter) handleUpload(writer http.ResponseWriter, request *http.Request) {
 	var err error
-	// parse multipart form file and if something goes wrong return an internal server error response code
-	if err = request.ParseMultipartForm(maximumMemoryBytes); err != nil {
-		shareXRouter.sendInternalError(writer, "parsing multiform of file upload", err)
+	uploader, ok := shareXRouter.authenticateUploader(writer, request)
+	if !ok {
 		return
 	}
-	var file multipart.File
-	// parse filename and mime type from multipart header
-	var multipartFileHeader *multipart.FileHeader
-	if file, multipartFileHeader, err = request.FormFile(multipartFormName); err != nil {
-		shareXRouter.sendInternalError(writer, "resolving file details of file upload", err)
+	ttl := uploader.DefaultTTL
+	multipartReader, err := request.MultipartReader()
+	if err != nil {
+		http.Error(writer, "400 the upload has to be a multipart form", http.StatusBadRequest)
 		return
 	}
-	// instantiate new entry from the given values
-	fileName := multipartFileHeader.Filename
-	mimeType := multipartFileHeader.Header.Get(contentTypeHeader)
-	entry := &storage.Entry{
-		Author:      defaultUser,
-		Filename:    fileName,
-		ContentType: mimeType,
-		UploadDate:  time.Now(),
-	}
-	var fileWriter io.WriteCloser
-	// store entry
-	if fileWriter, err = shareXRouter.Storage.Store(entry); err != nil {
-		shareXRouter.sendInternalError(writer, "storing new file entry", err)
-		return
+	rawTTL := request.URL.Query().Get(ttlParameter)
+	// skip all parts until the file part was found and remember the form values preceding it
+	var file *multipart.Part
+	for file == nil {
+		part, err := multipartReader.NextPart()
+		if err == io.EOF {
+			http.Error(writer, "400 the multipart form does not contain a file", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(writer, "400 the multipart form is malformed", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case part.FormName() == multipartFormName && part.FileName() != "":
+			file = part
+		case part.FormName() == ttlParameter:
+			value, err := ioutil.ReadAll(io.LimitReader(part, maximumFormValueBytes))
+			if err != nil {
+				http.Error(writer, "400 the multipart form is malformed", http.StatusBadRequest)
+				return
+			}
+			rawTTL = string(value)
+		}
 	}
-	// write file data to the returned writer
-	defer func() {
-		if err := fileWriter.Close(); err != nil {
-			log.Printf("There was an error while closing the file writer, %T: %+v", err, err)
+	defer file.Close()
+	// the time-to-live chosen by the uploader overrides the default one of the token
+	if rawTTL != "" {
+		if ttl, err = parseTTL(rawTTL); err != nil {
+			http.Error(writer, "400 "+err.Error(), http.StatusBadRequest)
+			return
 		}
-	}()
-	total, err := writeFile(file, fileWriter)
+	}
+	// the size of the file is not known until it was received completely
+	limit, ok := shareXRouter.checkUploadLimit(writer, uploader, -1)
+	if !ok {
+		return
+	}
+	// the content type sent by the client is ignored because it can be chosen arbitrarily
+	fileReader := bufio.NewReaderSize(file, sniffLength)
+	mimeType, err := sniffContentType(fileReader)
+	if err != nil {
+		log.Printf("Receiving file data was interrupted while detecting the content type, %T: %+v\n", err, err)
+		http.Error(writer, "400 the file data could not be received completely", http.StatusBadRequest)
+		return
+	}
+	fileName := file.FileName()
+	if !shareXRouter.isAllowedUpload(mimeType, fileName) {
+		http.Error(writer, "415 files of this type are not allowed", http.StatusUnsupportedMediaType)
+		return
+	}
+	// instantiate new entry from the given values
+	entry, deletionToken, err := newEntry(uploader.Author, fileName, mimeType, ttl)
 	if err != nil {
-		shareXRouter.sendInternalError(writer, "writing file data to new entry", err)
+		shareXRouter.sendInternalError(writer, "creating deletion token of file upload", err)
+		return
+	}
+	var fileData io.Reader = fileReader
+	var stripper *metadataStripper
+	if shareXRouter.stripsMetadata(mimeType) {
+		stripper = newMetadataStripper(fileReader, mimeType)
+		fileData = stripper
+	}
+	upload := &Upload{Request: request, Entry: entry, Data: fileData}
+	if !shareXRouter.storeUpload(writer, upload, limit) {
+		return
+	}
+	log.Printf("Created entry %v (%v bytes)\n", entry.ID, upload.Size)
+	shareXRouter.sendUploadResponse(writer, request, entry, upload.Size, deletionToken, stripper.removedMetadata())
+}
+
+// sendUploadResponse sends the response to a successful upload of the given entry with the given size and the kinds
+// of metadata which were removed from it.
+func (shareXRouter *ShareXRouter) sendUploadResponse(writer http.ResponseWriter, request *http.Request,
+	entry *storage.Entry, size int64, deletionToken string, removedMetadata []string) {
+	// send back entry url and the deletion token which is only known by the uploader
+	writer.Header().Set(deletionTokenHeader, deletionToken)
+	if len(removedMetadata) > 0 {
+		writer.Header().Set(removedMetadataHeader, strings.Join(removedMetadata, ","))
+	}
+	if acceptsJSON(request) {
+		response := shareXRouter.newUploadResponse(request, entry, size, deletionToken)
+		response.RemovedMetadata = removedMetadata
+		shareXRouter.sendJSON(writer, response)
 		return
 	}
-	log.Printf("Created entry %v (%v bytes)\n", entry.ID, total)
-	// send back entry url
 	writer.WriteHeader(http.StatusOK)
 	// there is no need of writing the whole url - therefore only the call reference if written
 	writer.Write([]byte(entry.CallReference))
 }
 
-// writeFile writes the received uploaded data to the provided writer by the stored entry
-func writeFile(file multipart.File, fileWriter io.WriteCloser) (int64, error) {
+// newUploadResponse returns the JSON representation of the given uploaded entry.
+func (shareXRouter *ShareXRouter) newUploadResponse(request *http.Request, entry *storage.Entry, size int64,
+	deletionToken string) *uploadResponse {
+	baseURL := shareXRouter.publicURL(request)
+	response := &uploadResponse{
+		entryResponse: *newEntryResponse(entry),
+		Size:          size,
+		URL:           viewURL(baseURL, entry.CallReference),
+		RawURL:        rawURL(baseURL, entry.CallReference),
+		DeletionURL:   deletionURL(baseURL, entry.CallReference, deletionToken),
+		DeletionToken: deletionToken,
+	}
+	if entry.Kind != storage.KindRedirect && isDecodableImage(entry.ContentType) {
+		response.ThumbnailURL = shareXRouter.thumbnailURL(baseURL, entry.CallReference)
+	}
+	return response
+}
+
+// acceptsJSON checks whether the client accepts a JSON response. Other clients like ShareX receive plain text.
+func acceptsJSON(request *http.Request) bool {
+	return acceptsMediaType(request, "application/json")
+}
+
+// acceptsMediaType checks whether the client explicitly accepts the given media type. Wildcards like "*/*" are not
+// taken into account.
+func acceptsMediaType(request *http.Request, expectedMediaType string) bool {
+	for _, accepted := range strings.Split(request.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accepted); err == nil && mediaType == expectedMediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateUploader returns the token of the uploader if the authentication is enabled. Otherwise a token of the
+// default user is returned. If the uploader could not be authenticated, an error response is sent and false is
+// returned.
+func (shareXRouter *ShareXRouter) authenticateUploader(writer http.ResponseWriter,
+	request *http.Request) (*storage.Token, bool) {
+	if shareXRouter.Tokens == nil {
+		return &storage.Token{Author: storage.AuthorIdentifier(defaultUser)}, true
+	}
+	token, err := shareXRouter.authenticate(request)
+	if err == storage.ErrTokenNotFound {
+		sendUnauthorized(writer)
+		return nil, false
+	} else if err != nil {
+		shareXRouter.sendInternalError(writer, "authenticating uploader", err)
+		return nil, false
+	}
+	return token, true
+}
+
+// newEntry returns a new entry with the given values which expires after the given time-to-live if it is not zero. It
+// also returns the token which allows the uploader to delete the entry later on.
+func newEntry(author storage.AuthorIdentifier, filename, contentType string,
+	ttl time.Duration) (*storage.Entry, string, error) {
+	deletionToken, deletionHash, err := storage.NewDeletionToken()
+	if err != nil {
+		return nil, "", err
+	}
+	entry := &storage.Entry{
+		Kind:         storage.KindFile,
+		Author:       author,
+		Filename:     filename,
+		ContentType:  contentType,
+		UploadDate:   time.Now(),
+		DeletionHash: deletionHash,
+	}
+	if ttl > 0 {
+		entry.ExpiryDate = entry.UploadDate.Add(ttl)
+	}
+	return entry, deletionToken, nil
+}
+
+// parseTTL parses a time-to-live which is either a duration like "24h" or an amount of seconds.
+func parseTTL(value string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		var seconds int64
+		if seconds, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, errInvalidTTL
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl <= 0 {
+		return 0, errInvalidTTL
+	}
+	return ttl, nil
+}
+
+// writeFile writes the received file data to the writer returned by the storage. The writer is left open, so the
+// caller decides whether the entry is activated by closing it. If the data could not be received or written
+// completely or exceeds the given limit, the upload is aborted, an error response is sent and false is returned. A nil
+// limit means that the size of the data is unlimited.
+func (shareXRouter *ShareXRouter) writeFile(writer http.ResponseWriter, file io.Reader, fileWriter io.WriteCloser,
+	limit *uploadLimit) (int64, bool) {
 	// count total byte amount
 	var total int64
+	buffer := make([]byte, receiveBufferSize)
 	// do not stop iterating until no more bytes are available
 	for {
-		buffer := make([]byte, receiveBufferSize)
-		bytesRead, err := file.Read(buffer)
-		total += int64(bytesRead)
-		if bytesRead == 0 {
+		bytesRead, readErr := file.Read(buffer)
+		if limit != nil && total+int64(bytesRead) > limit.bytes {
+			// the data is not written at all, so an oversized upload never reaches the storage
+			abortFileWriter(fileWriter)
+			limit.send(writer)
+			return -1, false
+		}
+		if bytesRead > 0 {
+			if _, err := fileWriter.Write(buffer[:bytesRead]); err != nil {
+				abortFileWriter(fileWriter)
+				shareXRouter.sendInternalError(writer, "writing file data to new entry", err)
+				return -1, false
+			}
+			total += int64(bytesRead)
+		}
+		if readErr == io.EOF {
 			break
-		} else if err != nil {
-			return -1, err
-		} else {
-			fileWriter.Write(buffer[:bytesRead])
+		} else if rejection, ok := readErr.(*Rejection); ok {
+			// the data was rejected while it was read by a hook
+			abortFileWriter(fileWriter)
+			rejection.send(writer)
+			return -1, false
+		} else if readErr != nil {
+			abortFileWriter(fileWriter)
+			log.Printf("Receiving file data was interrupted after %v bytes, %T: %+v\n", total, readErr, readErr)
+			http.Error(writer, "400 the file data could not be received completely", http.StatusBadRequest)
+			return -1, false
 		}
 	}
-	return total, nil
+	return total, true
+}
+
+// abortFileWriter aborts the upload of the given writer and logs occurring errors.
+func abortFileWriter(fileWriter io.WriteCloser) {
+	if err := storage.Abort(fileWriter); err != nil {
+		log.Printf("There was an error while aborting the file writer, %T: %+v\n", err, err)
+	}
 }
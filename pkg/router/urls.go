@@ -0,0 +1,49 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// publicURL returns the configured public URL without a trailing slash. If none is configured, it is derived from the
+// given request.
+func (shareXRouter *ShareXRouter) publicURL(request *http.Request) string {
+	if shareXRouter.PublicURL != "" {
+		return strings.TrimSuffix(shareXRouter.PublicURL, "/")
+	}
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host
+}
+
+// viewURL returns the URL which is shared to view the entry with the given call reference.
+func viewURL(baseURL, callReference string) string {
+	return baseURL + "/" + callReference
+}
+
+// rawURL returns the URL which serves the file data of the entry with the given call reference.
+func rawURL(baseURL, callReference string) string {
+	return baseURL + "/raw/" + callReference
+}
+
+// thumbnailURL returns the URL of the thumbnail of the entry with the given call reference.
+func (shareXRouter *ShareXRouter) thumbnailURL(baseURL, callReference string) string {
+	if shareXRouter.ThumbnailSize <= 0 {
+		// the thumbnails are disabled, so the file data itself is used
+		return rawURL(baseURL, callReference)
+	}
+	return baseURL + "/thumbnail/" + callReference
+}
+
+// oEmbedURL returns the URL of the oEmbed endpoint which describes the entry shared with the given URL.
+func oEmbedURL(baseURL, entryURL string) string {
+	return baseURL + "/oembed?format=json&url=" + url.QueryEscape(entryURL)
+}
+
+// deletionURL returns the URL which deletes the entry with the given call reference.
+func deletionURL(baseURL, callReference, deletionToken string) string {
+	return baseURL + "/delete/" + callReference + "/" + deletionToken
+}
@@ -0,0 +1,19 @@
+package storage
+
+import "io"
+
+// Aborter is implemented by the writers returned by the FileStorage.Store method which are able to discard an upload
+// that could not be completed. Closing such a writer instead would store the partial file data as a complete entry.
+type Aborter interface {
+	// Abort discards the written data and closes the writer. The entry is marked as failed and is therefore never
+	// returned by the FileStorage.Request method. It returns an error if something goes wrong.
+	Abort() error
+}
+
+// Abort aborts the given writer if it implements the Aborter interface and closes it otherwise.
+func Abort(writer io.WriteCloser) error {
+	if aborter, ok := writer.(Aborter); ok {
+		return aborter.Abort()
+	}
+	return writer.Close()
+}
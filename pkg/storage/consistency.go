@@ -0,0 +1,76 @@
+package storage
+
+import "time"
+
+// ProblemKind describes which kind of inconsistency was found by a consistency check.
+type ProblemKind string
+
+const (
+	// ProblemMissingFile is an activated entry whose file data does not exist.
+	ProblemMissingFile ProblemKind = "missing_file"
+	// ProblemOrphanedFile is file data which does not belong to any entry.
+	ProblemOrphanedFile ProblemKind = "orphaned_file"
+	// ProblemSizeMismatch is an entry whose file data does not have the size which was recorded after the upload.
+	ProblemSizeMismatch ProblemKind = "size_mismatch"
+	// ProblemDuplicateCallReference is an entry which uses the call reference of an older entry and therefore can not
+	// be requested.
+	ProblemDuplicateCallReference ProblemKind = "duplicate_call_reference"
+	// ProblemStaleUpload is an entry whose upload is still waiting or has failed.
+	ProblemStaleUpload ProblemKind = "stale_upload"
+)
+
+// RepairMode describes how the problems found by a consistency check are repaired.
+type RepairMode string
+
+const (
+	// RepairNone only reports the problems.
+	RepairNone RepairMode = ""
+	// RepairQuarantine moves the affected metadata and file data into the quarantine folder.
+	RepairQuarantine RepairMode = "quarantine"
+	// RepairDelete removes the affected metadata and file data.
+	RepairDelete RepairMode = "delete"
+)
+
+// ConsistencyCheckOptions contains the options of a consistency check.
+type ConsistencyCheckOptions struct {
+	// Repair is the way the found problems are repaired.
+	Repair RepairMode
+	// QuarantineFolder is the folder where the affected metadata and file data are moved to if Repair is
+	// RepairQuarantine. It has to end with a slash ("/").
+	QuarantineFolder string
+	// StaleBefore is the upload date before which uploads that are still waiting or have failed are reported.
+	StaleBefore time.Time
+}
+
+// ConsistencyProblem is a single inconsistency found by a consistency check.
+type ConsistencyProblem struct {
+	Kind ProblemKind `json:"kind"`
+	// ID and CallReference identify the affected entry. They are empty if the problem is an orphaned file.
+	ID            string `json:"id,omitempty"`
+	CallReference string `json:"call_reference,omitempty"`
+	// File is the name of the affected file data.
+	File string `json:"file,omitempty"`
+	// ExpectedSize and ActualSize are only set if the problem is a size mismatch.
+	ExpectedSize int64 `json:"expected_size,omitempty"`
+	ActualSize   int64 `json:"actual_size,omitempty"`
+	// Repaired is true if the problem was repaired, otherwise RepairError may contain the reason.
+	Repaired    bool   `json:"repaired"`
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+// ConsistencyReport is the result of a consistency check.
+type ConsistencyReport struct {
+	CheckDate time.Time `json:"check_date"`
+	// Entries and Files are the amounts of checked entries and files.
+	Entries  int                   `json:"entries"`
+	Files    int                   `json:"files"`
+	Problems []*ConsistencyProblem `json:"problems"`
+}
+
+// CheckableStorage is implemented by FileStorage implementations which are able to check whether their metadata and
+// file data agree. The check should only be run while no other process uses the storage.
+type CheckableStorage interface {
+	// CheckConsistency checks the storage for problems and optionally repairs them. It returns the report or an error
+	// if the check could not be run.
+	CheckConsistency(options *ConsistencyCheckOptions) (*ConsistencyReport, error)
+}
@@ -0,0 +1,26 @@
+package storage
+
+import "crypto/subtle"
+
+// deletionTokenLength is the amount of random bytes a deletion token consists of.
+const deletionTokenLength = 24
+
+// NewDeletionToken creates a new random deletion token and its hash which can be stored in the Entry.DeletionHash
+// field. Only the hash should be stored while the token itself is handed out to the uploader. It returns an error if
+// no random bytes could be read.
+func NewDeletionToken() (token string, hash string, err error) {
+	if token, err = randomHex(deletionTokenLength); err != nil {
+		return
+	}
+	hash = HashToken(token)
+	return
+}
+
+// VerifyDeletionToken checks whether the given token belongs to the DeletionHash of the entry. Entries without a
+// DeletionHash can not be deleted by any token.
+func (entry *Entry) VerifyDeletionToken(token string) bool {
+	if entry.DeletionHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(entry.DeletionHash)) == 1
+}
@@ -0,0 +1,20 @@
+package storage
+
+import "testing"
+
+func TestDeletionToken(t *testing.T) {
+	token, hash, err := NewDeletionToken()
+	if err != nil {
+		t.Fatalf("Could not create deletion token, %T: %v", err, err)
+	}
+	entry := &Entry{DeletionHash: hash}
+	if !entry.VerifyDeletionToken(token) {
+		t.Fatal("The created deletion token could not be verified")
+	}
+	if entry.VerifyDeletionToken(hash) || entry.VerifyDeletionToken("") {
+		t.Fatal("An invalid deletion token was verified")
+	}
+	if (&Entry{}).VerifyDeletionToken("") {
+		t.Fatal("An entry without deletion hash could be deleted")
+	}
+}
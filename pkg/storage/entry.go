@@ -5,7 +5,8 @@ import (
 	"time"
 )
 
-// AuthorIdentifier identifies the author. It currently is a simple access token.
+// AuthorIdentifier identifies the author. It is the identity of an uploader which is resolved from their access token
+// (see Token).
 type AuthorIdentifier string
 
 // ID can vary and is therefore mutable.
@@ -21,12 +22,25 @@ type ReadCloseSeekOpener interface {
 	Open() error
 }
 
+// EntryKind determines how an entry is served.
+type EntryKind string
+
+const (
+	// KindFile is the kind of uploaded files whose data is served directly. Entries of older versions do not have a
+	// kind and are treated as files.
+	KindFile EntryKind = "file"
+	// KindRedirect is the kind of shortened URLs. The data of such an entry is the URL the client is redirected to.
+	KindRedirect EntryKind = "redirect"
+)
+
 // Entry represents an uploaded file and its metadata in the storage system.
 type Entry struct {
 	// ID is an identical token which identifies the entry.
 	ID ID
 	// CallReference is also an identical token but this one is used in the request uri.
 	CallReference string
+	// Kind determines how the entry is served.
+	Kind EntryKind
 	// AuthorIdentifier determines the uploader information.
 	Author AuthorIdentifier
 	// Filename is the name of the file (contains the application name and date) which is sent with by the ShareX client.
@@ -35,6 +49,16 @@ type Entry struct {
 	ContentType string
 	// UploadDate is the unix timestamp when the file was uploaded.
 	UploadDate time.Time
+	// ExpiryDate is the date when the entry expires. It is not returned by the storage anymore afterwards. A zero
+	// value means that the entry never expires.
+	ExpiryDate time.Time
+	// ContentHash is the hex encoded SHA-256 hash of the file data. It is empty if the storage does not record it.
+	ContentHash string
+	// Hits is the amount of times the entry was requested. It is only counted for redirects by storages implementing
+	// the HitCountingStorage interface.
+	Hits int64
+	// DeletionHash is the hash of the secret token which allows to delete the entry (see NewDeletionToken).
+	DeletionHash string
 	// ReadCloseSeekOpener allows to read the image data while controlling the reading start process.
 	Reader ReadCloseSeekOpener
 }
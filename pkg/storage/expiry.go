@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ExpiringStorage is implemented by FileStorage implementations which are able to physically remove expired entries.
+// Expired entries are never returned by the FileStorage.Request method, regardless of whether they were removed yet.
+type ExpiringStorage interface {
+	// DeleteExpired removes all entries including their file data whose ExpiryDate is before or equal to the provided
+	// time. It returns the removed entries or an error if something goes wrong.
+	DeleteExpired(now time.Time) ([]*Entry, error)
+}
+
+// IsExpired checks whether the entry has an ExpiryDate which is before or equal to the provided time.
+func (entry *Entry) IsExpired(now time.Time) bool {
+	return !entry.ExpiryDate.IsZero() && !entry.ExpiryDate.After(now)
+}
+
+// Janitor runs a task periodically in a background goroutine, e.g. to remove expired entries.
+type Janitor struct {
+	// Interval is the duration between two runs of the task.
+	Interval time.Duration
+	// Task is called with the current time on every run.
+	Task func(now time.Time)
+	// internal values
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// Start starts the background goroutine which runs the task. The first run happens after the first interval. It
+// returns an error if the interval is not positive.
+func (janitor *Janitor) Start() error {
+	if janitor.Interval <= 0 {
+		return fmt.Errorf("the interval of the janitor has to be positive, got %v", janitor.Interval)
+	}
+	janitor.stop = make(chan struct{})
+	janitor.done.Add(1)
+	go func() {
+		defer janitor.done.Done()
+		ticker := time.NewTicker(janitor.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				janitor.Task(now)
+			case <-janitor.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops the background goroutine and waits until a running task has finished.
+func (janitor *Janitor) Stop() {
+	close(janitor.stop)
+	janitor.done.Wait()
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEntryIsExpired(t *testing.T) {
+	now := time.Now()
+	if (&Entry{}).IsExpired(now) {
+		t.Fatal("An entry without expiry date is expired")
+	}
+	if (&Entry{ExpiryDate: now.Add(time.Second)}).IsExpired(now) {
+		t.Fatal("An entry with a future expiry date is expired")
+	}
+	if !(&Entry{ExpiryDate: now}).IsExpired(now) {
+		t.Fatal("An entry with the current expiry date is not expired")
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	runs := make(chan time.Time, 16)
+	janitor := &Janitor{
+		Interval: time.Millisecond,
+		Task: func(now time.Time) {
+			runs <- now
+		},
+	}
+	if err := janitor.Start(); err != nil {
+		t.Fatalf("Could not start janitor, %T: %v", err, err)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("The janitor task was not run")
+		}
+	}
+	janitor.Stop()
+	// drain the runs which happened before stopping
+	for len(runs) > 0 {
+		<-runs
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(runs) > 0 {
+		t.Fatal("The janitor task was run after stopping")
+	}
+	janitor.Interval = 0
+	if err := janitor.Start(); err == nil {
+		janitor.Stop()
+		t.Fatal("The janitor was started without a positive interval")
+	}
+}
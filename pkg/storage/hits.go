@@ -0,0 +1,9 @@
+package storage
+
+// HitCountingStorage is implemented by FileStorage implementations which are able to count how often an entry was
+// requested.
+type HitCountingStorage interface {
+	// CountHit increments the Hits of the entry with the provided call reference. It returns ErrEntryNotFound if the
+	// entry could not be found or an unwrapped error if something goes wrong.
+	CountHit(callReference string) error
+}
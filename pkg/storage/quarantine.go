@@ -0,0 +1,20 @@
+package storage
+
+// QuarantiningStorage is implemented by FileStorage implementations which are able to quarantine entries, e.g.
+// because their file data contains a virus. Quarantined entries keep their file data for a review, but they are never
+// returned by the FileStorage.Request method and are not removed as stale uploads. The writers returned by their
+// FileStorage.Store method implement the QuarantiningWriter interface.
+type QuarantiningStorage interface {
+	// Quarantine quarantines the entry with the given ID for the given reason. It returns ErrEntryNotFound if the
+	// entry could not be found or an unwrapped error if something goes wrong.
+	Quarantine(id ID, reason string) error
+}
+
+// QuarantiningWriter is implemented by the writers returned by the FileStorage.Store method which are able to store a
+// new entry in quarantine, so that it is never activated.
+type QuarantiningWriter interface {
+	// CloseQuarantined closes the writer like the Close method, but quarantines the entry for the given reason instead
+	// of activating it. If something goes wrong, the entry is left in a state in which it is never returned by the
+	// FileStorage.Request method and an error is returned.
+	CloseQuarantined(reason string) error
+}
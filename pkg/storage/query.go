@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor is returned by the QueryableStorage.Query method if the provided cursor could not be parsed.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query contains the filters which are used to page through the stored entries. Filters with zero values are ignored.
+type Query struct {
+	// Author only matches entries which were uploaded by this author.
+	Author AuthorIdentifier
+	// ContentTypePrefix only matches entries whose content type starts with this prefix, e.g. "image/".
+	ContentTypePrefix string
+	// From and Until only match entries whose UploadDate is in the range [From, Until).
+	From, Until time.Time
+	// Cursor continues a previous query. It is the cursor returned within the previous QueryResult.
+	Cursor string
+	// Limit is the maximum amount of returned entries.
+	Limit int
+}
+
+// QueryResult is a page of entries which match a Query. The entries are sorted by their upload date, beginning with the
+// newest one.
+type QueryResult struct {
+	// Entries contains the matching entries without their Reader values.
+	Entries []*Entry
+	// Cursor can be used to request the next page. It is empty if there are no more entries.
+	Cursor string
+}
+
+// QueryableStorage is implemented by FileStorage implementations which support paging through their entries.
+type QueryableStorage interface {
+	// Query returns the entries which match the provided query. It returns ErrInvalidCursor if the cursor of the query
+	// could not be parsed or an unwrapped error if something goes wrong.
+	Query(query *Query) (*QueryResult, error)
+}
@@ -0,0 +1,41 @@
+package storage
+
+// Quota limits the amount of data an author is allowed to store. Zero values are unlimited.
+type Quota struct {
+	// Bytes is the maximum total size of the stored entries.
+	Bytes int64
+	// Files is the maximum amount of stored entries.
+	Files int
+}
+
+// Merge returns the given quota with its zero values replaced by the ones of the fallback quota.
+func (quota Quota) Merge(fallback Quota) Quota {
+	if quota.Bytes == 0 {
+		quota.Bytes = fallback.Bytes
+	}
+	if quota.Files == 0 {
+		quota.Files = fallback.Files
+	}
+	return quota
+}
+
+// IsUnlimited checks whether the quota does not limit anything.
+func (quota Quota) IsUnlimited() bool {
+	return quota.Bytes == 0 && quota.Files == 0
+}
+
+// Usage is the amount of data stored by an author.
+type Usage struct {
+	// Bytes is the total size of the stored entries.
+	Bytes int64
+	// Files is the amount of stored entries.
+	Files int
+}
+
+// UsageStorage is implemented by FileStorage implementations which are able to sum up the data stored by an author.
+type UsageStorage interface {
+	// Usage returns the amount of data stored by the provided author. Expired entries and failed uploads are not
+	// counted while uploads which are still in progress are counted without their size. It returns an error if
+	// something goes wrong.
+	Usage(author AuthorIdentifier) (*Usage, error)
+}
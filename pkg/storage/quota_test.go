@@ -0,0 +1,16 @@
+package storage
+
+import "testing"
+
+func TestQuotaMerge(t *testing.T) {
+	fallback := Quota{Bytes: 1 << 30, Files: 100}
+	if quota := (Quota{}).Merge(fallback); quota != fallback {
+		t.Fatalf("Merging an empty quota returned %+v, expected %+v", quota, fallback)
+	}
+	if quota := (Quota{Files: 5}).Merge(fallback); quota.Files != 5 || quota.Bytes != fallback.Bytes {
+		t.Fatalf("Merging a partial quota returned %+v", quota)
+	}
+	if !(Quota{}).Merge(Quota{}).IsUnlimited() {
+		t.Fatal("Merging two empty quotas returned a limited quota")
+	}
+}
@@ -0,0 +1,12 @@
+package storage
+
+import "time"
+
+// SweepableStorage is implemented by FileStorage implementations which keep track of uploads that are still waiting
+// for their file data or whose upload failed. Such uploads are never returned by the FileStorage.Request method.
+type SweepableStorage interface {
+	// DeleteStale removes all entries including their partial file data which were uploaded before the provided time
+	// and whose upload is still waiting or has failed. It returns the removed entries or an error if something goes
+	// wrong.
+	DeleteStale(uploadedBefore time.Time) ([]*Entry, error)
+}
@@ -108,6 +108,17 @@ func (testStorage *TestStorage) Request(callReference string) (*storage.Entry, e
 	return nil, storage.ErrEntryNotFound
 }
 
+// Delete is the implementation of the storage.FileStorage.Delete method.
+func (testStorage *TestStorage) Delete(callReference string) error {
+	for entry := range testStorage.entries {
+		if entry.CallReference == callReference {
+			delete(testStorage.entries, entry)
+			return nil
+		}
+	}
+	return storage.ErrEntryNotFound
+}
+
 // Close is the implementation of the storage.FileStorage.Close method.
 func (testStorage *TestStorage) Close() error {
 	// no connection etc. has to be closed because the data is just in the memory
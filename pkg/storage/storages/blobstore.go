@@ -0,0 +1,88 @@
+package storages
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// BlobStore is the layer which stores the raw file data of entries. The data is identified by a name which is chosen
+// by the storage using the BlobStore. This allows storages to keep the entry metadata in one place while storing the
+// file data somewhere else.
+type BlobStore interface {
+	// Initialize is called by the storage using the BlobStore to e.g. create folders. It returns an error if something
+	// goes wrong.
+	Initialize() error
+	// Create returns a writer to write the data of the blob with the given name. The blob is not guaranteed to be
+	// complete until the writer was closed without an error.
+	Create(name string) (io.WriteCloser, error)
+	// Open returns a storage.ReadCloseSeekOpener which reads the data of the blob with the given name after its Open
+	// method was called.
+	Open(name string) storage.ReadCloseSeekOpener
+	// Remove deletes the blob with the given name. If the blob does not exist, either nil or an error satisfying
+	// os.IsNotExist is returned. It returns an error if something goes wrong.
+	Remove(name string) error
+}
+
+// CheckableBlobStore is implemented by BlobStore implementations which support the consistency check of the storage
+// using them.
+type CheckableBlobStore interface {
+	BlobStore
+	// List returns the sizes of all stored blobs identified by their names. It returns an error if something goes
+	// wrong.
+	List() (map[string]int64, error)
+	// Quarantine moves the blob with the given name into the given local folder. It does not return an error if the
+	// blob does not exist.
+	Quarantine(name, folder string) error
+}
+
+// FolderBlobStore is the BlobStore implementation which stores the blobs as standard system files in a folder.
+type FolderBlobStore struct {
+	// Folder is the folder where the blobs are stored in. This can be an absolute or a relative path. It has to end
+	// with a slash ("/").
+	Folder string
+}
+
+// Initialize is the implementation of the BlobStore.Initialize method
+func (folderBlobStore *FolderBlobStore) Initialize() error {
+	// create folder for stored files
+	return os.MkdirAll(folderBlobStore.Folder, os.ModePerm)
+}
+
+// Create is the implementation of the BlobStore.Create method
+func (folderBlobStore *FolderBlobStore) Create(name string) (io.WriteCloser, error) {
+	return os.Create(folderBlobStore.Folder + name)
+}
+
+// Open is the implementation of the BlobStore.Open method
+func (folderBlobStore *FolderBlobStore) Open(name string) storage.ReadCloseSeekOpener {
+	return &FileBasedReadCloseSeekOpener{
+		Filepath: folderBlobStore.Folder + name,
+	}
+}
+
+// Remove is the implementation of the BlobStore.Remove method
+func (folderBlobStore *FolderBlobStore) Remove(name string) error {
+	return os.Remove(folderBlobStore.Folder + name)
+}
+
+// List is the implementation of the CheckableBlobStore.List method
+func (folderBlobStore *FolderBlobStore) List() (map[string]int64, error) {
+	fileInfos, err := ioutil.ReadDir(folderBlobStore.Folder)
+	if err != nil {
+		return nil, err
+	}
+	blobs := make(map[string]int64, len(fileInfos))
+	for _, fileInfo := range fileInfos {
+		if fileInfo.Mode().IsRegular() {
+			blobs[fileInfo.Name()] = fileInfo.Size()
+		}
+	}
+	return blobs, nil
+}
+
+// Quarantine is the implementation of the CheckableBlobStore.Quarantine method
+func (folderBlobStore *FolderBlobStore) Quarantine(name, folder string) error {
+	return moveFile(folderBlobStore.Folder+name, name, folder)
+}
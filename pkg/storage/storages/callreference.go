@@ -0,0 +1,49 @@
+package storages
+
+import (
+	"bytes"
+	cryptRand "crypto/rand"
+	"log"
+	"math/big"
+	mathRand "math/rand"
+	"strings"
+)
+
+const (
+	// Data to generate new call references
+	callReferenceChars  = "abcdefghijklmnopqrstuvxyzABCDEFGHIJKLMNOPQRSTUVXYZ1234567890"
+	callReferenceLength = 6
+)
+
+// newCallReference randomly creates a new call reference
+func newCallReference() string {
+	buf := bytes.NewBuffer([]byte{})
+	randomMaximum := big.NewInt(int64(len(callReferenceChars)))
+	for i := 0; i < callReferenceLength; i++ {
+		var randomIndex int
+		randomIntIndex, err := cryptRand.Int(cryptRand.Reader, randomMaximum)
+		if err != nil {
+			log.Printf("Could not get create random call reference with crypto/rand. "+
+				"Falling back to (insecure) math/rand package. %T: %v\n", err, err)
+			randomIndex = mathRand.Intn(len(callReferenceChars))
+		} else {
+			randomIndex = int(randomIntIndex.Int64())
+		}
+		buf.WriteString(callReferenceChars[randomIndex : randomIndex+1])
+	}
+	return buf.String()
+}
+
+// isValidCallReference checks whether the given call reference could have been created by newCallReference. This
+// prevents call references like "../" from being used to access files outside of the data folder.
+func isValidCallReference(callReference string) bool {
+	if len(callReference) != callReferenceLength {
+		return false
+	}
+	for _, char := range callReference {
+		if !strings.ContainsRune(callReferenceChars, char) {
+			return false
+		}
+	}
+	return true
+}
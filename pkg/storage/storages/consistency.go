@@ -0,0 +1,126 @@
+package storages
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"os"
+	"sort"
+	"time"
+)
+
+// consistencyRecord is the storage independent representation of an entry which is checked by checkConsistency.
+type consistencyRecord struct {
+	ID, CallReference string
+	// File is the name of the file data of the entry.
+	File       string
+	Status     int
+	UploadDate time.Time
+	// Size is the amount of bytes which were written during the upload. It is zero if it is unknown.
+	Size int64
+}
+
+// consistencyRepairer is implemented by the storages which support the consistency check to repair the found
+// problems.
+type consistencyRepairer interface {
+	// quarantineEntry moves the metadata and the file data (if existing) of the entry into the given folder.
+	quarantineEntry(record *consistencyRecord, folder string) error
+	// deleteEntry removes the metadata and the file data (if existing) of the entry.
+	deleteEntry(record *consistencyRecord) error
+	// quarantineFile moves the file data with the given name into the given folder.
+	quarantineFile(file, folder string) error
+	// deleteFile removes the file data with the given name.
+	deleteFile(file string) error
+}
+
+// checkConsistency compares the given records with the sizes of the existing files identified by their names and
+// repairs the found problems with the given repairer. The records have to be sorted by their creation, so that the
+// oldest one of multiple entries with the same call reference is kept.
+func checkConsistency(records []*consistencyRecord, files map[string]int64, options *storage.ConsistencyCheckOptions,
+	repairer consistencyRepairer) (*storage.ConsistencyReport, error) {
+	if options.Repair == storage.RepairQuarantine {
+		if err := os.MkdirAll(options.QuarantineFolder, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	report := &storage.ConsistencyReport{
+		CheckDate: time.Now(),
+		Entries:   len(records),
+		Files:     len(files),
+		Problems:  make([]*storage.ConsistencyProblem, 0),
+	}
+	// files which are referenced by an entry are removed from this map, so the remaining ones are orphaned
+	orphanedFiles := make(map[string]bool, len(files))
+	for file := range files {
+		orphanedFiles[file] = true
+	}
+	callReferences := make(map[string]bool, len(records))
+	for _, record := range records {
+		size, fileExists := files[record.File]
+		delete(orphanedFiles, record.File)
+		problem := &storage.ConsistencyProblem{ID: record.ID, CallReference: record.CallReference, File: record.File}
+		switch {
+		case record.Status == statusWaiting || record.Status == statusFailed:
+			if !record.UploadDate.Before(options.StaleBefore) {
+				// the upload may still be in progress
+				continue
+			}
+			problem.Kind = storage.ProblemStaleUpload
+		case callReferences[record.CallReference]:
+			problem.Kind = storage.ProblemDuplicateCallReference
+		case !fileExists:
+			problem.Kind = storage.ProblemMissingFile
+		case record.Size != 0 && record.Size != size:
+			problem.Kind = storage.ProblemSizeMismatch
+			problem.ExpectedSize, problem.ActualSize = record.Size, size
+		default:
+			callReferences[record.CallReference] = true
+			continue
+		}
+		if problem.Kind != storage.ProblemStaleUpload {
+			callReferences[record.CallReference] = true
+		}
+		var err error
+		switch options.Repair {
+		case storage.RepairQuarantine:
+			err = repairer.quarantineEntry(record, options.QuarantineFolder)
+		case storage.RepairDelete:
+			err = repairer.deleteEntry(record)
+		}
+		report.Problems = append(report.Problems, repairedProblem(problem, options.Repair, err))
+	}
+	sortedOrphanedFiles := make([]string, 0, len(orphanedFiles))
+	for file := range orphanedFiles {
+		sortedOrphanedFiles = append(sortedOrphanedFiles, file)
+	}
+	sort.Strings(sortedOrphanedFiles)
+	for _, file := range sortedOrphanedFiles {
+		problem := &storage.ConsistencyProblem{Kind: storage.ProblemOrphanedFile, File: file}
+		var err error
+		switch options.Repair {
+		case storage.RepairQuarantine:
+			err = repairer.quarantineFile(file, options.QuarantineFolder)
+		case storage.RepairDelete:
+			err = repairer.deleteFile(file)
+		}
+		report.Problems = append(report.Problems, repairedProblem(problem, options.Repair, err))
+	}
+	return report, nil
+}
+
+// repairedProblem sets the repair result of the given problem.
+func repairedProblem(problem *storage.ConsistencyProblem, repairMode storage.RepairMode,
+	err error) *storage.ConsistencyProblem {
+	if err != nil {
+		problem.RepairError = err.Error()
+	} else {
+		problem.Repaired = repairMode != storage.RepairNone
+	}
+	return problem
+}
+
+// moveFile moves the given file into the given folder. It does not return an error if the file does not exist.
+func moveFile(filepath, name, folder string) error {
+	if err := os.Rename(filepath, folder+name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package storages
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSystemStorageConsistency(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-consistency-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	fileSystemStorage := &FileSystemStorage{DataFolder: dataFolder + "/data/"}
+	if err := fileSystemStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file system storage, %T: %v", err, err)
+	}
+	testCheckableStorage(t, fileSystemStorage, dataFolder+"/quarantine/", func(entry *storage.Entry) string {
+		return fileSystemStorage.dataFilepath(entry.CallReference)
+	})
+}
+
+func TestEmbeddedStorageConsistency(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-consistency-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	embeddedStorage := &EmbeddedStorage{DatabaseFile: dataFolder + "/sharexserver.db", DataFolder: dataFolder + "/data/"}
+	if err := embeddedStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize embedded storage, %T: %v", err, err)
+	}
+	defer embeddedStorage.Close()
+	testCheckableStorage(t, embeddedStorage, dataFolder+"/quarantine/", func(entry *storage.Entry) string {
+		return embeddedStorage.DataFolder + entry.ID.(string)
+	})
+}
+
+// testCheckableStorage creates every kind of problem except for duplicate call references (which can not be created
+// with the storages using this function) and checks that they are reported and quarantined.
+func testCheckableStorage(t *testing.T, fileStorage interface {
+	storage.FileStorage
+	storage.CheckableStorage
+}, quarantineFolder string, dataFilepath func(*storage.Entry) string) {
+	now := time.Now()
+	entries := make([]*storage.Entry, 4)
+	for i := range entries {
+		entries[i] = &storage.Entry{Filename: "testfile.png", ContentType: "image/png", UploadDate: now.Add(-time.Hour)}
+		writer, err := fileStorage.Store(entries[i])
+		if err != nil {
+			t.Fatalf("Could not store entry, %T: %v", err, err)
+		}
+		if _, err := writer.Write([]byte("Hello, this is a test!")); err != nil {
+			t.Fatalf("Could not write entry data, %T: %v", err, err)
+		}
+		// the last entry is never completed
+		if i < len(entries)-1 {
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Could not close entry writer, %T: %v", err, err)
+			}
+		}
+	}
+	// the first entry is intact, the file of the second one is removed and the one of the third one is modified
+	if err := os.Remove(dataFilepath(entries[1])); err != nil {
+		t.Fatalf("Could not remove entry file, %T: %v", err, err)
+	}
+	if err := ioutil.WriteFile(dataFilepath(entries[2]), []byte("modified"), 0644); err != nil {
+		t.Fatalf("Could not modify entry file, %T: %v", err, err)
+	}
+	orphanedFile := dataFilepath(&storage.Entry{ID: "0123456789abcdef01234567", CallReference: "aBcDeF"})
+	if err := ioutil.WriteFile(orphanedFile, []byte("orphaned"), 0644); err != nil {
+		t.Fatalf("Could not create orphaned file, %T: %v", err, err)
+	}
+	options := &storage.ConsistencyCheckOptions{StaleBefore: now}
+	report, err := fileStorage.CheckConsistency(options)
+	if err != nil {
+		t.Fatalf("Could not check consistency, %T: %v", err, err)
+	}
+	if report.Entries != 4 || report.Files != 4 {
+		t.Fatalf("Checked %d entries and %d files, expected 4 of both", report.Entries, report.Files)
+	}
+	kinds := make(map[string]storage.ProblemKind)
+	for _, problem := range report.Problems {
+		if problem.Repaired {
+			t.Fatalf("Problem %+v was repaired without a repair mode", problem)
+		}
+		kinds[problem.CallReference] = problem.Kind
+		if problem.Kind == storage.ProblemSizeMismatch && (problem.ExpectedSize != 22 || problem.ActualSize != 8) {
+			t.Fatalf("Invalid sizes of the size mismatch %+v", problem)
+		}
+	}
+	expectedKinds := map[string]storage.ProblemKind{
+		entries[1].CallReference: storage.ProblemMissingFile,
+		entries[2].CallReference: storage.ProblemSizeMismatch,
+		entries[3].CallReference: storage.ProblemStaleUpload,
+		"":                       storage.ProblemOrphanedFile,
+	}
+	if !reflect.DeepEqual(kinds, expectedKinds) {
+		t.Fatalf("Found problems %v, expected %v", kinds, expectedKinds)
+	}
+	options.Repair = storage.RepairQuarantine
+	options.QuarantineFolder = quarantineFolder
+	if report, err = fileStorage.CheckConsistency(options); err != nil {
+		t.Fatalf("Could not repair consistency, %T: %v", err, err)
+	}
+	for _, problem := range report.Problems {
+		if !problem.Repaired {
+			t.Fatalf("Problem %+v was not repaired", problem)
+		}
+	}
+	if _, err := os.Stat(quarantineFolder + problemFile(report, storage.ProblemOrphanedFile)); err != nil {
+		t.Fatalf("The orphaned file was not quarantined, %T: %v", err, err)
+	}
+	options.Repair = storage.RepairNone
+	if report, err = fileStorage.CheckConsistency(options); err != nil {
+		t.Fatalf("Could not check consistency after repairing, %T: %v", err, err)
+	}
+	if len(report.Problems) != 0 || report.Entries != 1 {
+		t.Fatalf("Expected one intact entry after repairing, got %+v", report)
+	}
+	if _, err := fileStorage.Request(entries[0].CallReference); err != nil {
+		t.Fatalf("Could not request the intact entry, %T: %v", err, err)
+	}
+}
+
+// problemFile returns the file of the first problem of the given kind.
+func problemFile(report *storage.ConsistencyReport, kind storage.ProblemKind) string {
+	for _, problem := range report.Problems {
+		if problem.Kind == kind {
+			return problem.File
+		}
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package storages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"sync"
+)
+
+// contentHashLength is the length of the hex encoded SHA-256 hashes which are used as the names of content-addressed
+// blobs.
+const contentHashLength = sha256.Size * 2
+
+// contentHasher counts and hashes the data which is written to an entry.
+type contentHasher struct {
+	size int64
+	hash hash.Hash
+}
+
+// add processes the given written data.
+func (contentHasher *contentHasher) add(p []byte) {
+	if contentHasher.hash == nil {
+		contentHasher.hash = sha256.New()
+	}
+	contentHasher.hash.Write(p)
+	contentHasher.size += int64(len(p))
+}
+
+// sum returns the hex encoded hash of the processed data.
+func (contentHasher *contentHasher) sum() string {
+	if contentHasher.hash == nil {
+		contentHasher.hash = sha256.New()
+	}
+	return hex.EncodeToString(contentHasher.hash.Sum(nil))
+}
+
+// isContentHash checks whether the given blob name is a content hash.
+func isContentHash(name string) bool {
+	if len(name) != contentHashLength {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// blobReferenceCounter persists the amount of entries which reference a content-addressed blob.
+type blobReferenceCounter interface {
+	// addReference increments the reference count of the blob with the given hash and returns the new count.
+	addReference(hash string) (int, error)
+	// removeReference decrements the reference count of the blob with the given hash and returns the new count. The
+	// counter is removed when it reaches zero.
+	removeReference(hash string) (int, error)
+}
+
+// contentAddressedBlobs stores blobs named by the hash of their content in a BlobStore, so that entries with the same
+// content share one blob. The blobs are only removed when the last referencing entry is removed.
+type contentAddressedBlobs struct {
+	blobStore  BlobStore
+	references blobReferenceCounter
+	// mutex makes sure that a blob is not removed while another entry starts to reference it
+	mutex sync.Mutex
+}
+
+// commit adds a reference to the blob with the given hash. If it is the first one, the given temporary file becomes
+// the blob. Otherwise the temporary file is removed because the blob already exists.
+func (blobs *contentAddressedBlobs) commit(temporaryFilepath, hash string) error {
+	blobs.mutex.Lock()
+	defer blobs.mutex.Unlock()
+	references, err := blobs.references.addReference(hash)
+	if err != nil {
+		os.Remove(temporaryFilepath)
+		return err
+	}
+	if references > 1 {
+		return os.Remove(temporaryFilepath)
+	}
+	if err = importBlob(blobs.blobStore, hash, temporaryFilepath); err != nil {
+		blobs.references.removeReference(hash)
+		return err
+	}
+	return nil
+}
+
+// release removes a reference to the blob with the given hash. If it was the last one, the blob is moved into the
+// quarantine folder if one is given or removed otherwise.
+func (blobs *contentAddressedBlobs) release(hash, quarantineFolder string) error {
+	blobs.mutex.Lock()
+	defer blobs.mutex.Unlock()
+	references, err := blobs.references.removeReference(hash)
+	if err != nil || references > 0 {
+		return err
+	}
+	if quarantineFolder != "" {
+		if checkableBlobStore, ok := blobs.blobStore.(CheckableBlobStore); ok {
+			return checkableBlobStore.Quarantine(hash, quarantineFolder)
+		}
+	}
+	if err = blobs.blobStore.Remove(hash); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// importBlob moves the given local file into the blob store as the blob with the given name.
+func importBlob(blobStore BlobStore, name, filepath string) error {
+	if folderBlobStore, ok := blobStore.(*FolderBlobStore); ok {
+		// files inside of the same file system are just renamed, otherwise they are copied
+		if err := os.Rename(filepath, folderBlobStore.Folder+name); err == nil {
+			return nil
+		}
+	}
+	file, err := os.Open(filepath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filepath)
+	defer file.Close()
+	writer, err := blobStore.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(writer, file); err != nil {
+		writer.Close()
+		blobStore.Remove(name)
+		return err
+	}
+	return writer.Close()
+}
+
+// contentCommitter is implemented by writers whose data has to be committed after the hash of the data is known.
+type contentCommitter interface {
+	// commit stores the written data as the blob with the given hash.
+	commit(hash string) error
+}
+
+// contentAddressedWriteCloser writes the data of a content-addressed blob into a temporary file which is committed
+// once the hash of the data is known.
+type contentAddressedWriteCloser struct {
+	*os.File
+	blobs *contentAddressedBlobs
+}
+
+// Close closes the temporary file and removes it if something goes wrong.
+func (writeCloser *contentAddressedWriteCloser) Close() error {
+	if err := writeCloser.File.Close(); err != nil {
+		os.Remove(writeCloser.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort is the implementation of the storage.Aborter.Abort method
+func (writeCloser *contentAddressedWriteCloser) Abort() error {
+	err := writeCloser.File.Close()
+	if removeErr := os.Remove(writeCloser.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// commit is the implementation of the contentCommitter.commit method
+func (writeCloser *contentAddressedWriteCloser) commit(hash string) error {
+	return writeCloser.blobs.commit(writeCloser.Name(), hash)
+}
@@ -0,0 +1,80 @@
+package storages
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// mapBlobReferenceCounter is an in-memory blobReferenceCounter.
+type mapBlobReferenceCounter map[string]int
+
+func (counter mapBlobReferenceCounter) addReference(hash string) (int, error) {
+	counter[hash]++
+	return counter[hash], nil
+}
+
+func (counter mapBlobReferenceCounter) removeReference(hash string) (int, error) {
+	counter[hash]--
+	references := counter[hash]
+	if references <= 0 {
+		delete(counter, hash)
+	}
+	return references, nil
+}
+
+func TestContentAddressedBlobs(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-content-addressing-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	blobStore := &FolderBlobStore{Folder: dataFolder + "/blobs/"}
+	if err := blobStore.Initialize(); err != nil {
+		t.Fatalf("Could not initialize blob store, %T: %v", err, err)
+	}
+	counter := make(mapBlobReferenceCounter)
+	blobs := &contentAddressedBlobs{blobStore: blobStore, references: counter}
+	testBytes := []byte("Hello, this is a test!")
+	var hasher contentHasher
+	hasher.add(testBytes)
+	hash := hasher.sum()
+	if expectedHash := sha256.Sum256(testBytes); hash != hex.EncodeToString(expectedHash[:]) || hasher.size != 22 {
+		t.Fatalf("Invalid hash %s and size %d of the test data", hash, hasher.size)
+	}
+	// the same content is uploaded twice
+	for _, name := range []string{"first.tmp", "second.tmp"} {
+		temporaryFilepath := dataFolder + "/" + name
+		if err := ioutil.WriteFile(temporaryFilepath, testBytes, 0644); err != nil {
+			t.Fatalf("Could not write temporary file, %T: %v", err, err)
+		}
+		if err := blobs.commit(temporaryFilepath, hash); err != nil {
+			t.Fatalf("Could not commit blob, %T: %v", err, err)
+		}
+		if _, err := os.Stat(temporaryFilepath); !os.IsNotExist(err) {
+			t.Fatalf("The temporary file %s still exists after committing it", name)
+		}
+	}
+	if fileInfos, _ := ioutil.ReadDir(blobStore.Folder); len(fileInfos) != 1 || fileInfos[0].Name() != hash {
+		t.Fatalf("Expected exactly one blob named %s, got %d", hash, len(fileInfos))
+	}
+	if counter[hash] != 2 {
+		t.Fatalf("Expected 2 references of the blob, got %d", counter[hash])
+	}
+	if err := blobs.release(hash, ""); err != nil {
+		t.Fatalf("Could not release blob, %T: %v", err, err)
+	}
+	if data, err := ioutil.ReadFile(blobStore.Folder + hash); err != nil {
+		t.Fatalf("The blob was removed while it is still referenced, %T: %v", err, err)
+	} else if string(data) != string(testBytes) {
+		t.Fatalf("Invalid blob data %q", data)
+	}
+	if err := blobs.release(hash, ""); err != nil {
+		t.Fatalf("Could not release blob, %T: %v", err, err)
+	}
+	if _, err := os.Stat(blobStore.Folder + hash); !os.IsNotExist(err) {
+		t.Fatalf("The blob still exists after releasing its last reference")
+	}
+}
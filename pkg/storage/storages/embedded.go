@@ -0,0 +1,444 @@
+package storages
+
+import (
+	cryptRand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// idLength is the amount of random bytes used for the IDs of the EmbeddedStorage entries.
+const idLength = 12
+
+// errStorageClosed is returned if an EmbeddedStorage is used after it was closed.
+var errStorageClosed = errors.New("the storage has already been closed")
+
+// EmbeddedStorage is the FileStorage implementation which stores the entry metadata in an embedded single-file
+// database and the file data in standard system files. Every status transition is synced to the database file before
+// continuing, so a crash can not leave the metadata in an inconsistent state.
+type EmbeddedStorage struct {
+	// DatabaseFile is the path of the file which contains the metadata of all entries. It is created if it does not
+	// exist yet.
+	DatabaseFile string
+	// DataFolder is the folder where uploaded files are stored in. This can be an absolute or a relative path. It has
+	// to end with a slash ("/").
+	DataFolder string
+	// internal values
+	mutex   sync.RWMutex
+	journal *journal
+	// entries contains the metadata of all entries identified by their ID
+	entries map[string]*entryMetadata
+	// references is the call reference index which maps a call reference to the ID of its entry
+	references map[string]string
+}
+
+// EmbeddedStatusWriteCloser is an extended implementation of io.WriteCloser to update the database entry on close.
+type EmbeddedStatusWriteCloser struct {
+	// EmbeddedStorage is used to update the database entry.
+	EmbeddedStorage *EmbeddedStorage
+	// ID is used to find and update the entry.
+	ID string
+	// Real writer which is used to process the data.
+	RealWriteCloser io.WriteCloser
+	// internal values
+	hasher contentHasher
+}
+
+// Write calls the real writer to process the data and hashes the written bytes.
+func (writeCloser *EmbeddedStatusWriteCloser) Write(p []byte) (int, error) {
+	n, err := writeCloser.RealWriteCloser.Write(p)
+	writeCloser.hasher.add(p[:n])
+	return n, err
+}
+
+// Close is the extended function which also updates the database entry. If the database entry could not be updated,
+// it stays waiting and an error is returned.
+func (writeCloser *EmbeddedStatusWriteCloser) Close() (err error) {
+	var updatedStatus int
+	if err = writeCloser.RealWriteCloser.Close(); err != nil {
+		// set status to failed because an error occurred
+		updatedStatus = statusFailed
+	} else {
+		// set status to activated because the data was successfully written
+		updatedStatus = statusActivated
+	}
+	// update database entry
+	if databaseErr := writeCloser.EmbeddedStorage.updateStatus(writeCloser.ID, updatedStatus,
+		&writeCloser.hasher); databaseErr != nil {
+		log.Printf("An error occurred while updating the status of %v, %T: %+v",
+			strconv.Quote(writeCloser.ID), databaseErr, databaseErr)
+		if err == nil {
+			err = databaseErr
+		}
+	}
+	return
+}
+
+// Abort is the implementation of the storage.Aborter.Abort method
+func (writeCloser *EmbeddedStatusWriteCloser) Abort() (err error) {
+	err = writeCloser.RealWriteCloser.Close()
+	// the partial file data is removed together with the entry once it is stale
+	if databaseErr := writeCloser.EmbeddedStorage.updateStatus(writeCloser.ID, statusFailed,
+		&writeCloser.hasher); databaseErr != nil {
+		log.Printf("An error occurred while updating the status of %v, %T: %+v",
+			strconv.Quote(writeCloser.ID), databaseErr, databaseErr)
+	}
+	return
+}
+
+// Initialize is the implementation of the Storage.Initialize method
+func (embeddedStorage *EmbeddedStorage) Initialize() (err error) {
+	// create folder for stored files
+	if err = os.MkdirAll(embeddedStorage.DataFolder, os.ModePerm); err != nil {
+		return
+	}
+	embeddedStorage.entries = make(map[string]*entryMetadata)
+	embeddedStorage.references = make(map[string]string)
+	// replay all records of the database file to rebuild the entries and the call reference index
+	var records int
+	embeddedStorage.journal, err = openJournal(embeddedStorage.DatabaseFile, func(payload []byte) error {
+		metadata := &entryMetadata{}
+		if err := json.Unmarshal(payload, metadata); err != nil {
+			return err
+		}
+		if metadata.Deleted {
+			delete(embeddedStorage.entries, metadata.ID)
+			delete(embeddedStorage.references, metadata.CallReference)
+		} else {
+			embeddedStorage.entries[metadata.ID] = metadata
+			embeddedStorage.references[metadata.CallReference] = metadata.ID
+		}
+		records++
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	// every status transition and deletion is appended as a new record, so the outdated ones are removed here
+	if records > len(embeddedStorage.entries) {
+		err = embeddedStorage.journal.compact(embeddedStorage.journalValues())
+	}
+	return
+}
+
+// Store is the implementation of the Storage.Store method
+func (embeddedStorage *EmbeddedStorage) Store(entry *storage.Entry) (writer io.WriteCloser, err error) {
+	var id string
+	if id, err = newID(); err != nil {
+		return
+	}
+	embeddedStorage.mutex.Lock()
+	if embeddedStorage.journal == nil {
+		embeddedStorage.mutex.Unlock()
+		return nil, errStorageClosed
+	}
+	// create a new random call reference which is not used yet
+	for {
+		entry.CallReference = newCallReference()
+		if _, ok := embeddedStorage.references[entry.CallReference]; !ok {
+			break
+		}
+	}
+	entry.ID = id
+	// set entry to waiting because the file data is not stored yet
+	metadata := newEntryMetadata(entry, statusWaiting)
+	metadata.ID = id
+	err = embeddedStorage.journal.append(metadata)
+	if err == nil {
+		embeddedStorage.entries[id] = metadata
+		embeddedStorage.references[metadata.CallReference] = id
+	}
+	embeddedStorage.mutex.Unlock()
+	if err != nil {
+		return
+	}
+	// open file and return an EmbeddedStatusWriteCloser
+	writer, err = os.Create(embeddedStorage.DataFolder + id)
+	if err != nil {
+		return nil, err
+	}
+	// wrap the writer into an instance of the EmbeddedStatusWriteCloser to change the status after completing the upload
+	return &EmbeddedStatusWriteCloser{
+		EmbeddedStorage: embeddedStorage,
+		ID:              id,
+		RealWriteCloser: writer,
+	}, nil
+}
+
+// Request is the implementation of the Storage.Request method
+func (embeddedStorage *EmbeddedStorage) Request(callReference string) (*storage.Entry, error) {
+	embeddedStorage.mutex.RLock()
+	defer embeddedStorage.mutex.RUnlock()
+	// find the entry by its call reference
+	id, ok := embeddedStorage.references[callReference]
+	if !ok {
+		// return error that entry was not found
+		return nil, storage.ErrEntryNotFound
+	}
+	metadata := embeddedStorage.entries[id]
+	// uploads which are not completed and expired entries are hidden until they are removed
+	if metadata.Status != statusActivated || metadata.isExpired(time.Now()) {
+		return nil, storage.ErrEntryNotFound
+	}
+	// set all entry values except for the reader
+	entry := metadata.entry()
+	entry.ID = storage.ID(metadata.ID)
+	// initiate file based ReadCloseSeekOpener
+	entry.Reader = &FileBasedReadCloseSeekOpener{
+		Filepath: embeddedStorage.DataFolder + metadata.ID,
+	}
+	return entry, nil
+}
+
+// CountHit is the implementation of the HitCountingStorage.CountHit method
+func (embeddedStorage *EmbeddedStorage) CountHit(callReference string) error {
+	embeddedStorage.mutex.Lock()
+	defer embeddedStorage.mutex.Unlock()
+	if embeddedStorage.journal == nil {
+		return errStorageClosed
+	}
+	id, ok := embeddedStorage.references[callReference]
+	if !ok || embeddedStorage.entries[id].Status != statusActivated {
+		return storage.ErrEntryNotFound
+	}
+	// copy the metadata so that the stored one is only changed if the record could be appended
+	updatedMetadata := *embeddedStorage.entries[id]
+	updatedMetadata.Hits++
+	if err := embeddedStorage.journal.append(&updatedMetadata); err != nil {
+		return err
+	}
+	embeddedStorage.entries[id] = &updatedMetadata
+	return nil
+}
+
+// Query is the implementation of the QueryableStorage.Query method
+func (embeddedStorage *EmbeddedStorage) Query(query *storage.Query) (*storage.QueryResult, error) {
+	embeddedStorage.mutex.RLock()
+	metadataSlice := make([]*entryMetadata, 0, len(embeddedStorage.entries))
+	for _, metadata := range embeddedStorage.entries {
+		metadataSlice = append(metadataSlice, metadata)
+	}
+	embeddedStorage.mutex.RUnlock()
+	return queryMetadata(metadataSlice, query)
+}
+
+// Usage is the implementation of the UsageStorage.Usage method
+func (embeddedStorage *EmbeddedStorage) Usage(author storage.AuthorIdentifier) (*storage.Usage, error) {
+	embeddedStorage.mutex.RLock()
+	defer embeddedStorage.mutex.RUnlock()
+	metadataSlice := make([]*entryMetadata, 0, len(embeddedStorage.entries))
+	for _, metadata := range embeddedStorage.entries {
+		metadataSlice = append(metadataSlice, metadata)
+	}
+	return metadataUsage(metadataSlice, author), nil
+}
+
+// DeleteExpired is the implementation of the ExpiringStorage.DeleteExpired method
+func (embeddedStorage *EmbeddedStorage) DeleteExpired(now time.Time) ([]*storage.Entry, error) {
+	return embeddedStorage.deleteMatching(func(metadata *entryMetadata) bool {
+		return metadata.isExpired(now)
+	})
+}
+
+// DeleteStale is the implementation of the SweepableStorage.DeleteStale method
+func (embeddedStorage *EmbeddedStorage) DeleteStale(uploadedBefore time.Time) ([]*storage.Entry, error) {
+	return embeddedStorage.deleteMatching(func(metadata *entryMetadata) bool {
+		return metadata.Status != statusActivated && metadata.UploadDate.Before(uploadedBefore)
+	})
+}
+
+// deleteMatching removes all entries whose metadata matches the given function and returns them.
+func (embeddedStorage *EmbeddedStorage) deleteMatching(matches func(*entryMetadata) bool) ([]*storage.Entry, error) {
+	embeddedStorage.mutex.RLock()
+	matchingMetadata := make([]*entryMetadata, 0)
+	for _, metadata := range embeddedStorage.entries {
+		if matches(metadata) {
+			matchingMetadata = append(matchingMetadata, metadata)
+		}
+	}
+	embeddedStorage.mutex.RUnlock()
+	deletedEntries := make([]*storage.Entry, 0, len(matchingMetadata))
+	for _, metadata := range matchingMetadata {
+		if err := embeddedStorage.Delete(metadata.CallReference); err == storage.ErrEntryNotFound {
+			// the entry was deleted in the meantime
+			continue
+		} else if err != nil {
+			return deletedEntries, err
+		}
+		entry := metadata.entry()
+		entry.ID = storage.ID(metadata.ID)
+		deletedEntries = append(deletedEntries, entry)
+	}
+	return deletedEntries, nil
+}
+
+// Delete is the implementation of the Storage.Delete method
+func (embeddedStorage *EmbeddedStorage) Delete(callReference string) error {
+	embeddedStorage.mutex.Lock()
+	if embeddedStorage.journal == nil {
+		embeddedStorage.mutex.Unlock()
+		return errStorageClosed
+	}
+	id, ok := embeddedStorage.references[callReference]
+	if !ok {
+		embeddedStorage.mutex.Unlock()
+		return storage.ErrEntryNotFound
+	}
+	// append a deletion record first so that the entry can not be requested anymore
+	err := embeddedStorage.journal.append(&entryMetadata{ID: id, CallReference: callReference, Deleted: true})
+	if err == nil {
+		delete(embeddedStorage.entries, id)
+		delete(embeddedStorage.references, callReference)
+	}
+	embeddedStorage.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	// the file may not exist if the upload failed
+	if err := os.Remove(embeddedStorage.DataFolder + id); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return embeddedStorage.variants().removeAll(id)
+}
+
+// CheckConsistency is the implementation of the CheckableStorage.CheckConsistency method
+func (embeddedStorage *EmbeddedStorage) CheckConsistency(
+	options *storage.ConsistencyCheckOptions) (*storage.ConsistencyReport, error) {
+	embeddedStorage.mutex.RLock()
+	records := make([]*consistencyRecord, 0, len(embeddedStorage.entries))
+	for _, metadata := range embeddedStorage.entries {
+		records = append(records, &consistencyRecord{
+			ID:            metadata.ID,
+			CallReference: metadata.CallReference,
+			File:          metadata.ID,
+			Status:        metadata.Status,
+			UploadDate:    metadata.UploadDate,
+			Size:          metadata.Size,
+		})
+	}
+	embeddedStorage.mutex.RUnlock()
+	// the IDs are random, so the records are sorted by their upload date
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].UploadDate.Before(records[j].UploadDate)
+	})
+	fileInfos, err := ioutil.ReadDir(embeddedStorage.DataFolder)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]int64)
+	for _, fileInfo := range fileInfos {
+		// the database file and other files are ignored
+		if fileInfo.Mode().IsRegular() && isValidID(fileInfo.Name()) {
+			files[fileInfo.Name()] = fileInfo.Size()
+		}
+	}
+	return checkConsistency(records, files, options, embeddedStorage)
+}
+
+// quarantineEntry is the implementation of the consistencyRepairer.quarantineEntry method
+func (embeddedStorage *EmbeddedStorage) quarantineEntry(record *consistencyRecord, folder string) error {
+	embeddedStorage.mutex.RLock()
+	metadata, ok := embeddedStorage.entries[record.ID]
+	embeddedStorage.mutex.RUnlock()
+	if !ok {
+		return storage.ErrEntryNotFound
+	}
+	// the metadata is written next to the file data because it is removed from the database
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(folder+record.ID+metadataFileSuffix, data, 0644); err != nil {
+		return err
+	}
+	if err = embeddedStorage.quarantineFile(record.File, folder); err != nil {
+		return err
+	}
+	return embeddedStorage.Delete(record.CallReference)
+}
+
+// deleteEntry is the implementation of the consistencyRepairer.deleteEntry method
+func (embeddedStorage *EmbeddedStorage) deleteEntry(record *consistencyRecord) error {
+	return embeddedStorage.Delete(record.CallReference)
+}
+
+// quarantineFile is the implementation of the consistencyRepairer.quarantineFile method
+func (embeddedStorage *EmbeddedStorage) quarantineFile(file, folder string) error {
+	return moveFile(embeddedStorage.DataFolder+file, file, folder)
+}
+
+// deleteFile is the implementation of the consistencyRepairer.deleteFile method
+func (embeddedStorage *EmbeddedStorage) deleteFile(file string) error {
+	return os.Remove(embeddedStorage.DataFolder + file)
+}
+
+// Close is the implementation of the Storage.Close method
+func (embeddedStorage *EmbeddedStorage) Close() error {
+	embeddedStorage.mutex.Lock()
+	defer embeddedStorage.mutex.Unlock()
+	if embeddedStorage.journal == nil {
+		return errStorageClosed
+	}
+	err := embeddedStorage.journal.close()
+	embeddedStorage.journal = nil
+	return err
+}
+
+// updateStatus durably changes the status of the entry with the given ID and stores the size and hash of its data.
+func (embeddedStorage *EmbeddedStorage) updateStatus(id string, status int, hasher *contentHasher) error {
+	embeddedStorage.mutex.Lock()
+	defer embeddedStorage.mutex.Unlock()
+	if embeddedStorage.journal == nil {
+		return errStorageClosed
+	}
+	metadata, ok := embeddedStorage.entries[id]
+	if !ok {
+		return storage.ErrEntryNotFound
+	}
+	// copy the metadata so that the stored one is only changed if the record could be appended
+	updatedMetadata := *metadata
+	updatedMetadata.Status = status
+	updatedMetadata.Size = hasher.size
+	updatedMetadata.ContentHash = hasher.sum()
+	if err := embeddedStorage.journal.append(&updatedMetadata); err != nil {
+		return err
+	}
+	embeddedStorage.entries[id] = &updatedMetadata
+	return nil
+}
+
+// journalValues returns the current metadata of all entries which should be written to a compacted journal.
+func (embeddedStorage *EmbeddedStorage) journalValues() []interface{} {
+	values := make([]interface{}, 0, len(embeddedStorage.entries))
+	for _, metadata := range embeddedStorage.entries {
+		values = append(values, metadata)
+	}
+	return values
+}
+
+// isValidID checks whether the given value could have been created by newID.
+func isValidID(value string) bool {
+	if len(value) != idLength*2 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+// newID randomly creates a new hex encoded ID.
+func newID() (string, error) {
+	id := make([]byte, idLength)
+	if _, err := cryptRand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,143 @@
+package storages
+
+import (
+	"bytes"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEmbeddedStorage(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-embedded-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	databaseFile := dataFolder + "/sharexserver.db"
+	embeddedStorage := &EmbeddedStorage{DatabaseFile: databaseFile, DataFolder: dataFolder + "/"}
+	if err := embeddedStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize embedded storage, %T: %v", err, err)
+	}
+	testBytes := []byte("Hello, this is a test!")
+	entry := &storage.Entry{
+		Author:      storage.AuthorIdentifier("a testing person"),
+		Filename:    "testfile.png",
+		ContentType: "image/png",
+		UploadDate:  time.Now(),
+	}
+	writer, err := embeddedStorage.Store(entry)
+	if err != nil {
+		t.Fatalf("Could not store entry, %T: %v", err, err)
+	}
+	if _, err := writer.Write(testBytes); err != nil {
+		t.Fatalf("Could not write entry data, %T: %v", err, err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Could not close entry writer, %T: %v", err, err)
+	}
+	if err := embeddedStorage.Close(); err != nil {
+		t.Fatalf("Could not close embedded storage, %T: %v", err, err)
+	}
+	// simulate a crash while appending a record
+	databaseFileHandle, err := os.OpenFile(databaseFile, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Could not open database file, %T: %v", err, err)
+	}
+	if _, err := databaseFileHandle.Write([]byte{0, 0, 1, 0, 42}); err != nil {
+		t.Fatalf("Could not append incomplete record, %T: %v", err, err)
+	}
+	databaseFileHandle.Close()
+	// reopen the storage to make sure that the metadata was stored durably
+	embeddedStorage = &EmbeddedStorage{DatabaseFile: databaseFile, DataFolder: dataFolder + "/"}
+	if err := embeddedStorage.Initialize(); err != nil {
+		t.Fatalf("Could not reinitialize embedded storage, %T: %v", err, err)
+	}
+	defer embeddedStorage.Close()
+	if metadata := embeddedStorage.entries[entry.ID.(string)]; metadata == nil || metadata.Status != statusActivated {
+		t.Fatalf("Expected the entry to be activated after reopening the storage, got %+v", metadata)
+	}
+	requestedEntry, err := embeddedStorage.Request(entry.CallReference)
+	if err != nil {
+		t.Fatalf("Could not request stored entry, %T: %v", err, err)
+	}
+	if requestedEntry.Filename != entry.Filename || requestedEntry.ContentType != entry.ContentType ||
+		requestedEntry.Author != entry.Author || !requestedEntry.UploadDate.Equal(entry.UploadDate) {
+		t.Fatalf("Requested entry %+v does not match the stored entry %+v", requestedEntry, entry)
+	}
+	if err := requestedEntry.Reader.Open(); err != nil {
+		t.Fatalf("Could not open entry reader, %T: %v", err, err)
+	}
+	defer requestedEntry.Reader.Close()
+	if data, err := ioutil.ReadAll(requestedEntry.Reader); err != nil {
+		t.Fatalf("Could not read entry data, %T: %v", err, err)
+	} else if !bytes.Equal(data, testBytes) {
+		t.Fatalf("Read data %q does not match the written data %q", data, testBytes)
+	}
+	if err := embeddedStorage.Delete(entry.CallReference); err != nil {
+		t.Fatalf("Could not delete entry, %T: %v", err, err)
+	}
+	if err := embeddedStorage.Delete(entry.CallReference); err != storage.ErrEntryNotFound {
+		t.Fatalf("Expected %v when deleting a deleted entry, got %v", storage.ErrEntryNotFound, err)
+	}
+	if _, err := embeddedStorage.Request("abcdef"); err != storage.ErrEntryNotFound {
+		t.Fatalf("Expected %v when requesting an unknown entry, got %v", storage.ErrEntryNotFound, err)
+	}
+}
+
+func TestEmbeddedStorageExpiry(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-embedded-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	embeddedStorage := &EmbeddedStorage{DatabaseFile: dataFolder + "/sharexserver.db", DataFolder: dataFolder + "/"}
+	if err := embeddedStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize embedded storage, %T: %v", err, err)
+	}
+	defer embeddedStorage.Close()
+	testExpiringStorage(t, embeddedStorage)
+}
+
+func TestEmbeddedStorageStaleUploads(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-embedded-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	embeddedStorage := &EmbeddedStorage{DatabaseFile: dataFolder + "/sharexserver.db", DataFolder: dataFolder + "/"}
+	if err := embeddedStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize embedded storage, %T: %v", err, err)
+	}
+	defer embeddedStorage.Close()
+	testSweepableStorage(t, embeddedStorage)
+}
+
+func TestEmbeddedStorageHits(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-embedded-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	embeddedStorage := &EmbeddedStorage{DatabaseFile: dataFolder + "/sharexserver.db", DataFolder: dataFolder + "/"}
+	if err := embeddedStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize embedded storage, %T: %v", err, err)
+	}
+	defer embeddedStorage.Close()
+	testHitCountingStorage(t, embeddedStorage)
+}
+
+func TestEmbeddedStorageVariants(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-embedded-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	embeddedStorage := &EmbeddedStorage{DatabaseFile: dataFolder + "/sharexserver.db", DataFolder: dataFolder + "/"}
+	if err := embeddedStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize embedded storage, %T: %v", err, err)
+	}
+	defer embeddedStorage.Close()
+	testVariantStorage(t, embeddedStorage)
+}
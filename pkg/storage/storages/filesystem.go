@@ -0,0 +1,453 @@
+package storages
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// suffix of the sidecar files which contain the metadata of an entry
+	metadataFileSuffix = ".json"
+	// suffix of temporary files which are renamed after they were written completely
+	temporaryFileSuffix = ".tmp"
+)
+
+// FileSystemStorage is the FileStorage implementation which stores the file data as well as the entry metadata in
+// standard system files. Every uploaded file is accompanied by a sidecar file which contains its metadata. Therefore no
+// external database is needed.
+type FileSystemStorage struct {
+	// DataFolder is the folder where uploaded files and their metadata are stored in. This can be an absolute or a
+	// relative path. It has to end with a slash ("/").
+	DataFolder string
+	// internal values
+	hitMutex sync.Mutex
+}
+
+// entryMetadata is the representation of an entry which is written to the sidecar files or database records.
+type entryMetadata struct {
+	ID            string    `json:"id,omitempty"`
+	Status        int       `json:"status"`
+	CallReference string    `json:"call_reference"`
+	Kind          string    `json:"kind,omitempty"`
+	Author        string    `json:"author"`
+	Filename      string    `json:"filename"`
+	ContentType   string    `json:"content_type"`
+	UploadDate    time.Time `json:"upload_date"`
+	ExpiryDate    time.Time `json:"expiry_date"`
+	DeletionHash  string    `json:"deletion_hash,omitempty"`
+	// Size and ContentHash describe the data written during the upload. They are not set until the upload was
+	// completed.
+	Size        int64  `json:"size,omitempty"`
+	ContentHash string `json:"content_hash,omitempty"`
+	// Hits is the amount of times the entry was requested.
+	Hits int64 `json:"hits,omitempty"`
+	// Deleted marks a record of the embedded database which removes the entry.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// newEntryMetadata returns the metadata of the given entry with the given status.
+func newEntryMetadata(entry *storage.Entry, status int) *entryMetadata {
+	return &entryMetadata{
+		Status:        status,
+		CallReference: entry.CallReference,
+		Kind:          string(entry.Kind),
+		Author:        string(entry.Author),
+		Filename:      entry.Filename,
+		ContentType:   entry.ContentType,
+		UploadDate:    entry.UploadDate,
+		ExpiryDate:    entry.ExpiryDate,
+		DeletionHash:  entry.DeletionHash,
+	}
+}
+
+// entry returns an entry containing all metadata values. The ID and the reader have to be set by the caller.
+func (metadata *entryMetadata) entry() *storage.Entry {
+	return &storage.Entry{
+		CallReference: metadata.CallReference,
+		Kind:          storage.EntryKind(metadata.Kind),
+		Author:        storage.AuthorIdentifier(metadata.Author),
+		Filename:      metadata.Filename,
+		ContentType:   metadata.ContentType,
+		UploadDate:    metadata.UploadDate,
+		ExpiryDate:    metadata.ExpiryDate,
+		ContentHash:   metadata.ContentHash,
+		Hits:          metadata.Hits,
+		DeletionHash:  metadata.DeletionHash,
+	}
+}
+
+// isExpired checks whether the entry of the metadata is expired at the given time.
+func (metadata *entryMetadata) isExpired(now time.Time) bool {
+	return !metadata.ExpiryDate.IsZero() && !metadata.ExpiryDate.After(now)
+}
+
+// SidecarStatusWriteCloser is an extended implementation of io.WriteCloser to update the sidecar file on close.
+type SidecarStatusWriteCloser struct {
+	// FileSystemStorage is used to update the sidecar file.
+	FileSystemStorage *FileSystemStorage
+	// Metadata is the metadata which is written to the sidecar file with the updated status.
+	Metadata *entryMetadata
+	// Real writer which is used to process the data.
+	RealWriteCloser io.WriteCloser
+	// internal values
+	hasher contentHasher
+}
+
+// Write calls the real writer to process the data and hashes the written bytes.
+func (writeCloser *SidecarStatusWriteCloser) Write(p []byte) (int, error) {
+	n, err := writeCloser.RealWriteCloser.Write(p)
+	writeCloser.hasher.add(p[:n])
+	return n, err
+}
+
+// Close is the extended function which also updates the sidecar file. If the sidecar file could not be updated, the
+// entry is not activated and an error is returned.
+func (writeCloser *SidecarStatusWriteCloser) Close() (err error) {
+	updatedStatus := statusActivated
+	if err = writeCloser.RealWriteCloser.Close(); err != nil {
+		// set status to failed because an error occurred
+		updatedStatus = statusFailed
+	}
+	if metadataErr := writeCloser.updateStatus(updatedStatus); metadataErr != nil {
+		log.Printf("An error occurred while updating the status of %v, %T: %+v",
+			strconv.Quote(writeCloser.Metadata.CallReference), metadataErr, metadataErr)
+		if err == nil {
+			err = metadataErr
+		}
+	}
+	return
+}
+
+// Abort is the implementation of the storage.Aborter.Abort method
+func (writeCloser *SidecarStatusWriteCloser) Abort() (err error) {
+	err = writeCloser.RealWriteCloser.Close()
+	// the partial file data is removed together with the entry once it is stale
+	if metadataErr := writeCloser.updateStatus(statusFailed); metadataErr != nil {
+		log.Printf("An error occurred while updating the status of %v, %T: %+v",
+			strconv.Quote(writeCloser.Metadata.CallReference), metadataErr, metadataErr)
+	}
+	return
+}
+
+// updateStatus writes the given status and the recorded size and content hash to the sidecar file.
+func (writeCloser *SidecarStatusWriteCloser) updateStatus(status int) error {
+	writeCloser.Metadata.Status = status
+	writeCloser.Metadata.Size = writeCloser.hasher.size
+	writeCloser.Metadata.ContentHash = writeCloser.hasher.sum()
+	// the entry may have been removed as a stale upload in the meantime, so its sidecar file must not be recreated
+	metadataFilepath := writeCloser.FileSystemStorage.metadataFilepath(writeCloser.Metadata.CallReference)
+	if _, statErr := os.Stat(metadataFilepath); os.IsNotExist(statErr) {
+		return fmt.Errorf("the entry %v was removed before its upload was completed",
+			strconv.Quote(writeCloser.Metadata.CallReference))
+	}
+	// update sidecar file
+	return writeCloser.FileSystemStorage.writeMetadata(writeCloser.Metadata)
+}
+
+// Initialize is the implementation of the Storage.Initialize method
+func (fileSystemStorage *FileSystemStorage) Initialize() error {
+	// create folder for stored files and their metadata
+	return os.MkdirAll(fileSystemStorage.DataFolder, os.ModePerm)
+}
+
+// Store is the implementation of the Storage.Store method
+func (fileSystemStorage *FileSystemStorage) Store(entry *storage.Entry) (writer io.WriteCloser, err error) {
+	var sidecarFile *os.File
+	for {
+		// create a new random call reference which is also used as the ID
+		entry.CallReference = newCallReference()
+		// the sidecar file is created exclusively to make sure that the call reference is not used yet
+		sidecarFile, err = os.OpenFile(fileSystemStorage.metadataFilepath(entry.CallReference),
+			os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return
+		}
+		break
+	}
+	entry.ID = entry.CallReference
+	// set entry to waiting because the file data is not stored yet
+	metadata := newEntryMetadata(entry, statusWaiting)
+	metadata.ID = entry.CallReference
+	err = json.NewEncoder(sidecarFile).Encode(metadata)
+	if closeErr := sidecarFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	// open file and return a SidecarStatusWriteCloser
+	writer, err = os.Create(fileSystemStorage.dataFilepath(entry.CallReference))
+	if err != nil {
+		return nil, err
+	}
+	// wrap the writer into an instance of the SidecarStatusWriteCloser to change the status after completing the upload
+	return &SidecarStatusWriteCloser{
+		FileSystemStorage: fileSystemStorage,
+		Metadata:          metadata,
+		RealWriteCloser:   writer,
+	}, nil
+}
+
+// Request is the implementation of the Storage.Request method
+func (fileSystemStorage *FileSystemStorage) Request(callReference string) (*storage.Entry, error) {
+	// make sure that the call reference can not be used to access other files
+	if !isValidCallReference(callReference) {
+		return nil, storage.ErrEntryNotFound
+	}
+	metadata, err := fileSystemStorage.readMetadata(callReference)
+	if os.IsNotExist(err) {
+		// return error that entry was not found
+		return nil, storage.ErrEntryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	// uploads which are not completed and expired entries are hidden until they are removed
+	if metadata.Status != statusActivated || metadata.isExpired(time.Now()) {
+		return nil, storage.ErrEntryNotFound
+	}
+	// set all entry values except for the reader
+	entry := metadata.entry()
+	entry.ID = storage.ID(metadata.CallReference)
+	// initiate file based ReadCloseSeekOpener
+	entry.Reader = &FileBasedReadCloseSeekOpener{
+		Filepath: fileSystemStorage.dataFilepath(callReference),
+	}
+	return entry, nil
+}
+
+// CountHit is the implementation of the HitCountingStorage.CountHit method
+func (fileSystemStorage *FileSystemStorage) CountHit(callReference string) error {
+	if !isValidCallReference(callReference) {
+		return storage.ErrEntryNotFound
+	}
+	// the sidecar file is read and written again, so concurrent hits would get lost otherwise
+	fileSystemStorage.hitMutex.Lock()
+	defer fileSystemStorage.hitMutex.Unlock()
+	metadata, err := fileSystemStorage.readMetadata(callReference)
+	if os.IsNotExist(err) {
+		return storage.ErrEntryNotFound
+	} else if err != nil {
+		return err
+	}
+	if metadata.Status != statusActivated {
+		return storage.ErrEntryNotFound
+	}
+	metadata.Hits++
+	return fileSystemStorage.writeMetadata(metadata)
+}
+
+// Query is the implementation of the QueryableStorage.Query method
+func (fileSystemStorage *FileSystemStorage) Query(query *storage.Query) (*storage.QueryResult, error) {
+	metadataSlice, err := fileSystemStorage.readAllMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return queryMetadata(metadataSlice, query)
+}
+
+// Usage is the implementation of the UsageStorage.Usage method
+func (fileSystemStorage *FileSystemStorage) Usage(author storage.AuthorIdentifier) (*storage.Usage, error) {
+	metadataSlice, err := fileSystemStorage.readAllMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return metadataUsage(metadataSlice, author), nil
+}
+
+// DeleteExpired is the implementation of the ExpiringStorage.DeleteExpired method
+func (fileSystemStorage *FileSystemStorage) DeleteExpired(now time.Time) ([]*storage.Entry, error) {
+	return fileSystemStorage.deleteMatching(func(metadata *entryMetadata) bool {
+		return metadata.isExpired(now)
+	})
+}
+
+// DeleteStale is the implementation of the SweepableStorage.DeleteStale method
+func (fileSystemStorage *FileSystemStorage) DeleteStale(uploadedBefore time.Time) ([]*storage.Entry, error) {
+	return fileSystemStorage.deleteMatching(func(metadata *entryMetadata) bool {
+		return metadata.Status != statusActivated && metadata.UploadDate.Before(uploadedBefore)
+	})
+}
+
+// deleteMatching removes all entries whose metadata matches the given function and returns them.
+func (fileSystemStorage *FileSystemStorage) deleteMatching(matches func(*entryMetadata) bool) ([]*storage.Entry,
+	error) {
+	metadataSlice, err := fileSystemStorage.readAllMetadata()
+	if err != nil {
+		return nil, err
+	}
+	deletedEntries := make([]*storage.Entry, 0)
+	for _, metadata := range metadataSlice {
+		if !matches(metadata) {
+			continue
+		}
+		if err := fileSystemStorage.Delete(metadata.CallReference); err == storage.ErrEntryNotFound {
+			// the entry was deleted in the meantime
+			continue
+		} else if err != nil {
+			return deletedEntries, err
+		}
+		entry := metadata.entry()
+		entry.ID = storage.ID(metadata.ID)
+		deletedEntries = append(deletedEntries, entry)
+	}
+	return deletedEntries, nil
+}
+
+// Delete is the implementation of the Storage.Delete method
+func (fileSystemStorage *FileSystemStorage) Delete(callReference string) error {
+	// make sure that the call reference can not be used to delete other files
+	if !isValidCallReference(callReference) {
+		return storage.ErrEntryNotFound
+	}
+	// remove the sidecar file first so that the entry can not be requested anymore
+	if err := os.Remove(fileSystemStorage.metadataFilepath(callReference)); os.IsNotExist(err) {
+		return storage.ErrEntryNotFound
+	} else if err != nil {
+		return err
+	}
+	// the file may not exist if the upload failed
+	if err := os.Remove(fileSystemStorage.dataFilepath(callReference)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return fileSystemStorage.variants().removeAll(callReference)
+}
+
+// CheckConsistency is the implementation of the CheckableStorage.CheckConsistency method
+func (fileSystemStorage *FileSystemStorage) CheckConsistency(
+	options *storage.ConsistencyCheckOptions) (*storage.ConsistencyReport, error) {
+	metadataSlice, err := fileSystemStorage.readAllMetadata()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*consistencyRecord, len(metadataSlice))
+	for i, metadata := range metadataSlice {
+		records[i] = &consistencyRecord{
+			ID:            metadata.ID,
+			CallReference: metadata.CallReference,
+			File:          metadata.CallReference,
+			Status:        metadata.Status,
+			UploadDate:    metadata.UploadDate,
+			Size:          metadata.Size,
+		}
+	}
+	fileInfos, err := ioutil.ReadDir(fileSystemStorage.DataFolder)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]int64)
+	for _, fileInfo := range fileInfos {
+		// sidecar files and other files are ignored
+		if fileInfo.Mode().IsRegular() && isValidCallReference(fileInfo.Name()) {
+			files[fileInfo.Name()] = fileInfo.Size()
+		}
+	}
+	return checkConsistency(records, files, options, fileSystemStorage)
+}
+
+// quarantineEntry is the implementation of the consistencyRepairer.quarantineEntry method
+func (fileSystemStorage *FileSystemStorage) quarantineEntry(record *consistencyRecord, folder string) error {
+	if err := moveFile(fileSystemStorage.metadataFilepath(record.CallReference),
+		record.CallReference+metadataFileSuffix, folder); err != nil {
+		return err
+	}
+	// the variants can be derived from the file data again
+	if err := fileSystemStorage.variants().removeAll(record.CallReference); err != nil {
+		return err
+	}
+	return fileSystemStorage.quarantineFile(record.File, folder)
+}
+
+// deleteEntry is the implementation of the consistencyRepairer.deleteEntry method
+func (fileSystemStorage *FileSystemStorage) deleteEntry(record *consistencyRecord) error {
+	return fileSystemStorage.Delete(record.CallReference)
+}
+
+// quarantineFile is the implementation of the consistencyRepairer.quarantineFile method
+func (fileSystemStorage *FileSystemStorage) quarantineFile(file, folder string) error {
+	return moveFile(fileSystemStorage.dataFilepath(file), file, folder)
+}
+
+// deleteFile is the implementation of the consistencyRepairer.deleteFile method
+func (fileSystemStorage *FileSystemStorage) deleteFile(file string) error {
+	return os.Remove(fileSystemStorage.dataFilepath(file))
+}
+
+// Close is the implementation of the Storage.Close method
+func (fileSystemStorage *FileSystemStorage) Close() error {
+	// nothing has to be closed because every file is closed directly after using it
+	return nil
+}
+
+// readAllMetadata reads all sidecar files of the data folder. There is no index, so every sidecar file has to be read.
+func (fileSystemStorage *FileSystemStorage) readAllMetadata() ([]*entryMetadata, error) {
+	fileInfos, err := ioutil.ReadDir(fileSystemStorage.DataFolder)
+	if err != nil {
+		return nil, err
+	}
+	metadataSlice := make([]*entryMetadata, 0)
+	for _, fileInfo := range fileInfos {
+		callReference := strings.TrimSuffix(fileInfo.Name(), metadataFileSuffix)
+		if fileInfo.IsDir() || callReference == fileInfo.Name() || !isValidCallReference(callReference) {
+			continue
+		}
+		metadata, err := fileSystemStorage.readMetadata(callReference)
+		if os.IsNotExist(err) {
+			// the entry was deleted in the meantime
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		// sidecar files of older versions do not contain the ID
+		metadata.ID = callReference
+		metadataSlice = append(metadataSlice, metadata)
+	}
+	return metadataSlice, nil
+}
+
+// readMetadata reads and decodes the sidecar file of the entry with the given call reference.
+func (fileSystemStorage *FileSystemStorage) readMetadata(callReference string) (*entryMetadata, error) {
+	data, err := ioutil.ReadFile(fileSystemStorage.metadataFilepath(callReference))
+	if err != nil {
+		return nil, err
+	}
+	metadata := &entryMetadata{}
+	if err = json.Unmarshal(data, metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// writeMetadata replaces the sidecar file of the given metadata. The data is written to a temporary file first which
+// is renamed afterwards so that a crash can not leave a half written sidecar file behind.
+func (fileSystemStorage *FileSystemStorage) writeMetadata(metadata *entryMetadata) error {
+	metadataFilepath := fileSystemStorage.metadataFilepath(metadata.CallReference)
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(metadataFilepath+temporaryFileSuffix, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(metadataFilepath+temporaryFileSuffix, metadataFilepath)
+}
+
+// dataFilepath returns the path of the file which contains the uploaded data of the given call reference.
+func (fileSystemStorage *FileSystemStorage) dataFilepath(callReference string) string {
+	return fileSystemStorage.DataFolder + callReference
+}
+
+// metadataFilepath returns the path of the sidecar file which contains the metadata of the given call reference.
+func (fileSystemStorage *FileSystemStorage) metadataFilepath(callReference string) string {
+	return fileSystemStorage.DataFolder + callReference + metadataFileSuffix
+}
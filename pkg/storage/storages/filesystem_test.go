@@ -0,0 +1,337 @@
+package storages
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileSystemStorage(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-filesystem-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	fileSystemStorage := &FileSystemStorage{DataFolder: dataFolder + "/"}
+	if err := fileSystemStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file system storage, %T: %v", err, err)
+	}
+	testBytes := []byte("Hello, this is a test!")
+	entry := &storage.Entry{
+		Author:      storage.AuthorIdentifier("a testing person"),
+		Filename:    "testfile.png",
+		ContentType: "image/png",
+		UploadDate:  time.Now(),
+	}
+	writer, err := fileSystemStorage.Store(entry)
+	if err != nil {
+		t.Fatalf("Could not store entry, %T: %v", err, err)
+	}
+	if _, err := writer.Write(testBytes); err != nil {
+		t.Fatalf("Could not write entry data, %T: %v", err, err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Could not close entry writer, %T: %v", err, err)
+	}
+	requestedEntry, err := fileSystemStorage.Request(entry.CallReference)
+	if err != nil {
+		t.Fatalf("Could not request stored entry, %T: %v", err, err)
+	}
+	if requestedEntry.Filename != entry.Filename || requestedEntry.ContentType != entry.ContentType ||
+		requestedEntry.Author != entry.Author || !requestedEntry.UploadDate.Equal(entry.UploadDate) {
+		t.Fatalf("Requested entry %+v does not match the stored entry %+v", requestedEntry, entry)
+	}
+	if hash := sha256.Sum256(testBytes); requestedEntry.ContentHash != hex.EncodeToString(hash[:]) {
+		t.Fatalf("Invalid content hash %s of the requested entry", requestedEntry.ContentHash)
+	}
+	if err := requestedEntry.Reader.Open(); err != nil {
+		t.Fatalf("Could not open entry reader, %T: %v", err, err)
+	}
+	defer requestedEntry.Reader.Close()
+	if data, err := ioutil.ReadAll(requestedEntry.Reader); err != nil {
+		t.Fatalf("Could not read entry data, %T: %v", err, err)
+	} else if !bytes.Equal(data, testBytes) {
+		t.Fatalf("Read data %q does not match the written data %q", data, testBytes)
+	}
+	if err := fileSystemStorage.Delete(entry.CallReference); err != nil {
+		t.Fatalf("Could not delete entry, %T: %v", err, err)
+	}
+	if err := fileSystemStorage.Delete(entry.CallReference); err != storage.ErrEntryNotFound {
+		t.Fatalf("Expected %v when deleting a deleted entry, got %v", storage.ErrEntryNotFound, err)
+	}
+	invalidCallReferences := []string{entry.CallReference, "abcdef", "../../", entry.CallReference + metadataFileSuffix}
+	for _, callReference := range invalidCallReferences {
+		if _, err := fileSystemStorage.Request(callReference); err != storage.ErrEntryNotFound {
+			t.Fatalf("Expected %v when requesting %q, got %v", storage.ErrEntryNotFound, callReference, err)
+		}
+	}
+}
+
+func TestFileSystemStorageExpiry(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-filesystem-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	fileSystemStorage := &FileSystemStorage{DataFolder: dataFolder + "/"}
+	if err := fileSystemStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file system storage, %T: %v", err, err)
+	}
+	testExpiringStorage(t, fileSystemStorage)
+}
+
+func TestFileSystemStorageStaleUploads(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-filesystem-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	fileSystemStorage := &FileSystemStorage{DataFolder: dataFolder + "/"}
+	if err := fileSystemStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file system storage, %T: %v", err, err)
+	}
+	testSweepableStorage(t, fileSystemStorage)
+}
+
+func TestFileSystemStorageHits(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-filesystem-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	fileSystemStorage := &FileSystemStorage{DataFolder: dataFolder + "/"}
+	if err := fileSystemStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file system storage, %T: %v", err, err)
+	}
+	testHitCountingStorage(t, fileSystemStorage)
+}
+
+func TestFileSystemStorageVariants(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-filesystem-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	fileSystemStorage := &FileSystemStorage{DataFolder: dataFolder + "/"}
+	if err := fileSystemStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file system storage, %T: %v", err, err)
+	}
+	testVariantStorage(t, fileSystemStorage)
+}
+
+// testExpiringStorage stores an expiring and a non-expiring entry in the given storage and checks that only the
+// expiring one is hidden and removed after its expiry date.
+func testExpiringStorage(t *testing.T, fileStorage interface {
+	storage.FileStorage
+	storage.ExpiringStorage
+}) {
+	now := time.Now()
+	entries := []*storage.Entry{
+		{Filename: "expiring.png", ContentType: "image/png", UploadDate: now, ExpiryDate: now.Add(time.Hour)},
+		{Filename: "persistent.png", ContentType: "image/png", UploadDate: now},
+	}
+	for _, entry := range entries {
+		writer, err := fileStorage.Store(entry)
+		if err != nil {
+			t.Fatalf("Could not store entry, %T: %v", err, err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Could not close entry writer, %T: %v", err, err)
+		}
+	}
+	if deletedEntries, err := fileStorage.DeleteExpired(now); err != nil {
+		t.Fatalf("Could not delete expired entries, %T: %v", err, err)
+	} else if len(deletedEntries) != 0 {
+		t.Fatalf("Deleted %d entries before their expiry date", len(deletedEntries))
+	}
+	if requestedEntry, err := fileStorage.Request(entries[0].CallReference); err != nil {
+		t.Fatalf("Could not request the entry before its expiry date, %T: %v", err, err)
+	} else if !requestedEntry.ExpiryDate.Equal(entries[0].ExpiryDate) {
+		t.Fatalf("Requested expiry date %v does not match the stored one %v", requestedEntry.ExpiryDate,
+			entries[0].ExpiryDate)
+	}
+	deletedEntries, err := fileStorage.DeleteExpired(now.Add(2 * time.Hour))
+	if err != nil {
+		t.Fatalf("Could not delete expired entries, %T: %v", err, err)
+	}
+	if len(deletedEntries) != 1 || deletedEntries[0].CallReference != entries[0].CallReference {
+		t.Fatalf("Expected only the expiring entry to be deleted, got %+v", deletedEntries)
+	}
+	if _, err := fileStorage.Request(entries[0].CallReference); err != storage.ErrEntryNotFound {
+		t.Fatalf("Expected %v when requesting an expired entry, got %v", storage.ErrEntryNotFound, err)
+	}
+	if _, err := fileStorage.Request(entries[1].CallReference); err != nil {
+		t.Fatalf("Could not request the non-expiring entry, %T: %v", err, err)
+	}
+}
+
+// testSweepableStorage stores an incomplete upload in the given storage and checks that it is hidden and removed after
+// the grace period without being recreated when the upload is completed afterwards.
+func testSweepableStorage(t *testing.T, fileStorage interface {
+	storage.FileStorage
+	storage.SweepableStorage
+}) {
+	now := time.Now()
+	entry := &storage.Entry{Filename: "incomplete.png", ContentType: "image/png", UploadDate: now}
+	writer, err := fileStorage.Store(entry)
+	if err != nil {
+		t.Fatalf("Could not store entry, %T: %v", err, err)
+	}
+	if _, err := writer.Write([]byte("Hello, this is")); err != nil {
+		t.Fatalf("Could not write entry data, %T: %v", err, err)
+	}
+	if _, err := fileStorage.Request(entry.CallReference); err != storage.ErrEntryNotFound {
+		t.Fatalf("Expected %v when requesting an incomplete upload, got %v", storage.ErrEntryNotFound, err)
+	}
+	if deletedEntries, err := fileStorage.DeleteStale(now); err != nil {
+		t.Fatalf("Could not delete stale uploads, %T: %v", err, err)
+	} else if len(deletedEntries) != 0 {
+		t.Fatalf("Deleted %d uploads within the grace period", len(deletedEntries))
+	}
+	deletedEntries, err := fileStorage.DeleteStale(now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Could not delete stale uploads, %T: %v", err, err)
+	}
+	if len(deletedEntries) != 1 || deletedEntries[0].CallReference != entry.CallReference {
+		t.Fatalf("Expected the incomplete upload to be deleted, got %+v", deletedEntries)
+	}
+	// the upload is completed after it was removed
+	writer.Close()
+	if _, err := fileStorage.Request(entry.CallReference); err != storage.ErrEntryNotFound {
+		t.Fatalf("Expected %v when requesting a removed upload, got %v", storage.ErrEntryNotFound, err)
+	}
+}
+
+// testHitCountingStorage stores a redirect entry in the given storage and checks that its kind is kept and its hits are
+// counted.
+func testHitCountingStorage(t *testing.T, fileStorage interface {
+	storage.FileStorage
+	storage.HitCountingStorage
+}) {
+	entry := &storage.Entry{Kind: storage.KindRedirect, Filename: "example.com", ContentType: "text/uri-list",
+		UploadDate: time.Now()}
+	writer, err := fileStorage.Store(entry)
+	if err != nil {
+		t.Fatalf("Could not store entry, %T: %v", err, err)
+	}
+	writer.Write([]byte("https://example.com/"))
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Could not close entry writer, %T: %v", err, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := fileStorage.CountHit(entry.CallReference); err != nil {
+			t.Fatalf("Could not count hit, %T: %v", err, err)
+		}
+	}
+	requestedEntry, err := fileStorage.Request(entry.CallReference)
+	if err != nil {
+		t.Fatalf("Could not request entry, %T: %v", err, err)
+	}
+	if requestedEntry.Kind != storage.KindRedirect || requestedEntry.Hits != 2 {
+		t.Fatalf("Requested entry has kind %q and %d hits, expected %q and 2", requestedEntry.Kind,
+			requestedEntry.Hits, storage.KindRedirect)
+	}
+	if err := fileStorage.CountHit("unknown"); err != storage.ErrEntryNotFound {
+		t.Fatalf("Expected %v when counting a hit of an unknown entry, got %v", storage.ErrEntryNotFound, err)
+	}
+}
+
+// testVariantStorage stores variants of an entry in the given storage and checks that they can be requested until
+// they are pruned or the entry is deleted.
+func testVariantStorage(t *testing.T, fileStorage interface {
+	storage.FileStorage
+	storage.PrunableVariantStorage
+}) {
+	entry := &storage.Entry{Filename: "image.png", ContentType: "image/png", UploadDate: time.Now()}
+	writer, err := fileStorage.Store(entry)
+	if err != nil {
+		t.Fatalf("Could not store entry, %T: %v", err, err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Could not close entry writer, %T: %v", err, err)
+	}
+	if _, err := fileStorage.RequestVariant(entry.ID, "thumbnail"); err != storage.ErrVariantNotFound {
+		t.Fatalf("Expected %v when requesting a variant which was not stored, got %v", storage.ErrVariantNotFound, err)
+	}
+	if _, err := fileStorage.StoreVariant(entry.ID, "../thumbnail"); err != storage.ErrInvalidVariantName {
+		t.Fatalf("Expected %v when storing a variant with an invalid name, got %v", storage.ErrInvalidVariantName,
+			err)
+	}
+	// the variants are stored one after another, so the first resized one is the least recently stored one
+	for _, name := range []string{"thumbnail", "resized-first", "resized-second"} {
+		variantWriter, err := fileStorage.StoreVariant(entry.ID, name)
+		if err != nil {
+			t.Fatalf("Could not store variant, %T: %v", err, err)
+		}
+		variantWriter.Write([]byte("small"))
+		if err := variantWriter.Close(); err != nil {
+			t.Fatalf("Could not close variant writer, %T: %v", err, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if removed, err := fileStorage.PruneVariants("resized-", 5); err != nil || removed != 1 {
+		t.Fatalf("Pruned %d variants, expected 1 (error: %v)", removed, err)
+	}
+	for name, expectedErr := range map[string]error{
+		"resized-first":  storage.ErrVariantNotFound,
+		"resized-second": nil,
+	} {
+		if _, err := fileStorage.RequestVariant(entry.ID, name); err != expectedErr {
+			t.Fatalf("Expected %v when requesting the variant %s after pruning, got %v", expectedErr, name, err)
+		}
+	}
+	reader, err := fileStorage.RequestVariant(entry.ID, "thumbnail")
+	if err != nil {
+		t.Fatalf("Could not request variant, %T: %v", err, err)
+	}
+	if err := reader.Open(); err != nil {
+		t.Fatalf("Could not open variant reader, %T: %v", err, err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "small" {
+		t.Fatalf("Read variant data %q (error: %v), expected %q", data, err, "small")
+	}
+	if err := fileStorage.Delete(entry.CallReference); err != nil {
+		t.Fatalf("Could not delete entry, %T: %v", err, err)
+	}
+	if _, err := fileStorage.RequestVariant(entry.ID, "thumbnail"); err != storage.ErrVariantNotFound {
+		t.Fatalf("Expected %v when requesting a variant of a deleted entry, got %v", storage.ErrVariantNotFound, err)
+	}
+	if _, err := fileStorage.StoreVariant(entry.ID, "thumbnail"); err != storage.ErrEntryNotFound {
+		t.Fatalf("Expected %v when storing a variant of a deleted entry, got %v", storage.ErrEntryNotFound, err)
+	}
+}
+
+func TestFileSystemStorageActivationFailure(t *testing.T) {
+	dataFolder, err := ioutil.TempDir("", "sharexserver-filesystem-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary data folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(dataFolder)
+	fileSystemStorage := &FileSystemStorage{DataFolder: dataFolder + "/"}
+	if err := fileSystemStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file system storage, %T: %v", err, err)
+	}
+	entry := &storage.Entry{Filename: "testfile.png", ContentType: "image/png", UploadDate: time.Now()}
+	writer, err := fileSystemStorage.Store(entry)
+	if err != nil {
+		t.Fatalf("Could not store entry, %T: %v", err, err)
+	}
+	// the sidecar file can not be updated if the entry was removed as a stale upload in the meantime
+	if err := os.Remove(fileSystemStorage.metadataFilepath(entry.CallReference)); err != nil {
+		t.Fatalf("Could not remove sidecar file, %T: %v", err, err)
+	}
+	if err := writer.Close(); err == nil {
+		t.Fatal("The entry writer was closed without an error although the entry could not be activated")
+	}
+	if _, err := fileSystemStorage.Request(entry.CallReference); err != storage.ErrEntryNotFound {
+		t.Fatalf("Expected %v when requesting the entry which was not activated, got %v", storage.ErrEntryNotFound,
+			err)
+	}
+}
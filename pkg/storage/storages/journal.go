@@ -0,0 +1,187 @@
+package storages
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+)
+
+// journalHeaderSize is the size of the header which precedes every record (payload length and CRC32 checksum).
+const journalHeaderSize = 8
+
+// errCorruptedRecord is returned if a journal record could not be verified by its checksum.
+var errCorruptedRecord = errors.New("corrupted journal record")
+
+// journal is a simple append-only single-file database. Every record is written with its length and checksum and
+// synced to the disk before the append call returns. A failed append is cut off right away, so a crash while
+// appending a record can only leave a truncated or corrupted record at the end of the file which is discarded on the
+// next opening. A corrupted record within the file is not caused by a crash, so the journal is not opened instead of
+// discarding the following records.
+type journal struct {
+	file *os.File
+}
+
+// openJournal opens or creates the journal file with the given filepath and calls the replay function for every valid
+// record. An incomplete or corrupted record at the end of the file is cut off, while a corrupted record before the
+// last one is reported as an error.
+func openJournal(filepath string, replay func(payload []byte) error) (*journal, error) {
+	file, err := os.OpenFile(filepath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	var validOffset int64
+	reader := bufio.NewReader(file)
+	for {
+		payload, err := readJournalRecord(reader, fileInfo.Size()-validOffset)
+		recordEnd := validOffset + journalHeaderSize + int64(len(payload))
+		if err == errCorruptedRecord && recordEnd < fileInfo.Size() {
+			file.Close()
+			return nil, fmt.Errorf("the journal %s contains a corrupted record at offset %d", strconv.Quote(filepath),
+				validOffset)
+		} else if err == io.EOF || err == io.ErrUnexpectedEOF || err == errCorruptedRecord {
+			// the end of the journal or the remains of an interrupted append were reached
+			break
+		} else if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err = replay(payload); err != nil {
+			file.Close()
+			return nil, err
+		}
+		validOffset = recordEnd
+	}
+	// cut off everything after the last valid record and continue appending there
+	if err = file.Truncate(validOffset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err = file.Seek(validOffset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &journal{file: file}, nil
+}
+
+// readJournalRecord reads the next record from the given reader which has the given amount of remaining bytes and
+// verifies its checksum. A header which is the last thing in the file belongs to an incomplete record, so
+// io.ErrUnexpectedEOF is returned. A length which exceeds the remaining bytes otherwise can not be told apart from a
+// corrupted one, so errCorruptedRecord is returned without reading the payload. The payload of a record with an
+// invalid checksum is returned together with errCorruptedRecord, so the caller knows where the corrupted record ends.
+func readJournalRecord(reader io.Reader, remaining int64) ([]byte, error) {
+	header := make([]byte, journalHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[:4]))
+	if length > remaining-journalHeaderSize {
+		if remaining == journalHeaderSize {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, errCorruptedRecord
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return payload, errCorruptedRecord
+	}
+	return payload, nil
+}
+
+// writeJournalRecord writes the given payload including its header to the given writer.
+func writeJournalRecord(writer io.Writer, payload []byte) error {
+	record := make([]byte, journalHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:journalHeaderSize], crc32.ChecksumIEEE(payload))
+	copy(record[journalHeaderSize:], payload)
+	_, err := writer.Write(record)
+	return err
+}
+
+// append encodes the given value as JSON and appends it durably to the journal. If the record could not be written
+// completely, it is cut off again so that the following records are not appended after its remains.
+func (journal *journal) append(value interface{}) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	offset, err := journal.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if err = writeJournalRecord(journal.file, payload); err == nil {
+		err = journal.file.Sync()
+	}
+	if err != nil {
+		if truncateErr := journal.file.Truncate(offset); truncateErr != nil {
+			return fmt.Errorf("%v (the record could not be cut off: %v)", err, truncateErr)
+		}
+		if _, seekErr := journal.file.Seek(offset, io.SeekStart); seekErr != nil {
+			return fmt.Errorf("%v (the record could not be cut off: %v)", err, seekErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// compact replaces the journal with a new one which only contains the given values. The new journal is written to a
+// temporary file first which is renamed afterwards so that the old journal stays intact if something goes wrong.
+func (journal *journal) compact(values []interface{}) error {
+	filepath := journal.file.Name()
+	temporaryFile, err := os.Create(filepath + temporaryFileSuffix)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(temporaryFile)
+	for _, value := range values {
+		var payload []byte
+		if payload, err = json.Marshal(value); err != nil {
+			break
+		}
+		if err = writeJournalRecord(writer, payload); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = temporaryFile.Sync()
+	}
+	if closeErr := temporaryFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temporaryFile.Name())
+		return err
+	}
+	if err = os.Rename(temporaryFile.Name(), filepath); err != nil {
+		return err
+	}
+	// reopen the journal to append the following records to the new file
+	file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	journal.file.Close()
+	journal.file = file
+	return nil
+}
+
+// close closes the underlying journal file.
+func (journal *journal) close() error {
+	return journal.file.Close()
+}
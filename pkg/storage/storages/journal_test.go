@@ -0,0 +1,97 @@
+package storages
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// writeTestJournal writes a journal with the given payloads and returns its filepath and the offsets of the records.
+func writeTestJournal(t *testing.T, folder string, payloads ...string) (string, []int64) {
+	journalFilepath := folder + "/test.journal"
+	file, err := os.Create(journalFilepath)
+	if err != nil {
+		t.Fatalf("Could not create journal file, %T: %v", err, err)
+	}
+	defer file.Close()
+	var offsets []int64
+	var offset int64
+	for _, payload := range payloads {
+		offsets = append(offsets, offset)
+		if err := writeJournalRecord(file, []byte(payload)); err != nil {
+			t.Fatalf("Could not write journal record, %T: %v", err, err)
+		}
+		offset += journalHeaderSize + int64(len(payload))
+	}
+	return journalFilepath, offsets
+}
+
+// flipByte inverts the byte at the given offset of the given file.
+func flipByte(t *testing.T, filepath string, offset int64) {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		t.Fatalf("Could not read journal file, %T: %v", err, err)
+	}
+	data[offset] ^= 0xff
+	if err := ioutil.WriteFile(filepath, data, 0644); err != nil {
+		t.Fatalf("Could not write journal file, %T: %v", err, err)
+	}
+}
+
+// replayJournal opens the journal with the given filepath and returns its payloads.
+func replayJournal(filepath string) ([]string, error) {
+	var payloads []string
+	journal, err := openJournal(filepath, func(payload []byte) error {
+		payloads = append(payloads, string(payload))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payloads, journal.close()
+}
+
+func TestJournalRecovery(t *testing.T) {
+	folder, err := ioutil.TempDir("", "sharexserver-journal-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(folder)
+	// a corrupted last record is the remains of an interrupted append and is cut off
+	journalFilepath, offsets := writeTestJournal(t, folder, `"first"`, `"second"`, `"third"`)
+	flipByte(t, journalFilepath, offsets[2]+journalHeaderSize)
+	if payloads, err := replayJournal(journalFilepath); err != nil ||
+		!reflect.DeepEqual(payloads, []string{`"first"`, `"second"`}) {
+		t.Fatalf("The journal with a corrupted last record was replayed as %v, %v", payloads, err)
+	}
+	// a header at the end of the file belongs to an incomplete record and is cut off without allocating its length
+	file, err := os.OpenFile(journalFilepath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Could not open journal file, %T: %v", err, err)
+	}
+	file.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	file.Close()
+	if payloads, err := replayJournal(journalFilepath); err != nil ||
+		!reflect.DeepEqual(payloads, []string{`"first"`, `"second"`}) {
+		t.Fatalf("The journal with an incomplete last record was replayed as %v, %v", payloads, err)
+	}
+	// a corrupted record within the journal is not cut off together with the following records
+	journalFilepath, offsets = writeTestJournal(t, folder, `"first"`, `"second"`, `"third"`)
+	flipByte(t, journalFilepath, offsets[1]+journalHeaderSize)
+	if _, err := replayJournal(journalFilepath); err == nil {
+		t.Fatal("The journal with a corrupted record in the middle was opened")
+	}
+	if fileInfo, err := os.Stat(journalFilepath); err != nil || fileInfo.Size() != offsets[2]+journalHeaderSize+7 {
+		t.Fatalf("The journal with a corrupted record in the middle was truncated, %v", err)
+	}
+	// a corrupted length within the journal is not mistaken for an incomplete record at the end of the file
+	journalFilepath, offsets = writeTestJournal(t, folder, `"first"`, `"second"`, `"third"`)
+	flipByte(t, journalFilepath, offsets[1])
+	if _, err := replayJournal(journalFilepath); err == nil {
+		t.Fatal("The journal with a corrupted length in the middle was opened")
+	}
+	if fileInfo, err := os.Stat(journalFilepath); err != nil || fileInfo.Size() != offsets[2]+journalHeaderSize+7 {
+		t.Fatalf("The journal with a corrupted length in the middle was truncated, %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package storages
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// defaultBlobCollectionName is used if the MongoStorage.BlobCollectionName is empty
+	defaultBlobCollectionName = "blobs"
+	// MongoDB blob key names
+	blobReferencesField = "references"
+)
+
+// blobCollection returns the collection which contains the reference counts of the content-addressed blobs.
+func (mongoStorage *MongoStorage) blobCollection() *mgo.Collection {
+	collectionName := mongoStorage.BlobCollectionName
+	if collectionName == "" {
+		collectionName = defaultBlobCollectionName
+	}
+	return mongoStorage.session.DB(mongoStorage.DatabaseName).C(collectionName)
+}
+
+// mongoBlobReferenceCounter is the blobReferenceCounter implementation which stores the reference counts as documents
+// identified by the hash of their blob.
+type mongoBlobReferenceCounter struct {
+	collection *mgo.Collection
+}
+
+// addReference is the implementation of the blobReferenceCounter.addReference method
+func (counter *mongoBlobReferenceCounter) addReference(hash string) (int, error) {
+	result := bson.M{}
+	if _, err := counter.collection.FindId(hash).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{blobReferencesField: 1}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &result); err != nil {
+		return 0, err
+	}
+	return result[blobReferencesField].(int), nil
+}
+
+// removeReference is the implementation of the blobReferenceCounter.removeReference method
+func (counter *mongoBlobReferenceCounter) removeReference(hash string) (int, error) {
+	result := bson.M{}
+	if _, err := counter.collection.FindId(hash).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{blobReferencesField: -1}},
+		ReturnNew: true,
+	}, &result); err == mgo.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	references := result[blobReferencesField].(int)
+	if references <= 0 {
+		if err := counter.collection.RemoveId(hash); err != nil && err != mgo.ErrNotFound {
+			return references, err
+		}
+	}
+	return references, nil
+}
@@ -0,0 +1,128 @@
+package storages
+
+import (
+	"errors"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"os"
+	"time"
+)
+
+// quarantineCollectionSuffix is appended to the collection name to build the name of the collection which contains
+// the quarantined documents.
+const quarantineCollectionSuffix = "_quarantine"
+
+// errBlobStoreNotCheckable is returned by the MongoStorage.CheckConsistency method if the blob store does not support
+// the consistency check.
+var errBlobStoreNotCheckable = errors.New("the blob store does not support the consistency check")
+
+// CheckConsistency is the implementation of the CheckableStorage.CheckConsistency method
+func (mongoStorage *MongoStorage) CheckConsistency(
+	options *storage.ConsistencyCheckOptions) (*storage.ConsistencyReport, error) {
+	blobStore, ok := mongoStorage.BlobStore.(CheckableBlobStore)
+	if !ok {
+		return nil, errBlobStoreNotCheckable
+	}
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	// the IDs are ordered by their creation time, so the oldest entry of a call reference is the first one
+	iter := collection.Find(nil).Select(bson.M{
+		callReferenceField: 1,
+		statusField:        1,
+		uploadDateField:    1,
+		sizeField:          1,
+		blobField:          1,
+	}).Sort(iDField).Iter()
+	records := make([]*consistencyRecord, 0)
+	var document bson.M
+	for iter.Next(&document) {
+		objectID := document[iDField].(bson.ObjectId)
+		record := &consistencyRecord{ID: objectID.Hex(), File: blobName(document)}
+		record.CallReference, _ = document[callReferenceField].(string)
+		record.Status, _ = document[statusField].(int)
+		record.UploadDate, _ = document[uploadDateField].(time.Time)
+		// entries which were stored before the size was recorded do not have one
+		switch size := document[sizeField].(type) {
+		case int64:
+			record.Size = size
+		case int:
+			record.Size = int64(size)
+		}
+		records = append(records, record)
+		document = nil
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	blobs, err := blobStore.List()
+	if err != nil {
+		return nil, err
+	}
+	// the blob store may contain other files, so only the ones named like IDs or content hashes are checked
+	files := make(map[string]int64, len(blobs))
+	for name, size := range blobs {
+		if bson.IsObjectIdHex(name) || isContentHash(name) {
+			files[name] = size
+		}
+	}
+	return checkConsistency(records, files, options, mongoStorage)
+}
+
+// quarantineEntry is the implementation of the consistencyRepairer.quarantineEntry method
+func (mongoStorage *MongoStorage) quarantineEntry(record *consistencyRecord, folder string) error {
+	database := mongoStorage.session.DB(mongoStorage.DatabaseName)
+	collection := database.C(mongoStorage.CollectionName)
+	objectID := bson.ObjectIdHex(record.ID)
+	document := bson.M{}
+	if err := collection.FindId(objectID).One(&document); err == mgo.ErrNotFound {
+		return storage.ErrEntryNotFound
+	} else if err != nil {
+		return err
+	}
+	// the document is moved to the quarantine collection before it is removed
+	if _, err := database.C(mongoStorage.CollectionName+quarantineCollectionSuffix).UpsertId(objectID,
+		document); err != nil {
+		return err
+	}
+	if err := collection.RemoveId(objectID); err != nil {
+		return err
+	}
+	return mongoStorage.removeBlob(record.File, folder)
+}
+
+// deleteEntry is the implementation of the consistencyRepairer.deleteEntry method
+func (mongoStorage *MongoStorage) deleteEntry(record *consistencyRecord) error {
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	// the entry is removed by its ID because other entries may use the same call reference
+	if err := collection.RemoveId(bson.ObjectIdHex(record.ID)); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	return mongoStorage.removeBlob(record.File, "")
+}
+
+// quarantineFile is the implementation of the consistencyRepairer.quarantineFile method
+func (mongoStorage *MongoStorage) quarantineFile(file, folder string) error {
+	if err := mongoStorage.BlobStore.(CheckableBlobStore).Quarantine(file, folder); err != nil {
+		return err
+	}
+	return mongoStorage.removeBlobReferences(file)
+}
+
+// deleteFile is the implementation of the consistencyRepairer.deleteFile method
+func (mongoStorage *MongoStorage) deleteFile(file string) error {
+	if err := mongoStorage.BlobStore.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return mongoStorage.removeBlobReferences(file)
+}
+
+// removeBlobReferences removes the reference count of an orphaned content-addressed blob.
+func (mongoStorage *MongoStorage) removeBlobReferences(file string) error {
+	if !isContentHash(file) {
+		return nil
+	}
+	if err := mongoStorage.blobCollection().RemoveId(file); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	return nil
+}
@@ -1,18 +1,14 @@
 package storages
 
 import (
-	"bytes"
-	cryptRand "crypto/rand"
 	"errors"
-	"fmt"
 	"github.com/mmichaelb/sharexserver/pkg/storage"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io"
 	"log"
-	"math/big"
-	mathRand "math/rand"
 	"os"
+	"regexp"
 	"strconv"
 	"time"
 )
@@ -22,11 +18,16 @@ const (
 	statusWaiting = iota
 	statusActivated
 	statusFailed
-	// Data to generate new call references
-	callReferenceChars  = "abcdefghijklmnopqrstuvxyzABCDEFGHIJKLMNOPQRSTUVXYZ1234567890"
-	callReferenceLength = 6
+	statusQuarantined
 	// MongoDB index names
-	referenceIndexName = "reference_index"
+	referenceIndexName   = "reference_index"
+	authorIndexName      = "author_index"
+	contentTypeIndexName = "content_type_index"
+	uploadDateIndexName  = "upload_date_index"
+	expiryDateIndexName  = "expiry_date_index"
+	// expiryDateIndexGracePeriod is the time after which MongoDB removes expired documents on its own. It gives the
+	// DeleteExpired method the chance to remove the file data together with the document.
+	expiryDateIndexGracePeriod = 24 * time.Hour
 	// MongoDB key names
 	iDField            = "_id"
 	statusField        = "status"
@@ -35,6 +36,15 @@ const (
 	filenameField      = "filename"
 	contentTypeField   = "content_type"
 	uploadDateField    = "upload_date"
+	deletionHashField  = "deletion_hash"
+	expiryDateField    = "expiry_date"
+	sizeField          = "size"
+	contentHashField   = "content_hash"
+	blobField          = "blob"
+	kindField          = "kind"
+	hitsField          = "hits"
+	// quarantineReasonField contains the reason why an entry was quarantined.
+	quarantineReasonField = "quarantine_reason"
 )
 
 // MongoStorage is the FileStorage implementation for the Database MongoDB in combination with the file data stored in
@@ -44,11 +54,29 @@ type MongoStorage struct {
 	DialInfo *mgo.DialInfo
 	// DatabaseName and CollectionName define the MongoDB specific names used to store data.
 	DatabaseName, CollectionName string
+	// TokenCollectionName is the name of the collection which contains the access tokens of the uploaders. If it is
+	// empty, "tokens" is used.
+	TokenCollectionName string
 	// DataFolder is the folder where uploaded files are stored in. This can be an absolute or a relative path. It has
 	// to end with a slash ("/").
 	DataFolder string
+	// BlobStore is used to store the file data. If it is nil, the file data is stored in standard system files inside
+	// of the DataFolder.
+	BlobStore BlobStore
+	// Deduplicate enables the content addressing of new uploads: their file data is stored as a blob named by its hash
+	// which is shared by all entries with the same content. The uploads are written to temporary files inside of the
+	// DataFolder until their hash is known. Blobs of entries which were removed by the expiry date index instead of
+	// DeleteExpired are not released; they are reported as orphaned files by the consistency check.
+	Deduplicate bool
+	// BlobCollectionName is the name of the collection which contains the reference counts of the content-addressed
+	// blobs. If it is empty, "blobs" is used.
+	BlobCollectionName string
+	// VariantCollectionName is the name of the collection which contains the documents of the variants which are
+	// stored as blobs next to the file data. If it is empty, "variants" is used.
+	VariantCollectionName string
 	// internal values
 	session *mgo.Session
+	blobs   *contentAddressedBlobs
 }
 
 // StatusChangeWriteCloser is an extend implementation if io.FileWriter to update the database entry on close.
@@ -59,25 +87,68 @@ type StatusChangeWriteCloser struct {
 	ID bson.ObjectId
 	// Real writer which is used to process the data.
 	RealWriteCloser io.WriteCloser
+	// internal values
+	hasher contentHasher
 }
 
-// Write just calls the real writer to process the data.
+// Write calls the real writer to process the data and hashes the written bytes.
 func (writeCloser *StatusChangeWriteCloser) Write(p []byte) (int, error) {
-	return writeCloser.RealWriteCloser.Write(p)
+	n, err := writeCloser.RealWriteCloser.Write(p)
+	writeCloser.hasher.add(p[:n])
+	return n, err
 }
 
 // Close is the extended function which also updates the database entry.
-func (writeCloser *StatusChangeWriteCloser) Close() (err error) {
-	var updatedStatus int
-	if err = writeCloser.RealWriteCloser.Close(); err != nil {
+func (writeCloser *StatusChangeWriteCloser) Close() error {
+	return writeCloser.finish(bson.M{statusField: statusActivated})
+}
+
+// CloseQuarantined is the implementation of the storage.QuarantiningWriter.CloseQuarantined method
+func (writeCloser *StatusChangeWriteCloser) CloseQuarantined(reason string) error {
+	return writeCloser.finish(bson.M{statusField: statusQuarantined, quarantineReasonField: reason})
+}
+
+// finish closes the real writer and applies the given status update to the database entry. The entry is marked as
+// failed instead if the data could not be written. If the database entry could not be updated, it stays waiting and
+// is removed as a stale upload later on.
+func (writeCloser *StatusChangeWriteCloser) finish(statusUpdate bson.M) (err error) {
+	update := bson.M{
+		sizeField:        writeCloser.hasher.size,
+		contentHashField: writeCloser.hasher.sum(),
+	}
+	err = writeCloser.RealWriteCloser.Close()
+	// content-addressed data is stored as a blob named by its hash after it was written completely
+	if committer, ok := writeCloser.RealWriteCloser.(contentCommitter); ok && err == nil {
+		if err = committer.commit(update[contentHashField].(string)); err == nil {
+			update[blobField] = update[contentHashField]
+		}
+	}
+	if err != nil {
 		// set status to failed because an error occurred
-		updatedStatus = statusFailed
+		update[statusField] = statusFailed
 	} else {
-		// set status to activated because the data was successfully written
-		updatedStatus = statusActivated
+		// set the requested status because the data was successfully written
+		for field, value := range statusUpdate {
+			update[field] = value
+		}
 	}
 	// update database entry
-	if mongoErr := writeCloser.Collection.UpdateId(writeCloser.ID, bson.M{"$set": bson.M{statusField: updatedStatus}}); err != nil {
+	if mongoErr := writeCloser.Collection.UpdateId(writeCloser.ID, bson.M{"$set": update}); mongoErr != nil {
+		log.Printf("An error occurred while updating the status of %v, %T: %+v",
+			strconv.Quote(writeCloser.ID.String()), mongoErr, mongoErr)
+		if err == nil {
+			err = mongoErr
+		}
+	}
+	return
+}
+
+// Abort is the implementation of the storage.Aborter.Abort method
+func (writeCloser *StatusChangeWriteCloser) Abort() (err error) {
+	// content-addressed data is never committed, so only the blobs named by the ID remain until the entry is stale
+	err = storage.Abort(writeCloser.RealWriteCloser)
+	if mongoErr := writeCloser.Collection.UpdateId(writeCloser.ID,
+		bson.M{"$set": bson.M{statusField: statusFailed}}); mongoErr != nil {
 		log.Printf("An error occurred while updating the status of %v, %T: %+v",
 			strconv.Quote(writeCloser.ID.String()), mongoErr, mongoErr)
 	}
@@ -86,8 +157,12 @@ func (writeCloser *StatusChangeWriteCloser) Close() (err error) {
 
 // Initialize is the implementation of the Storage.Initialize method
 func (mongoStorage *MongoStorage) Initialize() (err error) {
-	// create folder for stored files
-	if err = os.MkdirAll(mongoStorage.DataFolder, os.ModePerm); err != nil {
+	// use standard system files if no other blob store was set
+	if mongoStorage.BlobStore == nil {
+		mongoStorage.BlobStore = &FolderBlobStore{Folder: mongoStorage.DataFolder}
+	}
+	// e.g. create folder for stored files
+	if err = mongoStorage.BlobStore.Initialize(); err != nil {
 		return
 	}
 	// connect to MongoDB server
@@ -95,50 +170,58 @@ func (mongoStorage *MongoStorage) Initialize() (err error) {
 	if err != nil {
 		return
 	}
-	// create call reference index if it not exists
-	database := mongoStorage.session.DB(mongoStorage.DatabaseName)
-	collection := database.C(mongoStorage.CollectionName)
-	// check whether db/collection exists
-	if names, err := database.CollectionNames(); err != nil {
-		return err
-	} else if len(names) > 0 {
-		indexes, err := collection.Indexes()
-		if err != nil {
-			return err
-		}
-		for _, index := range indexes {
-			if index.Name == referenceIndexName {
-				return err
-			}
+	// content-addressed blobs may also exist if the deduplication was disabled afterwards
+	mongoStorage.blobs = &contentAddressedBlobs{
+		blobStore:  mongoStorage.BlobStore,
+		references: &mongoBlobReferenceCounter{collection: mongoStorage.blobCollection()},
+	}
+	// create the indexes used to find and query entries if they do not exist
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	for _, index := range []mgo.Index{
+		{Name: referenceIndexName, Key: []string{callReferenceField}},
+		{Name: authorIndexName, Key: []string{authorField, "-" + iDField}},
+		{Name: contentTypeIndexName, Key: []string{contentTypeField, "-" + iDField}},
+		{Name: uploadDateIndexName, Key: []string{uploadDateField}},
+		{Name: expiryDateIndexName, Key: []string{expiryDateField}, ExpireAfter: expiryDateIndexGracePeriod},
+	} {
+		if err = collection.EnsureIndex(index); err != nil {
+			return
 		}
 	}
-	err = collection.EnsureIndex(mgo.Index{
-		Name: referenceIndexName,
-		Key:  []string{callReferenceField},
-	})
+	if err = mongoStorage.initializeVariants(); err != nil {
+		return
+	}
+	err = mongoStorage.initializeTokens()
 	return
 }
 
 // Store is the implementation of the Storage.Store method
 func (mongoStorage *MongoStorage) Store(entry *storage.Entry) (writer io.WriteCloser, err error) {
-	fmt.Printf("%d %d %d\n", statusWaiting, statusActivated, statusFailed)
 	// use the provided collection to store the data in
 	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
 randomCreation:
-// create a new random ID and call reference
+	// create a new random ID and call reference
 	objectId := bson.NewObjectId()
 	entry.ID = objectId
-	entry.CallReference = mongoStorage.newCallReference()
+	entry.CallReference = newCallReference()
+	// entries which never expire are stored without an expiry date so that they are ignored by the expiry date index
+	var expiryDate interface{}
+	if !entry.ExpiryDate.IsZero() {
+		expiryDate = entry.ExpiryDate
+	}
 	// insert the file details into the collection
 	if err = collection.Insert(
 		bson.D{
 			{iDField, entry.ID},
 			{statusField, statusWaiting}, // set entry to waiting because the file data is not stored yet
 			{callReferenceField, entry.CallReference},
+			{kindField, string(entry.Kind)},
 			{authorField, entry.Author},
 			{filenameField, entry.Filename},
 			{contentTypeField, entry.ContentType},
 			{uploadDateField, entry.UploadDate},
+			{deletionHashField, entry.DeletionHash},
+			{expiryDateField, expiryDate},
 		}); err != nil {
 		if lastErr, ok := err.(*mgo.LastError); ok && lastErr.Code == 11000 {
 			// duplicate key error
@@ -149,7 +232,14 @@ randomCreation:
 		}
 	}
 	// open file and return a StatusChangeWriteCloser
-	writer, err = os.Create(mongoStorage.DataFolder + objectId.Hex())
+	if mongoStorage.Deduplicate {
+		// the name of the blob is not known until the data was hashed
+		var temporaryFile *os.File
+		temporaryFile, err = os.Create(mongoStorage.temporaryFilepath(objectId))
+		writer = &contentAddressedWriteCloser{File: temporaryFile, blobs: mongoStorage.blobs}
+	} else {
+		writer, err = mongoStorage.BlobStore.Create(objectId.Hex())
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -161,25 +251,6 @@ randomCreation:
 	}, nil
 }
 
-// method which randomly creates a new call reference
-func (mongoStorage *MongoStorage) newCallReference() string {
-	buf := bytes.NewBuffer([]byte{})
-	randomMaximum := big.NewInt(int64(len(callReferenceChars)))
-	for i := 0; i < callReferenceLength; i++ {
-		var randomIndex int
-		randomIntIndex, err := cryptRand.Int(cryptRand.Reader, randomMaximum)
-		if err != nil {
-			log.Printf("Could not get create random call reference with crypto/rand. "+
-				"Falling back to (insecure) math/rand package. %T: %v\n", err, err)
-			randomIndex = mathRand.Intn(len(callReferenceChars))
-		} else {
-			randomIndex = int(randomIntIndex.Int64())
-		}
-		buf.WriteString(callReferenceChars[randomIndex : randomIndex+1])
-	}
-	return buf.String()
-}
-
 // FileBasedReadCloseSeekOpener is the file based implementation of the ReadCloseSeekOpener which opens a file when
 // calling the Open method
 type FileBasedReadCloseSeekOpener struct {
@@ -224,8 +295,8 @@ func (mongoStorage *MongoStorage) Request(callReference string) (*storage.Entry,
 	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
 	// read result to a simple bson map
 	result := &bson.M{}
-	// find the entry by its call reference
-	if err := collection.Find(bson.M{callReferenceField: callReference}).One(result); err == mgo.ErrNotFound {
+	// find the entry by its call reference, uploads which are not completed are hidden until they are removed
+	if err := findActivated(collection, callReference).One(result); err == mgo.ErrNotFound {
 		// return error that entry was not found
 		return nil, storage.ErrEntryNotFound
 	} else if err != nil {
@@ -233,19 +304,268 @@ func (mongoStorage *MongoStorage) Request(callReference string) (*storage.Entry,
 		return nil, err
 	}
 	// set all entry values except for the reader
+	entry := entryFromDocument(*result)
+	// expired entries are hidden until they are removed by DeleteExpired or the expiry date index
+	if entry.IsExpired(time.Now()) {
+		return nil, storage.ErrEntryNotFound
+	}
+	// initiate the ReadCloseSeekOpener of the blob store
+	entry.Reader = mongoStorage.BlobStore.Open(blobName(*result))
+	return entry, nil
+}
+
+// findActivated returns the query which finds the activated entry with the given call reference. Uploads which are
+// not completed or quarantined are never found. If the call reference is duplicated, the oldest activated entry is
+// found, so Request, Delete and CountHit always resolve the same entry.
+func findActivated(collection *mgo.Collection, callReference string) *mgo.Query {
+	return collection.Find(bson.M{callReferenceField: callReference, statusField: statusActivated}).Sort(iDField)
+}
+
+// CountHit is the implementation of the HitCountingStorage.CountHit method
+func (mongoStorage *MongoStorage) CountHit(callReference string) error {
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	// the hit is counted for the entry which is resolved by the Request method
+	result := &bson.M{}
+	if err := findActivated(collection, callReference).Select(bson.M{iDField: 1}).One(result); err == mgo.ErrNotFound {
+		return storage.ErrEntryNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := collection.UpdateId((*result)[iDField],
+		bson.M{"$inc": bson.M{hitsField: int64(1)}}); err == mgo.ErrNotFound {
+		return storage.ErrEntryNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Query is the implementation of the QueryableStorage.Query method
+func (mongoStorage *MongoStorage) Query(query *storage.Query) (*storage.QueryResult, error) {
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	// uploads which are not completed and expired entries are hidden until they are removed
+	filter := bson.M{statusField: statusActivated, "$or": []bson.M{
+		{expiryDateField: nil},
+		{expiryDateField: bson.M{"$gt": time.Now()}},
+	}}
+	if query.Author != "" {
+		filter[authorField] = string(query.Author)
+	}
+	if query.ContentTypePrefix != "" {
+		// an anchored regular expression is able to use the content type index
+		filter[contentTypeField] = bson.RegEx{Pattern: "^" + regexp.QuoteMeta(query.ContentTypePrefix)}
+	}
+	uploadDateFilter := bson.M{}
+	if !query.From.IsZero() {
+		uploadDateFilter["$gte"] = query.From
+	}
+	if !query.Until.IsZero() {
+		uploadDateFilter["$lt"] = query.Until
+	}
+	if len(uploadDateFilter) > 0 {
+		filter[uploadDateField] = uploadDateFilter
+	}
+	// the cursor is the ID of the last entry of the previous page because the IDs are ordered by their creation time
+	if query.Cursor != "" {
+		if !bson.IsObjectIdHex(query.Cursor) {
+			return nil, storage.ErrInvalidCursor
+		}
+		filter[iDField] = bson.M{"$lt": bson.ObjectIdHex(query.Cursor)}
+	}
+	mongoQuery := collection.Find(filter).Sort("-" + iDField)
+	if query.Limit > 0 {
+		// request one more entry to check whether there is another page
+		mongoQuery = mongoQuery.Limit(query.Limit + 1)
+	}
+	var results []bson.M
+	if err := mongoQuery.All(&results); err != nil {
+		return nil, err
+	}
+	queryResult := &storage.QueryResult{}
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+		queryResult.Cursor = results[len(results)-1][iDField].(bson.ObjectId).Hex()
+	}
+	queryResult.Entries = make([]*storage.Entry, len(results))
+	for i, result := range results {
+		queryResult.Entries[i] = entryFromDocument(result)
+	}
+	return queryResult, nil
+}
+
+// entryFromDocument returns an entry containing all values of the given document except for the reader.
+func entryFromDocument(document bson.M) *storage.Entry {
 	entry := &storage.Entry{
-		ID:            storage.ID((*result)[iDField]),
-		CallReference: (*result)[callReferenceField].(string),
-		Author:        storage.AuthorIdentifier((*result)[authorField].(string)),
-		Filename:      (*result)[filenameField].(string),
-		ContentType:   (*result)[contentTypeField].(string),
-		UploadDate:    (*result)[uploadDateField].(time.Time),
+		ID:            storage.ID(document[iDField]),
+		CallReference: document[callReferenceField].(string),
+		Author:        storage.AuthorIdentifier(document[authorField].(string)),
+		Filename:      document[filenameField].(string),
+		ContentType:   document[contentTypeField].(string),
+		UploadDate:    document[uploadDateField].(time.Time),
 	}
-	// initiate file based ReadCloseSeekOpener
-	entry.Reader = &FileBasedReadCloseSeekOpener{
-		Filepath: mongoStorage.DataFolder + (*result)[iDField].(bson.ObjectId).Hex(),
+	// entries which were stored before deletion tokens were introduced do not have a deletion hash
+	if deletionHash, ok := document[deletionHashField].(string); ok {
+		entry.DeletionHash = deletionHash
 	}
-	return entry, nil
+	if expiryDate, ok := document[expiryDateField].(time.Time); ok {
+		entry.ExpiryDate = expiryDate
+	}
+	if contentHash, ok := document[contentHashField].(string); ok {
+		entry.ContentHash = contentHash
+	}
+	if kind, ok := document[kindField].(string); ok {
+		entry.Kind = storage.EntryKind(kind)
+	}
+	switch hits := document[hitsField].(type) {
+	case int64:
+		entry.Hits = hits
+	case int:
+		entry.Hits = int64(hits)
+	}
+	return entry
+}
+
+// blobName returns the name of the blob which contains the file data of the given document. It is the content hash
+// for content-addressed blobs and the ID for all other ones.
+func blobName(document bson.M) string {
+	if name, ok := document[blobField].(string); ok {
+		return name
+	}
+	return document[iDField].(bson.ObjectId).Hex()
+}
+
+// removeBlob removes the blob with the given name after its entry was removed. Content-addressed blobs are only
+// removed if no other entry references them. If a quarantine folder is given, the blob is moved there instead.
+func (mongoStorage *MongoStorage) removeBlob(name, quarantineFolder string) error {
+	if isContentHash(name) {
+		return mongoStorage.blobs.release(name, quarantineFolder)
+	}
+	// an upload which was not completed may have left its temporary file behind
+	if bson.IsObjectIdHex(name) {
+		os.Remove(mongoStorage.temporaryFilepath(bson.ObjectIdHex(name)))
+	}
+	if quarantineFolder != "" {
+		if checkableBlobStore, ok := mongoStorage.BlobStore.(CheckableBlobStore); ok {
+			return checkableBlobStore.Quarantine(name, quarantineFolder)
+		}
+	}
+	// the file may not exist if the upload failed
+	if err := mongoStorage.BlobStore.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// temporaryFilepath returns the path of the temporary file of a content-addressed upload.
+func (mongoStorage *MongoStorage) temporaryFilepath(objectID bson.ObjectId) string {
+	return mongoStorage.DataFolder + objectID.Hex() + temporaryFileSuffix
+}
+
+// Usage is the implementation of the UsageStorage.Usage method
+func (mongoStorage *MongoStorage) Usage(author storage.AuthorIdentifier) (*storage.Usage, error) {
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	var results []struct {
+		Bytes int64 `bson:"bytes"`
+		Files int   `bson:"files"`
+	}
+	if err := collection.Pipe([]bson.M{
+		{"$match": bson.M{authorField: string(author), statusField: bson.M{"$ne": statusFailed}, "$or": []bson.M{
+			{expiryDateField: nil},
+			{expiryDateField: bson.M{"$gt": time.Now()}},
+		}}},
+		// the size of uploads which are still in progress is not set yet and therefore ignored by $sum
+		{"$group": bson.M{"_id": nil, "bytes": bson.M{"$sum": "$" + sizeField}, "files": bson.M{"$sum": 1}}},
+	}).All(&results); err != nil {
+		return nil, err
+	}
+	usage := &storage.Usage{}
+	if len(results) > 0 {
+		usage.Bytes, usage.Files = results[0].Bytes, results[0].Files
+	}
+	return usage, nil
+}
+
+// DeleteExpired is the implementation of the ExpiringStorage.DeleteExpired method
+func (mongoStorage *MongoStorage) DeleteExpired(now time.Time) ([]*storage.Entry, error) {
+	return mongoStorage.deleteMatching(bson.M{expiryDateField: bson.M{"$lte": now}})
+}
+
+// DeleteStale is the implementation of the SweepableStorage.DeleteStale method
+func (mongoStorage *MongoStorage) DeleteStale(uploadedBefore time.Time) ([]*storage.Entry, error) {
+	// quarantined entries are kept for a review
+	return mongoStorage.deleteMatching(bson.M{
+		statusField:     bson.M{"$in": []int{statusWaiting, statusFailed}},
+		uploadDateField: bson.M{"$lt": uploadedBefore},
+	})
+}
+
+// Quarantine is the implementation of the QuarantiningStorage.Quarantine method
+func (mongoStorage *MongoStorage) Quarantine(id storage.ID, reason string) error {
+	objectID, ok := id.(bson.ObjectId)
+	if !ok {
+		return storage.ErrEntryNotFound
+	}
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	if err := collection.UpdateId(objectID, bson.M{"$set": bson.M{
+		statusField:           statusQuarantined,
+		quarantineReasonField: reason,
+	}}); err == mgo.ErrNotFound {
+		return storage.ErrEntryNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// deleteMatching removes all entries which match the given filter including their file data and returns them.
+func (mongoStorage *MongoStorage) deleteMatching(filter bson.M) ([]*storage.Entry, error) {
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	var results []bson.M
+	if err := collection.Find(filter).All(&results); err != nil {
+		return nil, err
+	}
+	deletedEntries := make([]*storage.Entry, 0, len(results))
+	for _, result := range results {
+		objectID := result[iDField].(bson.ObjectId)
+		if err := collection.RemoveId(objectID); err == mgo.ErrNotFound {
+			// the entry was deleted in the meantime
+			continue
+		} else if err != nil {
+			return deletedEntries, err
+		}
+		if err := mongoStorage.removeBlob(blobName(result), ""); err != nil {
+			return deletedEntries, err
+		}
+		if err := mongoStorage.removeVariants(objectID); err != nil {
+			return deletedEntries, err
+		}
+		deletedEntries = append(deletedEntries, entryFromDocument(result))
+	}
+	return deletedEntries, nil
+}
+
+// Delete is the implementation of the Storage.Delete method
+func (mongoStorage *MongoStorage) Delete(callReference string) error {
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	// find the entry which is resolved by the Request method to resolve the name of its blob
+	result := &bson.M{}
+	if err := findActivated(collection, callReference).Select(bson.M{iDField: 1, blobField: 1}).
+		One(result); err == mgo.ErrNotFound {
+		return storage.ErrEntryNotFound
+	} else if err != nil {
+		return err
+	}
+	objectID := (*result)[iDField].(bson.ObjectId)
+	// remove the document first so that the entry can not be requested anymore
+	if err := collection.RemoveId(objectID); err == mgo.ErrNotFound {
+		return storage.ErrEntryNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := mongoStorage.removeBlob(blobName(*result), ""); err != nil {
+		return err
+	}
+	return mongoStorage.removeVariants(objectID)
 }
 
 // Close is the implementation of the Storage.Close method
@@ -255,4 +575,4 @@ func (mongoStorage *MongoStorage) Close() error {
 	// close connection to MongoDB server
 	mongoStorage.session.Close()
 	return nil
-}
\ No newline at end of file
+}
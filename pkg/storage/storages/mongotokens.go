@@ -0,0 +1,115 @@
+package storages
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+const (
+	// defaultTokenCollectionName is used if the MongoStorage.TokenCollectionName is empty
+	defaultTokenCollectionName = "tokens"
+	// MongoDB token index names
+	tokenHashIndexName = "token_hash_index"
+	// MongoDB token key names
+	tokenHashField         = "hash"
+	tokenCreationDateField = "creation_date"
+	tokenDefaultTTLField   = "default_ttl"
+	tokenQuotaBytesField   = "quota_bytes"
+	tokenQuotaFilesField   = "quota_files"
+)
+
+// tokenCollection returns the collection which contains the tokens.
+func (mongoStorage *MongoStorage) tokenCollection() *mgo.Collection {
+	collectionName := mongoStorage.TokenCollectionName
+	if collectionName == "" {
+		collectionName = defaultTokenCollectionName
+	}
+	return mongoStorage.session.DB(mongoStorage.DatabaseName).C(collectionName)
+}
+
+// initializeTokens creates the index which is used to resolve the tokens by their hash.
+func (mongoStorage *MongoStorage) initializeTokens() error {
+	return mongoStorage.tokenCollection().EnsureIndex(mgo.Index{
+		Name:   tokenHashIndexName,
+		Key:    []string{tokenHashField},
+		Unique: true,
+	})
+}
+
+// StoreToken is the implementation of the TokenStorage.StoreToken method
+func (mongoStorage *MongoStorage) StoreToken(token *storage.Token) error {
+	return mongoStorage.tokenCollection().Insert(bson.M{
+		iDField:                token.ID,
+		authorField:            string(token.Author),
+		tokenHashField:         token.Hash,
+		tokenCreationDateField: token.CreationDate,
+		// the default time-to-live is stored in seconds
+		tokenDefaultTTLField: int64(token.DefaultTTL / time.Second),
+		tokenQuotaBytesField: token.Quota.Bytes,
+		tokenQuotaFilesField: token.Quota.Files,
+	})
+}
+
+// ResolveToken is the implementation of the TokenStorage.ResolveToken method
+func (mongoStorage *MongoStorage) ResolveToken(hash string) (*storage.Token, error) {
+	result := bson.M{}
+	if err := mongoStorage.tokenCollection().Find(bson.M{tokenHashField: hash}).One(&result); err == mgo.ErrNotFound {
+		return nil, storage.ErrTokenNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return tokenFromDocument(result), nil
+}
+
+// RevokeToken is the implementation of the TokenStorage.RevokeToken method
+func (mongoStorage *MongoStorage) RevokeToken(id string) error {
+	if err := mongoStorage.tokenCollection().RemoveId(id); err == mgo.ErrNotFound {
+		return storage.ErrTokenNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Tokens is the implementation of the TokenStorage.Tokens method
+func (mongoStorage *MongoStorage) Tokens() ([]*storage.Token, error) {
+	var results []bson.M
+	if err := mongoStorage.tokenCollection().Find(nil).Sort(tokenCreationDateField).All(&results); err != nil {
+		return nil, err
+	}
+	tokens := make([]*storage.Token, len(results))
+	for i, result := range results {
+		tokens[i] = tokenFromDocument(result)
+	}
+	return tokens, nil
+}
+
+// tokenFromDocument returns a token containing all values of the given document.
+func tokenFromDocument(document bson.M) *storage.Token {
+	token := &storage.Token{
+		ID:           document[iDField].(string),
+		Author:       storage.AuthorIdentifier(document[authorField].(string)),
+		Hash:         document[tokenHashField].(string),
+		CreationDate: document[tokenCreationDateField].(time.Time),
+	}
+	// tokens which were issued before the default time-to-live was introduced do not have one
+	switch defaultTTL := document[tokenDefaultTTLField].(type) {
+	case int64:
+		token.DefaultTTL = time.Duration(defaultTTL) * time.Second
+	case int:
+		token.DefaultTTL = time.Duration(defaultTTL) * time.Second
+	}
+	// the same applies to the quota
+	switch quotaBytes := document[tokenQuotaBytesField].(type) {
+	case int64:
+		token.Quota.Bytes = quotaBytes
+	case int:
+		token.Quota.Bytes = int64(quotaBytes)
+	}
+	if quotaFiles, ok := document[tokenQuotaFilesField].(int); ok {
+		token.Quota.Files = quotaFiles
+	}
+	return token
+}
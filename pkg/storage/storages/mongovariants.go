@@ -0,0 +1,198 @@
+package storages
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"os"
+	"regexp"
+	"time"
+)
+
+const (
+	// defaultVariantCollectionName is used if the MongoStorage.VariantCollectionName is empty
+	defaultVariantCollectionName = "variants"
+	// MongoDB variant index names
+	variantEntryIndexName = "entry_index"
+	variantNameIndexName  = "name_index"
+	// MongoDB variant key names
+	variantEntryField      = "entry"
+	variantNameField       = "name"
+	variantSizeField       = "size"
+	variantStoredDateField = "stored_date"
+)
+
+// variantCollection returns the collection which contains the documents of the stored variants. The documents are
+// identified by the names of the blobs which contain the variants.
+func (mongoStorage *MongoStorage) variantCollection() *mgo.Collection {
+	collectionName := mongoStorage.VariantCollectionName
+	if collectionName == "" {
+		collectionName = defaultVariantCollectionName
+	}
+	return mongoStorage.session.DB(mongoStorage.DatabaseName).C(collectionName)
+}
+
+// initializeVariants creates the indexes of the variant collection if they do not exist.
+func (mongoStorage *MongoStorage) initializeVariants() error {
+	collection := mongoStorage.variantCollection()
+	for _, index := range []mgo.Index{
+		{Name: variantEntryIndexName, Key: []string{variantEntryField}},
+		{Name: variantNameIndexName, Key: []string{variantNameField, "-" + variantStoredDateField}},
+	} {
+		if err := collection.EnsureIndex(index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// variantBlobWriteCloser writes a variant to the blob store of a MongoStorage and records it within the variant
+// collection once it was closed.
+type variantBlobWriteCloser struct {
+	io.WriteCloser
+	mongoStorage *MongoStorage
+	objectID     bson.ObjectId
+	name         string
+	size         int64
+}
+
+// Write writes the given data to the blob and counts its size.
+func (writeCloser *variantBlobWriteCloser) Write(p []byte) (int, error) {
+	n, err := writeCloser.WriteCloser.Write(p)
+	writeCloser.size += int64(n)
+	return n, err
+}
+
+// Close closes the blob writer and records the variant.
+func (writeCloser *variantBlobWriteCloser) Close() error {
+	if err := writeCloser.WriteCloser.Close(); err != nil {
+		return err
+	}
+	mongoStorage := writeCloser.mongoStorage
+	blobName := variantBlobName(writeCloser.objectID, writeCloser.name)
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	if count, err := collection.FindId(writeCloser.objectID).Count(); err != nil {
+		return err
+	} else if count == 0 {
+		// the entry was deleted while the variant was written
+		mongoStorage.BlobStore.Remove(blobName)
+		return storage.ErrEntryNotFound
+	}
+	_, err := mongoStorage.variantCollection().UpsertId(blobName, bson.M{
+		variantEntryField:      writeCloser.objectID,
+		variantNameField:       writeCloser.name,
+		variantSizeField:       writeCloser.size,
+		variantStoredDateField: time.Now(),
+	})
+	return err
+}
+
+// Abort is the implementation of the storage.Aborter interface which aborts the blob writer.
+func (writeCloser *variantBlobWriteCloser) Abort() error {
+	return storage.Abort(writeCloser.WriteCloser)
+}
+
+// variantBlobName returns the name of the blob which contains the variant with the given name of the entry with the
+// given ID.
+func variantBlobName(objectID bson.ObjectId, name string) string {
+	return objectID.Hex() + "." + name
+}
+
+// StoreVariant is the implementation of the VariantStorage.StoreVariant method
+func (mongoStorage *MongoStorage) StoreVariant(id storage.ID, name string) (io.WriteCloser, error) {
+	if !storage.IsValidVariantName(name) {
+		return nil, storage.ErrInvalidVariantName
+	}
+	objectID, ok := id.(bson.ObjectId)
+	if !ok {
+		return nil, storage.ErrEntryNotFound
+	}
+	collection := mongoStorage.session.DB(mongoStorage.DatabaseName).C(mongoStorage.CollectionName)
+	if count, err := collection.FindId(objectID).Count(); err != nil {
+		return nil, err
+	} else if count == 0 {
+		return nil, storage.ErrEntryNotFound
+	}
+	writer, err := mongoStorage.BlobStore.Create(variantBlobName(objectID, name))
+	if err != nil {
+		return nil, err
+	}
+	return &variantBlobWriteCloser{WriteCloser: writer, mongoStorage: mongoStorage, objectID: objectID, name: name}, nil
+}
+
+// RequestVariant is the implementation of the VariantStorage.RequestVariant method
+func (mongoStorage *MongoStorage) RequestVariant(id storage.ID, name string) (storage.ReadCloseSeekOpener, error) {
+	if !storage.IsValidVariantName(name) {
+		return nil, storage.ErrInvalidVariantName
+	}
+	objectID, ok := id.(bson.ObjectId)
+	if !ok {
+		return nil, storage.ErrVariantNotFound
+	}
+	blobName := variantBlobName(objectID, name)
+	// only the variants which were written completely are recorded
+	if count, err := mongoStorage.variantCollection().FindId(blobName).Count(); err != nil {
+		return nil, err
+	} else if count == 0 {
+		return nil, storage.ErrVariantNotFound
+	}
+	return mongoStorage.BlobStore.Open(blobName), nil
+}
+
+// PruneVariants is the implementation of the PrunableVariantStorage.PruneVariants method
+func (mongoStorage *MongoStorage) PruneVariants(prefix string, maximumBytes int64) (int, error) {
+	collection := mongoStorage.variantCollection()
+	// the most recently stored variants are kept
+	iter := collection.Find(bson.M{variantNameField: bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}).
+		Select(bson.M{variantSizeField: 1}).Sort("-" + variantStoredDateField).Iter()
+	var totalBytes int64
+	var removed int
+	var document bson.M
+	for iter.Next(&document) {
+		switch size := document[variantSizeField].(type) {
+		case int64:
+			totalBytes += size
+		case int:
+			totalBytes += int64(size)
+		}
+		blobName := document[iDField].(string)
+		document = nil
+		if totalBytes <= maximumBytes {
+			continue
+		}
+		if err := mongoStorage.removeVariant(blobName); err != nil {
+			iter.Close()
+			return removed, err
+		}
+		removed++
+	}
+	return removed, iter.Close()
+}
+
+// removeVariants removes all variants of the entry with the given ID.
+func (mongoStorage *MongoStorage) removeVariants(objectID bson.ObjectId) error {
+	var documents []bson.M
+	if err := mongoStorage.variantCollection().Find(bson.M{variantEntryField: objectID}).
+		Select(bson.M{iDField: 1}).All(&documents); err != nil {
+		return err
+	}
+	for _, document := range documents {
+		if err := mongoStorage.removeVariant(document[iDField].(string)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeVariant removes the document and the blob of the variant with the given blob name.
+func (mongoStorage *MongoStorage) removeVariant(blobName string) error {
+	// the document is removed first so that the variant can not be requested anymore
+	if err := mongoStorage.variantCollection().RemoveId(blobName); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	if err := mongoStorage.BlobStore.Remove(blobName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package storages
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryMetadata filters, sorts and pages the given metadata according to the provided query. It is used by the
+// storages which do not have a database to run the query. The cursor consists of the upload date and the ID of the
+// last entry of the previous page.
+func queryMetadata(metadataSlice []*entryMetadata, query *storage.Query) (*storage.QueryResult, error) {
+	var cursorDate int64
+	var cursorID string
+	if query.Cursor != "" {
+		cursorParts := strings.SplitN(query.Cursor, ".", 2)
+		if len(cursorParts) != 2 {
+			return nil, storage.ErrInvalidCursor
+		}
+		var err error
+		if cursorDate, err = strconv.ParseInt(cursorParts[0], 10, 64); err != nil {
+			return nil, storage.ErrInvalidCursor
+		}
+		cursorID = cursorParts[1]
+	}
+	now := time.Now()
+	matches := make([]*entryMetadata, 0)
+	for _, metadata := range metadataSlice {
+		// expired entries and uploads which are not completed are hidden until they are removed
+		if metadata.Status != statusActivated || metadata.isExpired(now) || !metadataMatchesQuery(metadata, query) {
+			continue
+		}
+		// skip all entries which were already returned by the previous pages
+		if query.Cursor != "" {
+			uploadDate := metadata.UploadDate.UnixNano()
+			if uploadDate > cursorDate || (uploadDate == cursorDate && metadata.ID >= cursorID) {
+				continue
+			}
+		}
+		matches = append(matches, metadata)
+	}
+	// sort the entries beginning with the newest one
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].UploadDate.Equal(matches[j].UploadDate) {
+			return matches[i].UploadDate.After(matches[j].UploadDate)
+		}
+		return matches[i].ID > matches[j].ID
+	})
+	queryResult := &storage.QueryResult{}
+	if query.Limit > 0 && len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+		lastMetadata := matches[len(matches)-1]
+		queryResult.Cursor = strconv.FormatInt(lastMetadata.UploadDate.UnixNano(), 10) + "." + lastMetadata.ID
+	}
+	queryResult.Entries = make([]*storage.Entry, len(matches))
+	for i, metadata := range matches {
+		queryResult.Entries[i] = metadata.entry()
+		queryResult.Entries[i].ID = storage.ID(metadata.ID)
+	}
+	return queryResult, nil
+}
+
+// metadataMatchesQuery checks whether the given metadata matches all filters of the provided query.
+func metadataMatchesQuery(metadata *entryMetadata, query *storage.Query) bool {
+	if query.Author != "" && metadata.Author != string(query.Author) {
+		return false
+	}
+	if !strings.HasPrefix(metadata.ContentType, query.ContentTypePrefix) {
+		return false
+	}
+	if !query.From.IsZero() && metadata.UploadDate.Before(query.From) {
+		return false
+	}
+	if !query.Until.IsZero() && !metadata.UploadDate.Before(query.Until) {
+		return false
+	}
+	return true
+}
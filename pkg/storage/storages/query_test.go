@@ -0,0 +1,60 @@
+package storages
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQueryMetadata(t *testing.T) {
+	uploadDate := time.Date(2018, time.March, 1, 12, 0, 0, 0, time.UTC)
+	metadataSlice := make([]*entryMetadata, 0)
+	for i := 0; i < 10; i++ {
+		contentType, author := "image/png", "first author"
+		if i%2 == 1 {
+			contentType, author = "text/plain", "second author"
+		}
+		metadataSlice = append(metadataSlice, &entryMetadata{
+			ID:          strconv.Itoa(i),
+			Status:      statusActivated,
+			Author:      author,
+			ContentType: contentType,
+			// every two entries share the same upload date to test the sorting by ID
+			UploadDate: uploadDate.Add(time.Duration(i/2) * time.Hour),
+		})
+	}
+	// entries which are not activated must never be returned
+	metadataSlice = append(metadataSlice, &entryMetadata{ID: "waiting", Status: statusWaiting,
+		ContentType: "image/png", UploadDate: uploadDate})
+	var ids []string
+	query := &storage.Query{ContentTypePrefix: "image/", Until: uploadDate.Add(4 * time.Hour), Limit: 2}
+	for page := 0; ; page++ {
+		queryResult, err := queryMetadata(metadataSlice, query)
+		if err != nil {
+			t.Fatalf("Could not query metadata, %T: %v", err, err)
+		}
+		for _, entry := range queryResult.Entries {
+			ids = append(ids, entry.ID.(string))
+		}
+		if queryResult.Cursor == "" {
+			break
+		}
+		query.Cursor = queryResult.Cursor
+	}
+	if expectedIDs := []string{"6", "4", "2", "0"}; !reflect.DeepEqual(ids, expectedIDs) {
+		t.Fatalf("Invalid query result IDs %v, expected %v", ids, expectedIDs)
+	}
+	queryResult, err := queryMetadata(metadataSlice, &storage.Query{Author: "second author",
+		From: uploadDate.Add(3 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Could not query metadata, %T: %v", err, err)
+	}
+	if len(queryResult.Entries) != 2 || queryResult.Entries[0].ID != "9" || queryResult.Cursor != "" {
+		t.Fatalf("Invalid query result %+v", queryResult)
+	}
+	if _, err := queryMetadata(metadataSlice, &storage.Query{Cursor: "invalid"}); err != storage.ErrInvalidCursor {
+		t.Fatalf("Expected %v when using an invalid cursor, got %v", storage.ErrInvalidCursor, err)
+	}
+}
@@ -0,0 +1,372 @@
+package storages
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// s3PartSize is the size of the parts of a multipart upload. S3 requires every part except for the last one to be
+	// at least 5 MB big. Uploads which are smaller than this are sent with a single request.
+	s3PartSize = 5 << 20
+	// S3 object metadata keys
+	s3AuthorMetadataKey       = "author"
+	s3FilenameMetadataKey     = "filename"
+	s3UploadDateMetadataKey   = "upload-date"
+	s3DeletionHashMetadataKey = "deletion-hash"
+	s3ExpiryDateMetadataKey   = "expiry-date"
+	s3KindMetadataKey         = "kind"
+)
+
+// errUploadAborted is returned by the S3ObjectWriteCloser after its upload was aborted.
+var errUploadAborted = errors.New("the upload has been aborted")
+
+// S3Storage is the FileStorage implementation which stores the file data in an S3-compatible object storage. The entry
+// metadata is stored as the metadata of the objects, so no additional database is needed. To store the metadata in
+// MongoDB instead, use the MongoStorage with an S3BlobStore. Expired objects are removed when they are requested, so
+// a lifecycle rule of the bucket should be used to remove the ones which are never requested again.
+type S3Storage struct {
+	// Bucket is the bucket the objects are stored in.
+	Bucket *S3Bucket
+	// KeyPrefix is prepended to the call reference to build the object key, e.g. "uploads/".
+	KeyPrefix string
+}
+
+// Initialize is the implementation of the Storage.Initialize method
+func (s3Storage *S3Storage) Initialize() error {
+	// nothing has to be initialized because every request is stateless
+	return nil
+}
+
+// Store is the implementation of the Storage.Store method
+func (s3Storage *S3Storage) Store(entry *storage.Entry) (io.WriteCloser, error) {
+	for {
+		// create a new random call reference which is not used yet
+		entry.CallReference = newCallReference()
+		if _, err := s3Storage.Bucket.headObject(s3Storage.KeyPrefix + entry.CallReference); isS3NotFound(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	entry.ID = s3Storage.KeyPrefix + entry.CallReference
+	metadata := map[string]string{
+		s3AuthorMetadataKey:       url.QueryEscape(string(entry.Author)),
+		s3FilenameMetadataKey:     url.QueryEscape(entry.Filename),
+		s3UploadDateMetadataKey:   entry.UploadDate.UTC().Format(time.RFC3339Nano),
+		s3DeletionHashMetadataKey: entry.DeletionHash,
+	}
+	if entry.Kind != "" {
+		metadata[s3KindMetadataKey] = string(entry.Kind)
+	}
+	if !entry.ExpiryDate.IsZero() {
+		metadata[s3ExpiryDateMetadataKey] = entry.ExpiryDate.UTC().Format(time.RFC3339Nano)
+	}
+	// the object does not exist until its upload is completed, so there is no need of a waiting status
+	return &S3ObjectWriteCloser{
+		Bucket:      s3Storage.Bucket,
+		Key:         entry.ID.(string),
+		ContentType: entry.ContentType,
+		Metadata:    metadata,
+	}, nil
+}
+
+// Request is the implementation of the Storage.Request method
+func (s3Storage *S3Storage) Request(callReference string) (*storage.Entry, error) {
+	// make sure that the call reference can not be used to access other objects
+	if !isValidCallReference(callReference) {
+		return nil, storage.ErrEntryNotFound
+	}
+	key := s3Storage.KeyPrefix + callReference
+	objectInfo, err := s3Storage.Bucket.headObject(key)
+	if isS3NotFound(err) {
+		// return error that entry was not found
+		return nil, storage.ErrEntryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	author, err := url.QueryUnescape(objectInfo.metadata[s3AuthorMetadataKey])
+	if err != nil {
+		return nil, err
+	}
+	filename, err := url.QueryUnescape(objectInfo.metadata[s3FilenameMetadataKey])
+	if err != nil {
+		return nil, err
+	}
+	uploadDate, err := time.Parse(time.RFC3339Nano, objectInfo.metadata[s3UploadDateMetadataKey])
+	if err != nil {
+		return nil, err
+	}
+	var expiryDate time.Time
+	if rawExpiryDate, ok := objectInfo.metadata[s3ExpiryDateMetadataKey]; ok {
+		if expiryDate, err = time.Parse(time.RFC3339Nano, rawExpiryDate); err != nil {
+			return nil, err
+		}
+		// there is no way to find expired objects without requesting them, so they are removed here
+		if !expiryDate.After(time.Now()) {
+			if err := s3Storage.Bucket.deleteObject(key); err != nil {
+				log.Printf("An error occurred while removing the expired object %v, %T: %+v",
+					strconv.Quote(key), err, err)
+			}
+			return nil, storage.ErrEntryNotFound
+		}
+	}
+	return &storage.Entry{
+		ID:            storage.ID(key),
+		CallReference: callReference,
+		Kind:          storage.EntryKind(objectInfo.metadata[s3KindMetadataKey]),
+		Author:        storage.AuthorIdentifier(author),
+		Filename:      filename,
+		ContentType:   objectInfo.contentType,
+		UploadDate:    uploadDate,
+		ExpiryDate:    expiryDate,
+		DeletionHash:  objectInfo.metadata[s3DeletionHashMetadataKey],
+		Reader: &S3ReadCloseSeekOpener{
+			Bucket: s3Storage.Bucket,
+			Key:    key,
+			Size:   objectInfo.size,
+		},
+	}, nil
+}
+
+// Delete is the implementation of the Storage.Delete method
+func (s3Storage *S3Storage) Delete(callReference string) error {
+	// make sure that the call reference can not be used to delete other objects
+	if !isValidCallReference(callReference) {
+		return storage.ErrEntryNotFound
+	}
+	key := s3Storage.KeyPrefix + callReference
+	// S3 does not report whether a deleted object existed, so this is checked before
+	if _, err := s3Storage.Bucket.headObject(key); isS3NotFound(err) {
+		return storage.ErrEntryNotFound
+	} else if err != nil {
+		return err
+	}
+	return s3Storage.Bucket.deleteObject(key)
+}
+
+// Close is the implementation of the Storage.Close method
+func (s3Storage *S3Storage) Close() error {
+	// nothing has to be closed because every request is stateless
+	return nil
+}
+
+// S3BlobStore is the BlobStore implementation which stores the blobs as objects of an S3-compatible object storage.
+type S3BlobStore struct {
+	// Bucket is the bucket the objects are stored in.
+	Bucket *S3Bucket
+	// KeyPrefix is prepended to the blob names to build the object keys, e.g. "blobs/".
+	KeyPrefix string
+}
+
+// Initialize is the implementation of the BlobStore.Initialize method
+func (s3BlobStore *S3BlobStore) Initialize() error {
+	// nothing has to be initialized because every request is stateless
+	return nil
+}
+
+// Create is the implementation of the BlobStore.Create method
+func (s3BlobStore *S3BlobStore) Create(name string) (io.WriteCloser, error) {
+	return &S3ObjectWriteCloser{
+		Bucket: s3BlobStore.Bucket,
+		Key:    s3BlobStore.KeyPrefix + name,
+	}, nil
+}
+
+// Open is the implementation of the BlobStore.Open method
+func (s3BlobStore *S3BlobStore) Open(name string) storage.ReadCloseSeekOpener {
+	return &S3ReadCloseSeekOpener{
+		Bucket: s3BlobStore.Bucket,
+		Key:    s3BlobStore.KeyPrefix + name,
+		Size:   -1,
+	}
+}
+
+// Remove is the implementation of the BlobStore.Remove method
+func (s3BlobStore *S3BlobStore) Remove(name string) error {
+	return s3BlobStore.Bucket.deleteObject(s3BlobStore.KeyPrefix + name)
+}
+
+// S3ObjectWriteCloser is the io.WriteCloser implementation which uploads the written data as an S3 object. The data is
+// buffered and uploaded in parts, so the object size does not have to be known in advance.
+type S3ObjectWriteCloser struct {
+	// Bucket is the bucket the object is stored in.
+	Bucket *S3Bucket
+	// Key is the key of the created object.
+	Key string
+	// ContentType and Metadata are stored with the object.
+	ContentType string
+	Metadata    map[string]string
+	// internal values
+	buffer   bytes.Buffer
+	uploadID string
+	parts    []*s3CompletedPart
+	err      error
+}
+
+// Write buffers the given data and uploads a part as soon as the buffer is big enough.
+func (writeCloser *S3ObjectWriteCloser) Write(p []byte) (int, error) {
+	if writeCloser.err != nil {
+		return 0, writeCloser.err
+	}
+	writeCloser.buffer.Write(p)
+	for writeCloser.buffer.Len() >= s3PartSize {
+		if writeCloser.err = writeCloser.uploadPart(writeCloser.buffer.Next(s3PartSize)); writeCloser.err != nil {
+			writeCloser.abort()
+			return 0, writeCloser.err
+		}
+	}
+	return len(p), nil
+}
+
+// Close uploads the remaining data and completes the upload. The object is not visible before.
+func (writeCloser *S3ObjectWriteCloser) Close() error {
+	if writeCloser.err != nil {
+		return writeCloser.err
+	}
+	if writeCloser.uploadID == "" {
+		// the data fits into a single request
+		writeCloser.err = writeCloser.Bucket.putObject(writeCloser.Key, writeCloser.ContentType, writeCloser.Metadata,
+			writeCloser.buffer.Bytes())
+		return writeCloser.err
+	}
+	if writeCloser.buffer.Len() > 0 {
+		if writeCloser.err = writeCloser.uploadPart(writeCloser.buffer.Bytes()); writeCloser.err != nil {
+			writeCloser.abort()
+			return writeCloser.err
+		}
+	}
+	if writeCloser.err = writeCloser.Bucket.completeMultipartUpload(writeCloser.Key, writeCloser.uploadID,
+		writeCloser.parts); writeCloser.err != nil {
+		writeCloser.abort()
+	}
+	return writeCloser.err
+}
+
+// Abort is the implementation of the storage.Aborter.Abort method. The object is never created.
+func (writeCloser *S3ObjectWriteCloser) Abort() error {
+	if writeCloser.err == nil {
+		writeCloser.err = errUploadAborted
+		writeCloser.abort()
+	}
+	return nil
+}
+
+// uploadPart uploads the given data as the next part of the multipart upload which is created if necessary.
+func (writeCloser *S3ObjectWriteCloser) uploadPart(data []byte) (err error) {
+	if writeCloser.uploadID == "" {
+		if writeCloser.uploadID, err = writeCloser.Bucket.createMultipartUpload(writeCloser.Key,
+			writeCloser.ContentType, writeCloser.Metadata); err != nil {
+			return
+		}
+	}
+	part, err := writeCloser.Bucket.uploadPart(writeCloser.Key, writeCloser.uploadID, len(writeCloser.parts)+1, data)
+	if err != nil {
+		return
+	}
+	writeCloser.parts = append(writeCloser.parts, part)
+	return
+}
+
+// abort discards the already uploaded parts of the multipart upload.
+func (writeCloser *S3ObjectWriteCloser) abort() {
+	if writeCloser.uploadID == "" {
+		return
+	}
+	if err := writeCloser.Bucket.abortMultipartUpload(writeCloser.Key, writeCloser.uploadID); err != nil {
+		log.Printf("An error occurred while aborting the multipart upload of %v, %T: %+v",
+			strconv.Quote(writeCloser.Key), err, err)
+	}
+}
+
+// S3ReadCloseSeekOpener is the S3 based implementation of the ReadCloseSeekOpener. Seeking is done by requesting the
+// object data with a range beginning at the new offset, so partial content can be served without downloading the
+// whole object.
+type S3ReadCloseSeekOpener struct {
+	// Bucket is the bucket the object is stored in.
+	Bucket *S3Bucket
+	// Key is the key of the object.
+	Key string
+	// Size is the size of the object. If it is negative, it is requested when calling the Open method.
+	Size int64
+	// internal values
+	opened bool
+	offset int64
+	body   io.ReadCloser
+}
+
+// Read reads the object data beginning at the current offset and can not be called until the Open method was.
+func (s3ReadCloseSeekOpener *S3ReadCloseSeekOpener) Read(p []byte) (n int, err error) {
+	if !s3ReadCloseSeekOpener.opened {
+		return -1, errors.New("the Open method has not been called yet")
+	}
+	if s3ReadCloseSeekOpener.offset >= s3ReadCloseSeekOpener.Size {
+		return 0, io.EOF
+	}
+	// request the object data beginning at the current offset if no request is running
+	if s3ReadCloseSeekOpener.body == nil {
+		if s3ReadCloseSeekOpener.body, err = s3ReadCloseSeekOpener.Bucket.getObject(s3ReadCloseSeekOpener.Key,
+			s3ReadCloseSeekOpener.offset); err != nil {
+			return 0, err
+		}
+	}
+	n, err = s3ReadCloseSeekOpener.body.Read(p)
+	s3ReadCloseSeekOpener.offset += int64(n)
+	return
+}
+
+// Close closes the running request and can not be called until the Open method was.
+func (s3ReadCloseSeekOpener *S3ReadCloseSeekOpener) Close() (err error) {
+	if !s3ReadCloseSeekOpener.opened {
+		return errors.New("the Open method has not been called yet")
+	}
+	if s3ReadCloseSeekOpener.body != nil {
+		err = s3ReadCloseSeekOpener.body.Close()
+		s3ReadCloseSeekOpener.body = nil
+	}
+	return
+}
+
+// Seek changes the offset of the next Read call and can not be called until the Open method was.
+func (s3ReadCloseSeekOpener *S3ReadCloseSeekOpener) Seek(offset int64, whence int) (int64, error) {
+	if !s3ReadCloseSeekOpener.opened {
+		return -1, errors.New("the Open method has not been called yet")
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += s3ReadCloseSeekOpener.offset
+	case io.SeekEnd:
+		offset += s3ReadCloseSeekOpener.Size
+	}
+	if offset < 0 {
+		return -1, errors.New("negative offset")
+	}
+	if offset != s3ReadCloseSeekOpener.offset {
+		// the running request can not be used anymore because it starts at a different offset
+		if s3ReadCloseSeekOpener.body != nil {
+			s3ReadCloseSeekOpener.body.Close()
+			s3ReadCloseSeekOpener.body = nil
+		}
+		s3ReadCloseSeekOpener.offset = offset
+	}
+	return offset, nil
+}
+
+// Open enables the other methods and requests the object size if it is not known yet.
+func (s3ReadCloseSeekOpener *S3ReadCloseSeekOpener) Open() error {
+	if s3ReadCloseSeekOpener.Size < 0 {
+		objectInfo, err := s3ReadCloseSeekOpener.Bucket.headObject(s3ReadCloseSeekOpener.Key)
+		if err != nil {
+			return err
+		}
+		s3ReadCloseSeekOpener.Size = objectInfo.size
+	}
+	s3ReadCloseSeekOpener.opened = true
+	return nil
+}
@@ -0,0 +1,346 @@
+package storages
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AWS signature version 4 values
+	s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+	s3ServiceName      = "s3"
+	s3DateFormat       = "20060102"
+	s3DateTimeFormat   = "20060102T150405Z"
+	// S3 specific header names
+	s3ContentHashHeader    = "X-Amz-Content-Sha256"
+	s3DateHeader           = "X-Amz-Date"
+	s3MetadataHeaderPrefix = "X-Amz-Meta-"
+)
+
+// S3Error is returned if an S3-compatible server responds with an error.
+type S3Error struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Code and Message are parsed from the XML error response if it was sent.
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// Error is the implementation of the error interface.
+func (s3Error *S3Error) Error() string {
+	return fmt.Sprintf("S3 request failed with status %d (%s): %s", s3Error.StatusCode, s3Error.Code, s3Error.Message)
+}
+
+// isS3NotFound checks whether the given error was caused by a missing object.
+func isS3NotFound(err error) bool {
+	s3Error, ok := err.(*S3Error)
+	return ok && s3Error.StatusCode == http.StatusNotFound
+}
+
+// S3Bucket contains the information used to access a bucket of an S3-compatible object storage like AWS S3 or MinIO.
+// Requests are signed with the AWS signature version 4.
+type S3Bucket struct {
+	// Endpoint is the base URL of the S3 server, e.g. "https://s3.eu-central-1.amazonaws.com" or
+	// "http://localhost:9000".
+	Endpoint string
+	// Region is the region the bucket is located in. MinIO uses "us-east-1" per default.
+	Region string
+	// Name is the name of the bucket.
+	Name string
+	// AccessKeyID and SecretAccessKey are the credentials used to sign the requests.
+	AccessKeyID, SecretAccessKey string
+	// PathStyle determines whether the bucket name is part of the path ("http://endpoint/bucket/key") instead of the
+	// host ("http://bucket.endpoint/key"). Most S3 stand-ins like MinIO need this to be set.
+	PathStyle bool
+	// HTTPClient is used to send the requests. If it is nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// s3ObjectInfo contains the information returned by a HEAD request of an object.
+type s3ObjectInfo struct {
+	size        int64
+	contentType string
+	metadata    map[string]string
+}
+
+// objectURL returns the URL of the object with the given key and query values.
+func (s3Bucket *S3Bucket) objectURL(key string, query url.Values) (*url.URL, error) {
+	objectURL, err := url.Parse(s3Bucket.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if s3Bucket.PathStyle {
+		objectURL.Path = strings.TrimSuffix(objectURL.Path, "/") + "/" + s3Bucket.Name + "/" + key
+	} else {
+		objectURL.Host = s3Bucket.Name + "." + objectURL.Host
+		objectURL.Path = strings.TrimSuffix(objectURL.Path, "/") + "/" + key
+	}
+	objectURL.RawPath = awsURIEncode(objectURL.Path, false)
+	objectURL.RawQuery = awsCanonicalQuery(query)
+	return objectURL, nil
+}
+
+// do signs and sends a request to the object with the given key. Responses with an error status are converted to an
+// S3Error.
+func (s3Bucket *S3Bucket) do(method, key string, query url.Values, header http.Header,
+	body []byte) (*http.Response, error) {
+	objectURL, err := s3Bucket.objectURL(key, query)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(method, objectURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// keep the exact encoding of the path which is used for the signature
+	request.URL = objectURL
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	request.ContentLength = int64(len(body))
+	s3Bucket.sign(request, body, time.Now())
+	httpClient := s3Bucket.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= http.StatusMultipleChoices {
+		defer response.Body.Close()
+		s3Error := &S3Error{StatusCode: response.StatusCode}
+		// HEAD responses do not contain a body, so the error details are optional
+		if data, err := ioutil.ReadAll(response.Body); err == nil && len(data) > 0 {
+			xml.Unmarshal(data, s3Error)
+		}
+		return nil, s3Error
+	}
+	return response, nil
+}
+
+// sign adds the AWS signature version 4 authorization header to the given request.
+func (s3Bucket *S3Bucket) sign(request *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	payloadHash := sha256.Sum256(body)
+	request.Header.Set(s3ContentHashHeader, hex.EncodeToString(payloadHash[:]))
+	request.Header.Set(s3DateHeader, now.Format(s3DateTimeFormat))
+	// the host and all S3 specific headers have to be signed
+	canonicalHeaders := map[string]string{"host": request.URL.Host}
+	for name := range request.Header {
+		if lowerName := strings.ToLower(name); strings.HasPrefix(lowerName, "x-amz-") ||
+			lowerName == "content-type" || lowerName == "range" {
+			canonicalHeaders[lowerName] = strings.TrimSpace(request.Header.Get(name))
+		}
+	}
+	headerNames := make([]string, 0, len(canonicalHeaders))
+	for name := range canonicalHeaders {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	canonicalRequest := bytes.NewBufferString(request.Method + "\n" + request.URL.EscapedPath() + "\n" +
+		request.URL.RawQuery + "\n")
+	for _, name := range headerNames {
+		canonicalRequest.WriteString(name + ":" + canonicalHeaders[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+	canonicalRequest.WriteString("\n" + signedHeaders + "\n" + hex.EncodeToString(payloadHash[:]))
+	canonicalRequestHash := sha256.Sum256(canonicalRequest.Bytes())
+	scope := now.Format(s3DateFormat) + "/" + s3Bucket.Region + "/" + s3ServiceName + "/aws4_request"
+	stringToSign := s3SigningAlgorithm + "\n" + now.Format(s3DateTimeFormat) + "\n" + scope + "\n" +
+		hex.EncodeToString(canonicalRequestHash[:])
+	// derive the signing key from the secret access key
+	signingKey := hmacSHA256([]byte("AWS4"+s3Bucket.SecretAccessKey), now.Format(s3DateFormat))
+	signingKey = hmacSHA256(signingKey, s3Bucket.Region)
+	signingKey = hmacSHA256(signingKey, s3ServiceName)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm, s3Bucket.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// putObject uploads the given data as the object with the given key.
+func (s3Bucket *S3Bucket) putObject(key, contentType string, metadata map[string]string, data []byte) error {
+	response, err := s3Bucket.do(http.MethodPut, key, nil, s3ObjectHeader(contentType, metadata), data)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// headObject requests the information about the object with the given key.
+func (s3Bucket *S3Bucket) headObject(key string) (*s3ObjectInfo, error) {
+	response, err := s3Bucket.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+	objectInfo := &s3ObjectInfo{
+		size:        response.ContentLength,
+		contentType: response.Header.Get("Content-Type"),
+		metadata:    make(map[string]string),
+	}
+	for name := range response.Header {
+		if canonicalName := http.CanonicalHeaderKey(name); strings.HasPrefix(canonicalName, s3MetadataHeaderPrefix) {
+			metadataKey := strings.ToLower(strings.TrimPrefix(canonicalName, s3MetadataHeaderPrefix))
+			objectInfo.metadata[metadataKey] = response.Header.Get(name)
+		}
+	}
+	return objectInfo, nil
+}
+
+// getObject requests the data of the object with the given key beginning at the given offset.
+func (s3Bucket *S3Bucket) getObject(key string, offset int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	response, err := s3Bucket.do(http.MethodGet, key, nil, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// deleteObject deletes the object with the given key.
+func (s3Bucket *S3Bucket) deleteObject(key string) error {
+	response, err := s3Bucket.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// createMultipartUpload initiates a multipart upload of the object with the given key and returns its upload ID.
+func (s3Bucket *S3Bucket) createMultipartUpload(key, contentType string, metadata map[string]string) (string, error) {
+	response, err := s3Bucket.do(http.MethodPost, key, url.Values{"uploads": {""}},
+		s3ObjectHeader(contentType, metadata), nil)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	result := &struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+	if err = xml.NewDecoder(response.Body).Decode(result); err != nil {
+		return "", err
+	}
+	return result.UploadID, nil
+}
+
+// s3CompletedPart is a part of a multipart upload which is sent to complete the upload.
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// uploadPart uploads a part of a multipart upload and returns it.
+func (s3Bucket *S3Bucket) uploadPart(key, uploadID string, partNumber int, data []byte) (*s3CompletedPart, error) {
+	response, err := s3Bucket.do(http.MethodPut, key, url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadID},
+	}, nil, data)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+	return &s3CompletedPart{PartNumber: partNumber, ETag: response.Header.Get("ETag")}, nil
+}
+
+// completeMultipartUpload completes a multipart upload. The object is not visible until this is done.
+func (s3Bucket *S3Bucket) completeMultipartUpload(key, uploadID string, parts []*s3CompletedPart) error {
+	data, err := xml.Marshal(&struct {
+		XMLName xml.Name           `xml:"CompleteMultipartUpload"`
+		Parts   []*s3CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	response, err := s3Bucket.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, data)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// S3 may respond with status 200 and an error in the body
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(body, []byte("<Error>")) {
+		s3Error := &S3Error{StatusCode: response.StatusCode}
+		xml.Unmarshal(body, s3Error)
+		return s3Error
+	}
+	return nil
+}
+
+// abortMultipartUpload aborts a multipart upload and discards all uploaded parts.
+func (s3Bucket *S3Bucket) abortMultipartUpload(key, uploadID string) error {
+	response, err := s3Bucket.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// s3ObjectHeader returns the header used to create an object with the given content type and metadata.
+func s3ObjectHeader(contentType string, metadata map[string]string) http.Header {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	for key, value := range metadata {
+		header.Set(s3MetadataHeaderPrefix+key, value)
+	}
+	return header
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the given data.
+func hmacSHA256(key []byte, data string) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write([]byte(data))
+	return hash.Sum(nil)
+}
+
+// awsURIEncode encodes the given string according to the AWS signature version 4 rules which differ slightly from
+// the ones of the net/url package.
+func awsURIEncode(value string, encodeSlash bool) string {
+	buf := bytes.NewBuffer([]byte{})
+	for _, char := range []byte(value) {
+		if (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') ||
+			char == '-' || char == '_' || char == '.' || char == '~' || (char == '/' && !encodeSlash) {
+			buf.WriteByte(char)
+		} else {
+			fmt.Fprintf(buf, "%%%02X", char)
+		}
+	}
+	return buf.String()
+}
+
+// awsCanonicalQuery returns the query string sorted and encoded according to the AWS signature version 4 rules.
+func awsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
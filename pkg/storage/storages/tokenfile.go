@@ -0,0 +1,118 @@
+package storages
+
+import (
+	"encoding/json"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// FileTokenStorage is the TokenStorage implementation which stores the tokens in a single JSON file. It can be used in
+// combination with every FileStorage implementation.
+type FileTokenStorage struct {
+	// Filepath is the path of the JSON file which contains the tokens. It is created if it does not exist yet.
+	Filepath string
+	// internal values
+	mutex  sync.RWMutex
+	tokens map[string]*storage.Token
+}
+
+// Initialize reads the tokens from the JSON file. It has to be called before using the other methods and returns an
+// error if something goes wrong.
+func (fileTokenStorage *FileTokenStorage) Initialize() error {
+	fileTokenStorage.mutex.Lock()
+	defer fileTokenStorage.mutex.Unlock()
+	fileTokenStorage.tokens = make(map[string]*storage.Token)
+	data, err := ioutil.ReadFile(fileTokenStorage.Filepath)
+	if os.IsNotExist(err) {
+		// no token has been issued yet
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var tokens []*storage.Token
+	if err = json.Unmarshal(data, &tokens); err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		fileTokenStorage.tokens[token.Hash] = token
+	}
+	return nil
+}
+
+// StoreToken is the implementation of the TokenStorage.StoreToken method
+func (fileTokenStorage *FileTokenStorage) StoreToken(token *storage.Token) error {
+	fileTokenStorage.mutex.Lock()
+	defer fileTokenStorage.mutex.Unlock()
+	fileTokenStorage.tokens[token.Hash] = token
+	if err := fileTokenStorage.write(); err != nil {
+		delete(fileTokenStorage.tokens, token.Hash)
+		return err
+	}
+	return nil
+}
+
+// ResolveToken is the implementation of the TokenStorage.ResolveToken method
+func (fileTokenStorage *FileTokenStorage) ResolveToken(hash string) (*storage.Token, error) {
+	fileTokenStorage.mutex.RLock()
+	defer fileTokenStorage.mutex.RUnlock()
+	token, ok := fileTokenStorage.tokens[hash]
+	if !ok {
+		return nil, storage.ErrTokenNotFound
+	}
+	tokenCopy := *token
+	return &tokenCopy, nil
+}
+
+// RevokeToken is the implementation of the TokenStorage.RevokeToken method
+func (fileTokenStorage *FileTokenStorage) RevokeToken(id string) error {
+	fileTokenStorage.mutex.Lock()
+	defer fileTokenStorage.mutex.Unlock()
+	for hash, token := range fileTokenStorage.tokens {
+		if token.ID != id {
+			continue
+		}
+		delete(fileTokenStorage.tokens, hash)
+		if err := fileTokenStorage.write(); err != nil {
+			fileTokenStorage.tokens[hash] = token
+			return err
+		}
+		return nil
+	}
+	return storage.ErrTokenNotFound
+}
+
+// Tokens is the implementation of the TokenStorage.Tokens method
+func (fileTokenStorage *FileTokenStorage) Tokens() ([]*storage.Token, error) {
+	fileTokenStorage.mutex.RLock()
+	defer fileTokenStorage.mutex.RUnlock()
+	return fileTokenStorage.sortedTokens(), nil
+}
+
+// sortedTokens returns copies of all tokens sorted by their creation date.
+func (fileTokenStorage *FileTokenStorage) sortedTokens() []*storage.Token {
+	tokens := make([]*storage.Token, 0, len(fileTokenStorage.tokens))
+	for _, token := range fileTokenStorage.tokens {
+		tokenCopy := *token
+		tokens = append(tokens, &tokenCopy)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreationDate.Before(tokens[j].CreationDate)
+	})
+	return tokens
+}
+
+// write replaces the JSON file with the current tokens. The data is written to a temporary file first which is renamed
+// afterwards so that a crash can not leave a half written file behind.
+func (fileTokenStorage *FileTokenStorage) write() error {
+	data, err := json.MarshalIndent(fileTokenStorage.sortedTokens(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(fileTokenStorage.Filepath+temporaryFileSuffix, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(fileTokenStorage.Filepath+temporaryFileSuffix, fileTokenStorage.Filepath)
+}
@@ -0,0 +1,49 @@
+package storages
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileTokenStorage(t *testing.T) {
+	tokenFolder, err := ioutil.TempDir("", "sharexserver-token-test")
+	if err != nil {
+		t.Fatalf("Could not create temporary token folder, %T: %v", err, err)
+	}
+	defer os.RemoveAll(tokenFolder)
+	fileTokenStorage := &FileTokenStorage{Filepath: tokenFolder + "/tokens.json"}
+	if err := fileTokenStorage.Initialize(); err != nil {
+		t.Fatalf("Could not initialize file token storage, %T: %v", err, err)
+	}
+	token, secret, err := storage.NewToken(storage.AuthorIdentifier("a testing person"))
+	if err != nil {
+		t.Fatalf("Could not create token, %T: %v", err, err)
+	}
+	if err := fileTokenStorage.StoreToken(token); err != nil {
+		t.Fatalf("Could not store token, %T: %v", err, err)
+	}
+	// reopen the storage to make sure that the token was written to the file
+	fileTokenStorage = &FileTokenStorage{Filepath: tokenFolder + "/tokens.json"}
+	if err := fileTokenStorage.Initialize(); err != nil {
+		t.Fatalf("Could not reinitialize file token storage, %T: %v", err, err)
+	}
+	if resolvedToken, err := fileTokenStorage.ResolveToken(storage.HashToken(secret)); err != nil {
+		t.Fatalf("Could not resolve token, %T: %v", err, err)
+	} else if resolvedToken.ID != token.ID || resolvedToken.Author != token.Author {
+		t.Fatalf("Resolved token %+v does not match the stored token %+v", resolvedToken, token)
+	}
+	if tokens, err := fileTokenStorage.Tokens(); err != nil || len(tokens) != 1 {
+		t.Fatalf("Invalid tokens %+v (error: %v)", tokens, err)
+	}
+	if err := fileTokenStorage.RevokeToken(token.ID); err != nil {
+		t.Fatalf("Could not revoke token, %T: %v", err, err)
+	}
+	if _, err := fileTokenStorage.ResolveToken(storage.HashToken(secret)); err != storage.ErrTokenNotFound {
+		t.Fatalf("Expected %v when resolving a revoked token, got %v", storage.ErrTokenNotFound, err)
+	}
+	if err := fileTokenStorage.RevokeToken(token.ID); err != storage.ErrTokenNotFound {
+		t.Fatalf("Expected %v when revoking a revoked token, got %v", storage.ErrTokenNotFound, err)
+	}
+}
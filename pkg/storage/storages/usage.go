@@ -0,0 +1,22 @@
+package storages
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"time"
+)
+
+// metadataUsage sums up the data stored by the given author. It is used by the storages which do not have a database
+// to do this.
+func metadataUsage(metadataSlice []*entryMetadata, author storage.AuthorIdentifier) *storage.Usage {
+	now := time.Now()
+	usage := &storage.Usage{}
+	for _, metadata := range metadataSlice {
+		if metadata.Author != string(author) || metadata.Status == statusFailed || metadata.isExpired(now) {
+			continue
+		}
+		// the size of uploads which are still in progress is not known yet
+		usage.Bytes += metadata.Size
+		usage.Files++
+	}
+	return usage
+}
@@ -0,0 +1,202 @@
+package storages
+
+import (
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// variantFolderName is the folder inside of the data folder which contains a folder with the variants of every entry.
+const variantFolderName = "variants/"
+
+// folderVariants stores the variants of entries as standard system files. The variants of an entry are stored in a
+// folder which is named like the ID of the entry.
+type folderVariants struct {
+	folder string
+}
+
+// variantFileWriteCloser writes a variant to a temporary file which replaces the variant once it was closed, so that a
+// variant is never read while it is written.
+type variantFileWriteCloser struct {
+	*os.File
+	filepath string
+}
+
+// Close closes the temporary file and renames it to the path of the variant.
+func (writeCloser *variantFileWriteCloser) Close() error {
+	if err := writeCloser.File.Close(); err != nil {
+		os.Remove(writeCloser.File.Name())
+		return err
+	}
+	return os.Rename(writeCloser.File.Name(), writeCloser.filepath)
+}
+
+// Abort is the implementation of the storage.Aborter interface which removes the temporary file.
+func (writeCloser *variantFileWriteCloser) Abort() error {
+	writeCloser.File.Close()
+	return os.Remove(writeCloser.File.Name())
+}
+
+// create returns a writer for the variant with the given name of the entry with the given ID.
+func (variants folderVariants) create(id, name string) (io.WriteCloser, error) {
+	if !storage.IsValidVariantName(name) {
+		return nil, storage.ErrInvalidVariantName
+	}
+	if err := os.MkdirAll(variants.folder+id, os.ModePerm); err != nil {
+		return nil, err
+	}
+	filepath := variants.filepath(id, name)
+	file, err := os.Create(filepath + temporaryFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	return &variantFileWriteCloser{File: file, filepath: filepath}, nil
+}
+
+// open returns a reader of the variant with the given name of the entry with the given ID. It returns
+// storage.ErrVariantNotFound if the variant does not exist.
+func (variants folderVariants) open(id, name string) (storage.ReadCloseSeekOpener, error) {
+	if !storage.IsValidVariantName(name) {
+		return nil, storage.ErrInvalidVariantName
+	}
+	filepath := variants.filepath(id, name)
+	if _, err := os.Stat(filepath); os.IsNotExist(err) {
+		return nil, storage.ErrVariantNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &FileBasedReadCloseSeekOpener{Filepath: filepath}, nil
+}
+
+// removeAll removes all variants of the entry with the given ID.
+func (variants folderVariants) removeAll(id string) error {
+	return os.RemoveAll(variants.folder + id)
+}
+
+// prune removes the least recently stored variants whose names start with the given prefix until their total size is
+// at most the given amount of bytes. It returns the amount of removed variants.
+func (variants folderVariants) prune(prefix string, maximumBytes int64) (int, error) {
+	folderInfos, err := ioutil.ReadDir(variants.folder)
+	if os.IsNotExist(err) {
+		// no variant was stored yet
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	type variantFile struct {
+		filepath string
+		os.FileInfo
+	}
+	var files []variantFile
+	for _, folderInfo := range folderInfos {
+		if !folderInfo.IsDir() {
+			continue
+		}
+		fileInfos, err := ioutil.ReadDir(variants.folder + folderInfo.Name())
+		if os.IsNotExist(err) {
+			// the entry was deleted in the meantime
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		for _, fileInfo := range fileInfos {
+			if fileInfo.Mode().IsRegular() && strings.HasPrefix(fileInfo.Name(), prefix) &&
+				storage.IsValidVariantName(fileInfo.Name()) {
+				files = append(files, variantFile{variants.filepath(folderInfo.Name(), fileInfo.Name()), fileInfo})
+			}
+		}
+	}
+	// the most recently stored variants are kept
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	var totalBytes int64
+	var removed int
+	for _, file := range files {
+		totalBytes += file.Size()
+		if totalBytes <= maximumBytes {
+			continue
+		}
+		if err := os.Remove(file.filepath); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// filepath returns the path of the file which contains the variant with the given name of the entry with the given ID.
+func (variants folderVariants) filepath(id, name string) string {
+	return variants.folder + id + "/" + name
+}
+
+// variants returns the folderVariants of the FileSystemStorage.
+func (fileSystemStorage *FileSystemStorage) variants() folderVariants {
+	return folderVariants{folder: fileSystemStorage.DataFolder + variantFolderName}
+}
+
+// StoreVariant is the implementation of the VariantStorage.StoreVariant method
+func (fileSystemStorage *FileSystemStorage) StoreVariant(id storage.ID, name string) (io.WriteCloser, error) {
+	// make sure that the ID can not be used to access other files
+	callReference, ok := id.(string)
+	if !ok || !isValidCallReference(callReference) {
+		return nil, storage.ErrEntryNotFound
+	}
+	if _, err := os.Stat(fileSystemStorage.metadataFilepath(callReference)); os.IsNotExist(err) {
+		return nil, storage.ErrEntryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return fileSystemStorage.variants().create(callReference, name)
+}
+
+// RequestVariant is the implementation of the VariantStorage.RequestVariant method
+func (fileSystemStorage *FileSystemStorage) RequestVariant(id storage.ID,
+	name string) (storage.ReadCloseSeekOpener, error) {
+	callReference, ok := id.(string)
+	if !ok || !isValidCallReference(callReference) {
+		return nil, storage.ErrVariantNotFound
+	}
+	return fileSystemStorage.variants().open(callReference, name)
+}
+
+// PruneVariants is the implementation of the PrunableVariantStorage.PruneVariants method
+func (fileSystemStorage *FileSystemStorage) PruneVariants(prefix string, maximumBytes int64) (int, error) {
+	return fileSystemStorage.variants().prune(prefix, maximumBytes)
+}
+
+// variants returns the folderVariants of the EmbeddedStorage.
+func (embeddedStorage *EmbeddedStorage) variants() folderVariants {
+	return folderVariants{folder: embeddedStorage.DataFolder + variantFolderName}
+}
+
+// StoreVariant is the implementation of the VariantStorage.StoreVariant method
+func (embeddedStorage *EmbeddedStorage) StoreVariant(id storage.ID, name string) (io.WriteCloser, error) {
+	stringID, _ := id.(string)
+	embeddedStorage.mutex.RLock()
+	_, ok := embeddedStorage.entries[stringID]
+	embeddedStorage.mutex.RUnlock()
+	if !ok {
+		return nil, storage.ErrEntryNotFound
+	}
+	return embeddedStorage.variants().create(stringID, name)
+}
+
+// RequestVariant is the implementation of the VariantStorage.RequestVariant method
+func (embeddedStorage *EmbeddedStorage) RequestVariant(id storage.ID,
+	name string) (storage.ReadCloseSeekOpener, error) {
+	// make sure that the ID can not be used to access other files
+	stringID, ok := id.(string)
+	if !ok || !isValidID(stringID) {
+		return nil, storage.ErrVariantNotFound
+	}
+	return embeddedStorage.variants().open(stringID, name)
+}
+
+// PruneVariants is the implementation of the PrunableVariantStorage.PruneVariants method
+func (embeddedStorage *EmbeddedStorage) PruneVariants(prefix string, maximumBytes int64) (int, error) {
+	return embeddedStorage.variants().prune(prefix, maximumBytes)
+}
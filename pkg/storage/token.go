@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	// tokenIDLength and tokenSecretLength are the amounts of random bytes the token IDs and secrets consist of.
+	tokenIDLength     = 8
+	tokenSecretLength = 24
+)
+
+// ErrTokenNotFound is returned by the TokenStorage methods if the token could not be found.
+var ErrTokenNotFound = errors.New("token not found")
+
+// Token is an access token which identifies an uploader. Only the hash of the secret token value is stored, the value
+// itself is only known by the uploader.
+type Token struct {
+	// ID is a public identifier of the token which is used to e.g. revoke it.
+	ID string
+	// Author is the identity of the uploader which is stored in the Entry.Author field of the uploaded entries.
+	Author AuthorIdentifier
+	// Hash is the hash of the secret token value (see HashToken).
+	Hash string
+	// CreationDate is the date when the token was issued.
+	CreationDate time.Time
+	// DefaultTTL is the time-to-live of the entries uploaded with this token if the uploader did not choose one. A zero
+	// value means that the entries never expire.
+	DefaultTTL time.Duration
+	// Quota limits the data which is stored by the author of this token. Its zero values are replaced by the ones of
+	// the default quota.
+	Quota Quota
+}
+
+// TokenStorage is an interface which is the scheme to store and resolve the access tokens of uploaders.
+type TokenStorage interface {
+	// StoreToken saves the provided token. It returns an error if something goes wrong.
+	StoreToken(token *Token) error
+	// ResolveToken searches for a token by the provided hash of its secret value. It returns the token or
+	// ErrTokenNotFound if the token could not be found or an unwrapped error if something goes wrong.
+	ResolveToken(hash string) (*Token, error)
+	// RevokeToken removes the token with the provided ID. It returns ErrTokenNotFound if the token could not be found
+	// or an unwrapped error if something goes wrong.
+	RevokeToken(id string) error
+	// Tokens returns all stored tokens. It returns an error if something goes wrong.
+	Tokens() ([]*Token, error)
+}
+
+// NewToken creates a new random token for the given author. It returns the token which can be stored and the secret
+// token value which has to be handed out to the uploader or an error if no random bytes could be read.
+func NewToken(author AuthorIdentifier) (token *Token, secret string, err error) {
+	var id string
+	if id, err = randomHex(tokenIDLength); err != nil {
+		return
+	}
+	if secret, err = randomHex(tokenSecretLength); err != nil {
+		return
+	}
+	token = &Token{
+		ID:           id,
+		Author:       author,
+		Hash:         HashToken(secret),
+		CreationDate: time.Now(),
+	}
+	return
+}
+
+// HashToken returns the hex encoded SHA-256 hash of the given secret token value. The secret values are random and long
+// enough, so there is no need of a slow password hash function.
+func HashToken(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// randomHex returns the given amount of random bytes hex encoded.
+func randomHex(length int) (string, error) {
+	randomBytes := make([]byte, length)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
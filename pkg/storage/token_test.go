@@ -0,0 +1,19 @@
+package storage
+
+import "testing"
+
+func TestNewToken(t *testing.T) {
+	token, secret, err := NewToken(AuthorIdentifier("a testing person"))
+	if err != nil {
+		t.Fatalf("Could not create token, %T: %v", err, err)
+	}
+	if token.Author != "a testing person" || token.ID == "" || token.CreationDate.IsZero() {
+		t.Fatalf("Invalid token %+v", token)
+	}
+	if HashToken(secret) != token.Hash || token.Hash == secret {
+		t.Fatalf("The token hash %q does not belong to the secret %q", token.Hash, secret)
+	}
+	if otherToken, otherSecret, _ := NewToken(token.Author); otherToken.ID == token.ID || otherSecret == secret {
+		t.Fatal("Two created tokens are equal")
+	}
+}
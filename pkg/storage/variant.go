@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrVariantNotFound is returned by the VariantStorage if the requested variant was not stored.
+var ErrVariantNotFound = errors.New("variant not found")
+
+// ErrInvalidVariantName is returned by the VariantStorage if the name of a variant is not valid (see
+// IsValidVariantName).
+var ErrInvalidVariantName = errors.New("invalid variant name")
+
+// VariantStorage is implemented by FileStorage implementations which are able to store data derived from the file
+// data of an entry, like thumbnails, next to it. The variants of an entry are removed together with the entry.
+type VariantStorage interface {
+	// StoreVariant returns a writer to store the variant with the given name of the entry with the given ID. A stored
+	// variant with the same name is replaced once the writer was closed without an error. It returns
+	// ErrEntryNotFound if the entry could not be found or an unwrapped error if something goes wrong.
+	StoreVariant(id ID, name string) (io.WriteCloser, error)
+	// RequestVariant returns a ReadCloseSeekOpener which reads the variant with the given name of the entry with the
+	// given ID after its Open method was called. It returns ErrVariantNotFound if the variant was not stored or an
+	// unwrapped error if something goes wrong.
+	RequestVariant(id ID, name string) (ReadCloseSeekOpener, error)
+}
+
+// IsValidVariantName checks whether the given name of a variant only consists of letters, digits, "-" and "_" so it
+// can be used as a part of a filename.
+func IsValidVariantName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// PrunableVariantStorage is implemented by VariantStorage implementations which are able to limit the total size of
+// variants which are used as a cache.
+type PrunableVariantStorage interface {
+	VariantStorage
+	// PruneVariants removes the least recently stored variants whose names start with the given prefix until their
+	// total size is at most the given amount of bytes. It returns the amount of removed variants or an unwrapped error
+	// if something goes wrong.
+	PruneVariants(prefix string, maximumBytes int64) (int, error)
+}
@@ -0,0 +1,423 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mmichaelb/sharexserver/pkg/router"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maximumResponseLength is the maximum amount of bytes which are read from the response of a webhook.
+const maximumResponseLength = 1 << 16
+
+// Dispatcher sends the events about the entries of a router.ShareXRouter to the configured webhooks. It implements the
+// router.PostStoreHook, router.DeleteHook and router.AccessHook interfaces, while the removal of expired entries has
+// to be reported via the Expired method. The events are queued persistently and sent in the background, so neither
+// slow webhooks nor restarts of the server affect them.
+type Dispatcher struct {
+	// Webhooks contains the webhooks the events are sent to.
+	Webhooks []*Webhook
+	// QueueFolder is the folder which contains the pending deliveries and a marker file for every accessed entry. It is
+	// created if it does not exist yet.
+	QueueFolder string
+	// Storage is the storage of the entries. If it is set, the accessed entries which do not exist anymore are
+	// forgotten by the Start method. Deleted and expired entries are always forgotten once they are reported.
+	Storage storage.FileStorage
+	// PublicURL is the URL the ShareX router is reachable at from the outside. It is used to send the URLs of the
+	// entries. The URLs are omitted if it is empty.
+	PublicURL string
+	// Timeout limits a single request to a webhook. A zero value means that there is no timeout.
+	Timeout time.Duration
+	// MaximumAttempts is the maximum amount of attempts to send an event to a webhook before it is dropped. A zero
+	// value means that the event is sent until it succeeds.
+	MaximumAttempts int
+	// RetryInterval is the duration between the first and the second attempt to send an event. It has to be positive
+	// and is doubled after every further attempt until it reaches the MaximumRetryInterval, unless that is zero.
+	RetryInterval, MaximumRetryInterval time.Duration
+	// internal values
+	client  *http.Client
+	mutex   sync.Mutex
+	pending map[string]*delivery
+	// accessed contains the call references of the entries which were already accessed. It is only maintained if a
+	// webhook subscribes to EventAccessed.
+	accessed map[string]bool
+	wake     chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     sync.WaitGroup
+}
+
+// Start validates the webhooks and the RetryInterval, reads the pending deliveries from the QueueFolder and starts the background goroutine
+// which sends them. It has to be called before using the other methods and returns an error if something goes wrong.
+func (dispatcher *Dispatcher) Start() error {
+	// a failing webhook would be sent the events over and over again without any pause otherwise
+	if dispatcher.RetryInterval <= 0 {
+		return fmt.Errorf("the retry interval of the webhooks has to be positive, got %v", dispatcher.RetryInterval)
+	}
+	for _, webhook := range dispatcher.Webhooks {
+		if err := webhook.validate(); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dispatcher.QueueFolder, 0700); err != nil {
+		return err
+	}
+	deliveries, err := dispatcher.readDeliveries()
+	if err != nil {
+		return err
+	}
+	if dispatcher.accessed, err = dispatcher.readAccessed(); err != nil {
+		return err
+	}
+	if dispatcher.Storage != nil {
+		if err = dispatcher.pruneAccessed(); err != nil {
+			return err
+		}
+	}
+	dispatcher.pending = make(map[string]*delivery, len(deliveries))
+	for _, pendingDelivery := range deliveries {
+		dispatcher.pending[pendingDelivery.ID] = pendingDelivery
+	}
+	if len(deliveries) > 0 {
+		log.Printf("Loaded %d pending webhook deliveries.\n", len(deliveries))
+	}
+	dispatcher.client = &http.Client{}
+	dispatcher.wake = make(chan struct{}, 1)
+	dispatcher.ctx, dispatcher.cancel = context.WithCancel(context.Background())
+	dispatcher.done.Add(1)
+	go dispatcher.run()
+	return nil
+}
+
+// Stop stops the background goroutine and waits until it has finished. Requests which are sent at the moment are
+// aborted and sent again once the Dispatcher is started the next time.
+func (dispatcher *Dispatcher) Stop() {
+	dispatcher.cancel()
+	dispatcher.done.Wait()
+}
+
+// Dispatch queues an event of the given type about the given entry for every webhook which subscribes to it. The size
+// of the data of the entry is only sent if it is not zero. It returns an error if the event could not be queued.
+func (dispatcher *Dispatcher) Dispatch(eventType string, entry *storage.Entry, size int64) error {
+	var webhooks []*Webhook
+	for _, webhook := range dispatcher.Webhooks {
+		if webhook.subscribes(eventType) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	event, err := newEvent(eventType, entry, size, dispatcher.PublicURL)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		pendingDelivery := &delivery{
+			ID:           id,
+			URL:          webhook.URL,
+			EventID:      event.ID,
+			EventType:    eventType,
+			Payload:      payload,
+			CreationDate: event.Date,
+			NextAttempt:  event.Date,
+		}
+		if err = dispatcher.writeDelivery(pendingDelivery); err != nil {
+			return err
+		}
+		dispatcher.mutex.Lock()
+		dispatcher.pending[id] = pendingDelivery
+		dispatcher.mutex.Unlock()
+	}
+	// wake up the background goroutine unless it is already woken up
+	select {
+	case dispatcher.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// PostStore is the implementation of the router.PostStoreHook.PostStore method
+func (dispatcher *Dispatcher) PostStore(ctx context.Context, upload *router.Upload) error {
+	return dispatcher.Dispatch(EventCreated, upload.Entry, upload.Size)
+}
+
+// Deleted is the implementation of the router.DeleteHook.Deleted method
+func (dispatcher *Dispatcher) Deleted(ctx context.Context, request *http.Request, entry *storage.Entry) error {
+	if err := dispatcher.forgetAccess(entry); err != nil {
+		return err
+	}
+	return dispatcher.Dispatch(EventDeleted, entry, 0)
+}
+
+// Accessed is the implementation of the router.AccessHook.Accessed method. The event is only sent for the first
+// access of an entry.
+func (dispatcher *Dispatcher) Accessed(ctx context.Context, request *http.Request, entry *storage.Entry) error {
+	if !dispatcher.subscribed(EventAccessed) {
+		return nil
+	}
+	dispatcher.mutex.Lock()
+	if dispatcher.accessed[entry.CallReference] {
+		dispatcher.mutex.Unlock()
+		return nil
+	}
+	dispatcher.accessed[entry.CallReference] = true
+	dispatcher.mutex.Unlock()
+	if err := dispatcher.writeAccessed(entry.CallReference); err != nil {
+		// the next access is treated as the first one again
+		dispatcher.mutex.Lock()
+		delete(dispatcher.accessed, entry.CallReference)
+		dispatcher.mutex.Unlock()
+		return err
+	}
+	return dispatcher.Dispatch(EventAccessed, entry, 0)
+}
+
+// Expired sends the events about the given entries which were removed because they expired, e.g. the result of the
+// storage.ExpiringStorage.DeleteExpired method. It returns the first error if some events could not be queued.
+func (dispatcher *Dispatcher) Expired(entries []*storage.Entry) error {
+	var firstErr error
+	for _, entry := range entries {
+		err := dispatcher.forgetAccess(entry)
+		if err == nil {
+			err = dispatcher.Dispatch(EventExpired, entry, 0)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// subscribed checks whether any webhook subscribes to the given type of events.
+func (dispatcher *Dispatcher) subscribed(eventType string) bool {
+	for _, webhook := range dispatcher.Webhooks {
+		if webhook.subscribes(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetAccess removes the given entry from the accessed entries because it does not exist anymore.
+func (dispatcher *Dispatcher) forgetAccess(entry *storage.Entry) error {
+	dispatcher.mutex.Lock()
+	accessed := dispatcher.accessed[entry.CallReference]
+	delete(dispatcher.accessed, entry.CallReference)
+	dispatcher.mutex.Unlock()
+	if !accessed {
+		return nil
+	}
+	return dispatcher.removeAccessed(entry.CallReference)
+}
+
+// pruneAccessed forgets the accessed entries which can not be requested from the Storage anymore, e.g. because they
+// were removed by the consistency check while the server was stopped.
+func (dispatcher *Dispatcher) pruneAccessed() error {
+	var pruned int
+	for callReference := range dispatcher.accessed {
+		if _, err := dispatcher.Storage.Request(callReference); err == storage.ErrEntryNotFound {
+			if err = dispatcher.removeAccessed(callReference); err != nil {
+				return err
+			}
+			delete(dispatcher.accessed, callReference)
+			pruned++
+		} else if err != nil {
+			return err
+		}
+	}
+	if pruned > 0 {
+		log.Printf("Forgot %d accessed entries which do not exist anymore.\n", pruned)
+	}
+	return nil
+}
+
+// run sends the pending deliveries once they are due until the Dispatcher is stopped.
+func (dispatcher *Dispatcher) run() {
+	defer dispatcher.done.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-dispatcher.wake:
+		case <-dispatcher.ctx.Done():
+			return
+		}
+		for _, pendingDelivery := range dispatcher.dueDeliveries(time.Now()) {
+			if dispatcher.ctx.Err() != nil {
+				return
+			}
+			dispatcher.attempt(pendingDelivery)
+		}
+		// wait until the next delivery is due
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if nextAttempt := dispatcher.nextAttempt(); !nextAttempt.IsZero() {
+			timer.Reset(time.Until(nextAttempt))
+		}
+	}
+}
+
+// dueDeliveries returns the pending deliveries whose next attempt is before or equal to the given time in the order
+// of their creation.
+func (dispatcher *Dispatcher) dueDeliveries(now time.Time) []*delivery {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	var deliveries []*delivery
+	for _, pendingDelivery := range dispatcher.pending {
+		if !pendingDelivery.NextAttempt.After(now) {
+			deliveries = append(deliveries, pendingDelivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreationDate.Before(deliveries[j].CreationDate)
+	})
+	return deliveries
+}
+
+// nextAttempt returns the time of the next attempt of a pending delivery or the zero time if there is none.
+func (dispatcher *Dispatcher) nextAttempt() time.Time {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	var nextAttempt time.Time
+	for _, pendingDelivery := range dispatcher.pending {
+		if nextAttempt.IsZero() || pendingDelivery.NextAttempt.Before(nextAttempt) {
+			nextAttempt = pendingDelivery.NextAttempt
+		}
+	}
+	return nextAttempt
+}
+
+// attempt sends the given delivery once. It is removed if it succeeded or the MaximumAttempts are reached, otherwise
+// its next attempt is scheduled.
+func (dispatcher *Dispatcher) attempt(pendingDelivery *delivery) {
+	webhook := dispatcher.webhook(pendingDelivery.URL)
+	if webhook == nil {
+		log.Printf("Dropped the event %s for the webhook %s because it is not configured anymore.\n",
+			pendingDelivery.EventID, pendingDelivery.URL)
+		dispatcher.remove(pendingDelivery)
+		return
+	}
+	err := dispatcher.send(webhook, pendingDelivery)
+	if err == nil {
+		dispatcher.remove(pendingDelivery)
+		return
+	} else if dispatcher.ctx.Err() != nil {
+		// the request was aborted because the Dispatcher is stopped
+		return
+	}
+	dispatcher.mutex.Lock()
+	pendingDelivery.Attempts++
+	attempts := pendingDelivery.Attempts
+	if dispatcher.MaximumAttempts > 0 && attempts >= dispatcher.MaximumAttempts {
+		dispatcher.mutex.Unlock()
+		log.Printf("Gave up sending the event %s to the webhook %s after %d attempts, %T: %v\n",
+			pendingDelivery.EventID, webhook.URL, attempts, err, err)
+		dispatcher.remove(pendingDelivery)
+		return
+	}
+	retryInterval := dispatcher.retryInterval(attempts)
+	pendingDelivery.NextAttempt = time.Now().Add(retryInterval)
+	// a copy is persisted outside of the lock so that queuing new events does not wait for the disk
+	persistedDelivery := *pendingDelivery
+	dispatcher.mutex.Unlock()
+	writeErr := dispatcher.writeDelivery(&persistedDelivery)
+	log.Printf("Could not send the event %s to the webhook %s (attempt %d), retrying in %v, %T: %v\n",
+		pendingDelivery.EventID, webhook.URL, attempts, retryInterval, err, err)
+	if writeErr != nil {
+		log.Printf("There was an error while writing the webhook delivery %s, %T: %v\n", pendingDelivery.ID,
+			writeErr, writeErr)
+	}
+}
+
+// send sends the event of the given delivery to the given webhook.
+func (dispatcher *Dispatcher) send(webhook *Webhook, pendingDelivery *delivery) error {
+	ctx, cancel := dispatcher.ctx, context.CancelFunc(func() {})
+	if dispatcher.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, dispatcher.Timeout)
+	}
+	defer cancel()
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(pendingDelivery.Payload))
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(eventHeader, pendingDelivery.EventType)
+	request.Header.Set(deliveryHeader, pendingDelivery.EventID)
+	if webhook.Secret != "" {
+		request.Header.Set(signatureHeader, webhook.sign(pendingDelivery.Payload))
+	}
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return err
+	}
+	// read the response so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, maximumResponseLength))
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("the webhook responded with the status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// retryInterval returns the duration until the next attempt after the given amount of failed attempts.
+func (dispatcher *Dispatcher) retryInterval(attempts int) time.Duration {
+	retryInterval := dispatcher.RetryInterval
+	for attempt := 1; attempt < attempts; attempt++ {
+		if (dispatcher.MaximumRetryInterval > 0 && retryInterval >= dispatcher.MaximumRetryInterval) ||
+			retryInterval > math.MaxInt64/2 {
+			break
+		}
+		retryInterval *= 2
+	}
+	if dispatcher.MaximumRetryInterval > 0 && retryInterval > dispatcher.MaximumRetryInterval {
+		return dispatcher.MaximumRetryInterval
+	}
+	return retryInterval
+}
+
+// webhook returns the configured webhook with the given URL or nil if there is none.
+func (dispatcher *Dispatcher) webhook(url string) *Webhook {
+	for _, webhook := range dispatcher.Webhooks {
+		if webhook.URL == url {
+			return webhook
+		}
+	}
+	return nil
+}
+
+// remove removes the given delivery from the queue.
+func (dispatcher *Dispatcher) remove(pendingDelivery *delivery) {
+	dispatcher.mutex.Lock()
+	delete(dispatcher.pending, pendingDelivery.ID)
+	dispatcher.mutex.Unlock()
+	if err := dispatcher.removeDelivery(pendingDelivery); err != nil {
+		log.Printf("There was an error while removing the webhook delivery %s, %T: %v\n", pendingDelivery.ID, err,
+			err)
+	}
+}
@@ -0,0 +1,272 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mmichaelb/sharexserver/pkg/router"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receivedEvent is an event which was received by the test server.
+type receivedEvent struct {
+	path      string
+	signature string
+	event     *Event
+}
+
+// testServer receives the events of the webhooks and fails the requests to a path as often as configured.
+type testServer struct {
+	*httptest.Server
+	events chan *receivedEvent
+	mutex  sync.Mutex
+	// failures contains the amount of requests to a path which still fail.
+	failures map[string]int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	server := &testServer{events: make(chan *receivedEvent, 16), failures: make(map[string]int)}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		server.mutex.Lock()
+		failing := server.failures[request.URL.Path] > 0
+		server.failures[request.URL.Path]--
+		server.mutex.Unlock()
+		if failing {
+			http.Error(writer, "503 not yet", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(request.Body)
+		event := &Event{}
+		if err := json.Unmarshal(body, event); err != nil {
+			t.Errorf("Could not decode the event %q, %T: %v", body, err, err)
+		}
+		if request.Header.Get(eventHeader) != event.Type || request.Header.Get(deliveryHeader) != event.ID {
+			t.Errorf("The headers %v do not match the event %+v", request.Header, event)
+		}
+		// the signature is verified like a receiver would do it
+		if signature := request.Header.Get(signatureHeader); signature != "" &&
+			signature != (&Webhook{Secret: "secret"}).sign(body) {
+			t.Errorf("The signature %s of the event %s is invalid", signature, event.ID)
+		}
+		server.events <- &receivedEvent{path: request.URL.Path, signature: request.Header.Get(signatureHeader),
+			event: event}
+	}))
+	return server
+}
+
+// fail makes the given amount of requests to the given path fail.
+func (server *testServer) fail(path string, failures int) {
+	server.mutex.Lock()
+	server.failures[path] = failures
+	server.mutex.Unlock()
+}
+
+// expect waits for an event of the given type at the given path.
+func (server *testServer) expect(t *testing.T, path, eventType string) *receivedEvent {
+	select {
+	case received := <-server.events:
+		if received.path != path || received.event.Type != eventType {
+			t.Fatalf("Received the event %s at %s, expected %s at %s", received.event.Type, received.path, eventType,
+				path)
+		}
+		return received
+	case <-time.After(5 * time.Second):
+		t.Fatalf("The event %s was not received at %s", eventType, path)
+		return nil
+	}
+}
+
+// expectNone makes sure that no further event is received.
+func (server *testServer) expectNone(t *testing.T) {
+	select {
+	case received := <-server.events:
+		t.Fatalf("Received the unexpected event %s at %s", received.event.Type, received.path)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func newQueueFolder(t *testing.T) (string, func()) {
+	queueFolder, err := ioutil.TempDir("", "sharexserver-webhooks")
+	if err != nil {
+		t.Fatalf("Could not create temporary queue folder, %T: %v", err, err)
+	}
+	return queueFolder, func() {
+		os.RemoveAll(queueFolder)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	queueFolder, cleanup := newQueueFolder(t)
+	defer cleanup()
+	dispatcher := &Dispatcher{
+		Webhooks: []*Webhook{
+			{URL: server.URL + "/chat", Secret: "secret"},
+			{URL: server.URL + "/audit", Events: []string{EventDeleted}},
+		},
+		QueueFolder:   queueFolder,
+		PublicURL:     "https://example.com/",
+		RetryInterval: 10 * time.Millisecond,
+	}
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Could not start dispatcher, %T: %v", err, err)
+	}
+	defer dispatcher.Stop()
+	entry := &storage.Entry{CallReference: "abc", Filename: "notes.txt", ContentType: "text/plain"}
+	if err := dispatcher.PostStore(context.Background(), &router.Upload{Entry: entry, Size: 42}); err != nil {
+		t.Fatalf("Could not dispatch created event, %T: %v", err, err)
+	}
+	created := server.expect(t, "/chat", EventCreated)
+	if created.signature == "" || created.event.Entry.URL != "https://example.com/abc" ||
+		created.event.Entry.Size != 42 || created.event.Entry.Kind != string(storage.KindFile) {
+		t.Fatalf("The created event %+v with the signature %q is invalid", created.event.Entry, created.signature)
+	}
+	// only the first access is sent
+	for i := 0; i < 2; i++ {
+		if err := dispatcher.Accessed(context.Background(), nil, entry); err != nil {
+			t.Fatalf("Could not dispatch accessed event, %T: %v", err, err)
+		}
+	}
+	server.expect(t, "/chat", EventAccessed)
+	server.expectNone(t)
+	// the audit webhook only receives the deletion after it failed twice
+	server.fail("/audit", 2)
+	if err := dispatcher.Deleted(context.Background(), nil, entry); err != nil {
+		t.Fatalf("Could not dispatch deleted event, %T: %v", err, err)
+	}
+	chatDeletion := server.expect(t, "/chat", EventDeleted)
+	auditDeletion := server.expect(t, "/audit", EventDeleted)
+	if chatDeletion.event.ID != auditDeletion.event.ID {
+		t.Fatalf("The webhooks received different events %s and %s", chatDeletion.event.ID, auditDeletion.event.ID)
+	}
+	server.expectNone(t)
+}
+
+func TestDispatcherQueue(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	queueFolder, cleanup := newQueueFolder(t)
+	defer cleanup()
+	newDispatcher := func() *Dispatcher {
+		dispatcher := &Dispatcher{
+			Webhooks:      []*Webhook{{URL: server.URL + "/audit"}},
+			QueueFolder:   queueFolder,
+			RetryInterval: 200 * time.Millisecond,
+		}
+		if err := dispatcher.Start(); err != nil {
+			t.Fatalf("Could not start dispatcher, %T: %v", err, err)
+		}
+		return dispatcher
+	}
+	dispatcher := newDispatcher()
+	entry := &storage.Entry{CallReference: "abc", Filename: "notes.txt", ContentType: "text/plain"}
+	if err := dispatcher.Accessed(context.Background(), nil, entry); err != nil {
+		t.Fatalf("Could not dispatch accessed event, %T: %v", err, err)
+	}
+	server.expect(t, "/audit", EventAccessed)
+	// the server is "down" while the entry expires and the server is restarted
+	server.fail("/audit", 1)
+	if err := dispatcher.Expired([]*storage.Entry{entry}); err != nil {
+		t.Fatalf("Could not dispatch expired event, %T: %v", err, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	dispatcher.Stop()
+	server.expectNone(t)
+	dispatcher = newDispatcher()
+	defer dispatcher.Stop()
+	server.expect(t, "/audit", EventExpired)
+	// the expired entry was forgotten, so its call reference can be accessed for the first time again
+	if err := dispatcher.Accessed(context.Background(), nil, entry); err != nil {
+		t.Fatalf("Could not dispatch accessed event, %T: %v", err, err)
+	}
+	server.expect(t, "/audit", EventAccessed)
+}
+
+// removedEntriesStorage is a storage which does not contain any entry.
+type removedEntriesStorage struct {
+	storage.FileStorage
+}
+
+func (removedStorage *removedEntriesStorage) Request(callReference string) (*storage.Entry, error) {
+	return nil, storage.ErrEntryNotFound
+}
+
+func TestDispatcherPruneAccessed(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	queueFolder, cleanup := newQueueFolder(t)
+	defer cleanup()
+	dispatcher := &Dispatcher{Webhooks: []*Webhook{{URL: server.URL + "/audit"}}, QueueFolder: queueFolder,
+		RetryInterval: time.Second}
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Could not start dispatcher, %T: %v", err, err)
+	}
+	entry := &storage.Entry{CallReference: "../abc", Filename: "notes.txt", ContentType: "text/plain"}
+	if err := dispatcher.Accessed(context.Background(), nil, entry); err != nil {
+		t.Fatalf("Could not dispatch accessed event, %T: %v", err, err)
+	}
+	server.expect(t, "/audit", EventAccessed)
+	dispatcher.Stop()
+	// the entry was removed while the server was stopped
+	dispatcher = &Dispatcher{Webhooks: dispatcher.Webhooks, QueueFolder: queueFolder, RetryInterval: time.Second,
+		Storage: &removedEntriesStorage{}}
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Could not start dispatcher, %T: %v", err, err)
+	}
+	defer dispatcher.Stop()
+	if len(dispatcher.accessed) != 0 {
+		t.Fatalf("The removed entries %v were not forgotten", dispatcher.accessed)
+	}
+	if fileInfos, err := ioutil.ReadDir(queueFolder + "/" + accessedFolder); err != nil || len(fileInfos) != 0 {
+		t.Fatalf("The marker files of the removed entries were not removed, %v", err)
+	}
+}
+
+func TestDispatcherValidation(t *testing.T) {
+	queueFolder, cleanup := newQueueFolder(t)
+	defer cleanup()
+	dispatcher := &Dispatcher{
+		Webhooks:      []*Webhook{{URL: "https://example.com/hook", Events: []string{"entry.renamed"}}},
+		QueueFolder:   queueFolder,
+		RetryInterval: time.Second,
+	}
+	if err := dispatcher.Start(); err == nil {
+		dispatcher.Stop()
+		t.Fatal("The dispatcher was started with a webhook subscribing to an unknown event")
+	}
+	for _, retryInterval := range []time.Duration{0, -time.Second} {
+		dispatcher = &Dispatcher{
+			Webhooks:      []*Webhook{{URL: "https://example.com/hook"}},
+			QueueFolder:   queueFolder,
+			RetryInterval: retryInterval,
+		}
+		if err := dispatcher.Start(); err == nil {
+			dispatcher.Stop()
+			t.Fatalf("The dispatcher was started with the retry interval %v", retryInterval)
+		}
+	}
+}
+
+func TestRetryInterval(t *testing.T) {
+	dispatcher := &Dispatcher{RetryInterval: time.Second, MaximumRetryInterval: 5 * time.Second}
+	for attempts, expectedInterval := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second,
+		5 * time.Second, 5 * time.Second} {
+		if attempts == 0 {
+			continue
+		}
+		if interval := dispatcher.retryInterval(attempts); interval != expectedInterval {
+			t.Fatalf("The retry interval after %d attempts is %v, expected %v", attempts, interval, expectedInterval)
+		}
+	}
+	dispatcher.MaximumRetryInterval = 0
+	if interval := dispatcher.retryInterval(100); interval <= 0 {
+		t.Fatalf("The retry interval after 100 attempts overflowed to %v", interval)
+	}
+}
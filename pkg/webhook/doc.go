@@ -0,0 +1,3 @@
+// Package webhook contains a dispatcher which notifies other services like chat applications or audit systems about
+// created, deleted, expired and accessed entries via signed HTTP requests.
+package webhook
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	cryptRand "crypto/rand"
+	"encoding/hex"
+	"github.com/mmichaelb/sharexserver/pkg/storage"
+	"strings"
+	"time"
+)
+
+// types of the events which are sent to the webhooks
+const (
+	// EventCreated is sent once an upload, paste, shortened URL or resumable upload was stored as an entry.
+	EventCreated = "entry.created"
+	// EventDeleted is sent once an entry was deleted via its deletion URL.
+	EventDeleted = "entry.deleted"
+	// EventExpired is sent once an expired entry was removed from the storage.
+	EventExpired = "entry.expired"
+	// EventAccessed is sent when an entry is requested for the first time.
+	EventAccessed = "entry.accessed"
+)
+
+// eventTypes contains all types of events which can be subscribed by a webhook.
+var eventTypes = []string{EventCreated, EventDeleted, EventExpired, EventAccessed}
+
+// idLength is the amount of random bytes used for the IDs of the events and the deliveries.
+const idLength = 16
+
+// Event is the JSON payload which is sent to the webhooks.
+type Event struct {
+	// ID identifies the event. It is the same for every webhook and every attempt to deliver it, so receivers can
+	// detect duplicates.
+	ID    string        `json:"id"`
+	Type  string        `json:"type"`
+	Date  time.Time     `json:"date"`
+	Entry *EventPayload `json:"entry"`
+}
+
+// EventPayload is the JSON representation of the entry an Event is about.
+type EventPayload struct {
+	CallReference string `json:"call_reference"`
+	Kind          string `json:"kind"`
+	Author        string `json:"author"`
+	Filename      string `json:"filename"`
+	ContentType   string `json:"content_type"`
+	// URL is only set if the PublicURL of the Dispatcher is configured.
+	URL        string    `json:"url,omitempty"`
+	UploadDate time.Time `json:"upload_date"`
+	// ExpiryDate is nil if the entry never expires.
+	ExpiryDate  *time.Time `json:"expiry_date,omitempty"`
+	ContentHash string     `json:"content_hash,omitempty"`
+	// Size is only known for created entries.
+	Size int64 `json:"size,omitempty"`
+}
+
+// newEvent creates a new event of the given type about the given entry.
+func newEvent(eventType string, entry *storage.Entry, size int64, publicURL string) (*Event, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	payload := &EventPayload{
+		CallReference: entry.CallReference,
+		Kind:          string(entry.Kind),
+		Author:        string(entry.Author),
+		Filename:      entry.Filename,
+		ContentType:   entry.ContentType,
+		UploadDate:    entry.UploadDate,
+		ContentHash:   entry.ContentHash,
+		Size:          size,
+	}
+	if payload.Kind == "" {
+		// entries of older versions do not have a kind
+		payload.Kind = string(storage.KindFile)
+	}
+	if publicURL != "" {
+		payload.URL = strings.TrimSuffix(publicURL, "/") + "/" + entry.CallReference
+	}
+	if !entry.ExpiryDate.IsZero() {
+		expiryDate := entry.ExpiryDate
+		payload.ExpiryDate = &expiryDate
+	}
+	return &Event{ID: id, Type: eventType, Date: time.Now(), Entry: payload}, nil
+}
+
+// newID randomly creates a new hex encoded ID of an event or a delivery.
+func newID() (string, error) {
+	id := make([]byte, idLength)
+	if _, err := cryptRand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// isValidID checks whether the given value could have been created by newID.
+func isValidID(value string) bool {
+	if len(value) != idLength*2 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// deliveryFileSuffix is the suffix of the files which contain the pending deliveries.
+	deliveryFileSuffix = ".json"
+	// accessedFolder is the name of the folder which contains an empty marker file for every accessed entry.
+	accessedFolder = "accessed-entries"
+	// temporarySuffix is the suffix of the files which are written before they are renamed.
+	temporarySuffix = ".tmp"
+)
+
+// delivery is an event which still has to be sent to a webhook. It is persisted inside of the QueueFolder until it
+// was sent successfully or the Dispatcher gave up, so it survives a restart of the server.
+type delivery struct {
+	ID string `json:"id"`
+	// URL is the URL of the webhook. The webhook is resolved by it once the event is sent, so its secret is not
+	// persisted.
+	URL       string `json:"url"`
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	// Payload is the request body which is signed and sent.
+	Payload      json.RawMessage `json:"payload"`
+	Attempts     int             `json:"attempts"`
+	CreationDate time.Time       `json:"creation_date"`
+	NextAttempt  time.Time       `json:"next_attempt"`
+}
+
+// readDeliveries reads all pending deliveries from the QueueFolder.
+func (dispatcher *Dispatcher) readDeliveries() ([]*delivery, error) {
+	fileInfos, err := ioutil.ReadDir(dispatcher.QueueFolder)
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []*delivery
+	for _, fileInfo := range fileInfos {
+		id := strings.TrimSuffix(fileInfo.Name(), deliveryFileSuffix)
+		if id == fileInfo.Name() || !isValidID(id) {
+			continue
+		}
+		data, err := ioutil.ReadFile(dispatcher.queueFilepath(fileInfo.Name()))
+		if err != nil {
+			return nil, err
+		}
+		pendingDelivery := &delivery{}
+		if err = json.Unmarshal(data, pendingDelivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, pendingDelivery)
+	}
+	return deliveries, nil
+}
+
+// writeDelivery replaces the persisted state of the given delivery.
+func (dispatcher *Dispatcher) writeDelivery(pendingDelivery *delivery) error {
+	data, err := json.Marshal(pendingDelivery)
+	if err != nil {
+		return err
+	}
+	return dispatcher.writeQueueFile(pendingDelivery.ID+deliveryFileSuffix, data)
+}
+
+// removeDelivery removes the persisted state of the given delivery.
+func (dispatcher *Dispatcher) removeDelivery(pendingDelivery *delivery) error {
+	err := os.Remove(dispatcher.queueFilepath(pendingDelivery.ID + deliveryFileSuffix))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// readAccessed reads the call references of the accessed entries from their marker files inside of the QueueFolder.
+func (dispatcher *Dispatcher) readAccessed() (map[string]bool, error) {
+	accessed := make(map[string]bool)
+	fileInfos, err := ioutil.ReadDir(dispatcher.queueFilepath(accessedFolder))
+	if os.IsNotExist(err) {
+		// no entry was accessed yet
+		return accessed, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, fileInfo := range fileInfos {
+		callReference, err := hex.DecodeString(fileInfo.Name())
+		if err != nil {
+			continue
+		}
+		accessed[string(callReference)] = true
+	}
+	return accessed, nil
+}
+
+// writeAccessed creates the marker file of the accessed entry with the given call reference.
+func (dispatcher *Dispatcher) writeAccessed(callReference string) error {
+	if err := os.MkdirAll(dispatcher.queueFilepath(accessedFolder), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dispatcher.accessedFilepath(callReference), nil, 0600)
+}
+
+// removeAccessed removes the marker file of the accessed entry with the given call reference.
+func (dispatcher *Dispatcher) removeAccessed(callReference string) error {
+	err := os.Remove(dispatcher.accessedFilepath(callReference))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// accessedFilepath returns the path of the marker file of the accessed entry with the given call reference. The call
+// reference is hex encoded, so it can not be used to access other files.
+func (dispatcher *Dispatcher) accessedFilepath(callReference string) string {
+	return filepath.Join(dispatcher.QueueFolder, accessedFolder, hex.EncodeToString([]byte(callReference)))
+}
+
+// writeQueueFile replaces the file with the given name inside of the QueueFolder. The data is written to a temporary
+// file first which is renamed afterwards so that a crash can not leave a half written file behind.
+func (dispatcher *Dispatcher) writeQueueFile(name string, data []byte) error {
+	queueFilepath := dispatcher.queueFilepath(name)
+	if err := ioutil.WriteFile(queueFilepath+temporarySuffix, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(queueFilepath+temporarySuffix, queueFilepath)
+}
+
+// queueFilepath returns the path of the file with the given name inside of the QueueFolder.
+func (dispatcher *Dispatcher) queueFilepath(name string) string {
+	return filepath.Join(dispatcher.QueueFolder, name)
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// headers of the requests which are sent to the webhooks
+const (
+	// signatureHeader contains the hex encoded HMAC-SHA256 of the request body with the prefix "sha256=".
+	signatureHeader = "X-Webhook-Signature"
+	// eventHeader contains the type of the event.
+	eventHeader = "X-Webhook-Event"
+	// deliveryHeader contains the ID of the event.
+	deliveryHeader = "X-Webhook-Delivery"
+	// signaturePrefix is the prefix of the value of the signatureHeader.
+	signaturePrefix = "sha256="
+)
+
+// Webhook is a URL which receives the events of the Dispatcher as JSON encoded POST requests.
+type Webhook struct {
+	// URL is the URL the events are sent to.
+	URL string
+	// Secret is the key of the HMAC-SHA256 of the request body which is sent within the X-Webhook-Signature header,
+	// so the receiver is able to verify that an event was sent by this server. The header is omitted if it is empty.
+	Secret string
+	// Events contains the types of the events which are sent to the webhook (see EventCreated, EventDeleted,
+	// EventExpired and EventAccessed). Every event is sent if it is empty.
+	Events []string
+}
+
+// validate checks whether the webhook has a URL and only subscribes to known events.
+func (webhook *Webhook) validate() error {
+	if webhook.URL == "" {
+		return fmt.Errorf("a webhook has no URL")
+	}
+	for _, eventType := range webhook.Events {
+		if !isEventType(eventType) {
+			return fmt.Errorf("the webhook %s subscribes to the unknown event %s", strconv.Quote(webhook.URL),
+				strconv.Quote(eventType))
+		}
+	}
+	return nil
+}
+
+// subscribes checks whether the given type of events is sent to the webhook.
+func (webhook *Webhook) subscribes(eventType string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, subscribedEventType := range webhook.Events {
+		if subscribedEventType == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// sign returns the value of the signature header of a request with the given body.
+func (webhook *Webhook) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// isEventType checks whether the given value is one of the known types of events.
+func isEventType(value string) bool {
+	for _, eventType := range eventTypes {
+		if eventType == value {
+			return true
+		}
+	}
+	return false
+}